@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/pskclub/mine-core/utils"
@@ -15,38 +17,194 @@ type ICache interface {
 	Get(dest interface{}, key string) error
 	GetJSON(dest interface{}, key string) error
 	Del(key string) error
+	// SetNX set the key only when it does not exist, it returns false when the key already exists
+	SetNX(key string, value interface{}, expiration time.Duration) (bool, error)
+	// Eval run a Lua script on the server
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+	SetNXJSON(key string, value interface{}, expiration time.Duration) (bool, error)
+	// Exists return how many of the keys exist, a cluster checks the keys one by one in a pipeline
+	Exists(keys ...string) (int64, error)
+	Expire(key string, expiration time.Duration) (bool, error)
+	// TTL return -1 when the key has no expiration and -2 when it does not exist
+	TTL(key string) (time.Duration, error)
+	// Incr, IncrBy, Decr and DecrBy set the expiration when they create the key, a zero expiration keeps the key forever
+	Incr(key string, expiration time.Duration) (int64, error)
+	IncrBy(key string, value int64, expiration time.Duration) (int64, error)
+	Decr(key string, expiration time.Duration) (int64, error)
+	DecrBy(key string, value int64, expiration time.Duration) (int64, error)
+	// MGet return the values of the keys in order, a missing key is nil. A cluster gets the keys one by one in a pipeline
+	// because they can belong to different slots
+	MGet(keys ...string) ([]interface{}, error)
+	// MSet set the values atomically on a single node or a sentinel, a cluster sets them one by one in a pipeline,
+	// so a failure can leave some of them set
+	MSet(values map[string]interface{}, expiration time.Duration) error
+	MSetJSON(values map[string]interface{}, expiration time.Duration) error
+	HSet(key string, values map[string]interface{}) error
+	HSetJSON(key string, field string, value interface{}) error
+	HGet(dest interface{}, key string, field string) error
+	HGetJSON(dest interface{}, key string, field string) error
+	HGetAll(key string) (map[string]string, error)
+	HDel(key string, fields ...string) error
+	HExists(key string, field string) (bool, error)
+	HIncrBy(key string, field string, value int64) (int64, error)
+	LPush(key string, values ...interface{}) (int64, error)
+	RPush(key string, values ...interface{}) (int64, error)
+	LPushJSON(key string, values ...interface{}) (int64, error)
+	RPushJSON(key string, values ...interface{}) (int64, error)
+	LPop(dest interface{}, key string) error
+	RPop(dest interface{}, key string) error
+	LPopJSON(dest interface{}, key string) error
+	RPopJSON(dest interface{}, key string) error
+	LRange(key string, start int64, stop int64) ([]string, error)
+	LLen(key string) (int64, error)
+	LTrim(key string, start int64, stop int64) error
+	SAdd(key string, members ...interface{}) (int64, error)
+	SRem(key string, members ...interface{}) (int64, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key string, member interface{}) (bool, error)
+	SCard(key string) (int64, error)
+	ZAdd(key string, members ...*redis.Z) (int64, error)
+	ZRem(key string, members ...interface{}) (int64, error)
+	ZScore(key string, member string) (float64, error)
+	ZIncrBy(key string, increment float64, member string) (float64, error)
+	ZRange(key string, start int64, stop int64) ([]string, error)
+	ZRangeWithScores(key string, start int64, stop int64) ([]redis.Z, error)
+	ZRangeByScore(key string, opt *redis.ZRangeBy) ([]string, error)
+	ZRevRange(key string, start int64, stop int64) ([]string, error)
+	ZCard(key string) (int64, error)
+	// Pipelined send the commands queued by fn in one round trip
+	Pipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error)
+	// TxPipelined send the commands queued by fn in one round trip wrapped in MULTI/EXEC, on a cluster every key must
+	// belong to the same slot, e.g. with a {hash tag}
+	TxPipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error)
+	// Publish send message to the subscribers of channel
+	Publish(channel string, message interface{}) error
+	// Subscribe call handler with the messages of channels in background until the returned close function is called
+	Subscribe(handler func(channel string, payload string), channels ...string) (func() error, error)
+	// Remember decode the value of key into dest, a missing key is loaded by loader and stored for ttl.
+	// Concurrent misses of the key share a single load, see CacheRememberOptions for the stale, not found and lock options
+	Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error
+	// Stats return the hits and misses counted by Remember
+	Stats() CacheStats
+	Ping() error
+	WithContext(ctx context.Context) ICache
 	Close()
 }
 
 type DatabaseCache struct {
 	Host string
 	Port string
+	// Addrs is the seed list of the cluster or sentinel nodes, it takes precedence over Host and Port
+	Addrs            []string
+	Username         string
+	Password         string
+	DB               int
+	MasterName       string
+	SentinelPassword string
+	Cluster          bool
+	TLS              bool
+	TLSSkipVerify    bool
+	PoolSize         int
+	MinIdleConns     int
+	DialTimeout      time.Duration
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
 }
 
 type cache struct {
-	rdb *redis.Client
+	rdb      redis.UniversalClient
+	ctx      context.Context
+	remember *cacheRemember
 }
 
-var ctx = context.Background()
-
 func NewCache(env *ENVConfig) *DatabaseCache {
 	return &DatabaseCache{
-		Host: env.CacheHost,
-		Port: env.CachePort,
+		Host:             env.CacheHost,
+		Port:             env.CachePort,
+		Addrs:            envList(env.CacheAddrs),
+		Username:         env.CacheUsername,
+		Password:         env.CachePassword,
+		DB:               env.CacheDB,
+		MasterName:       env.CacheMasterName,
+		SentinelPassword: env.CacheSentinelPassword,
+		Cluster:          env.CacheCluster,
+		TLS:              env.CacheTLS,
+		TLSSkipVerify:    env.CacheTLSSkipVerify,
+		PoolSize:         env.CachePoolSize,
+		MinIdleConns:     env.CacheMinIdleConns,
+		DialTimeout:      env.CacheDialTimeout,
+		ReadTimeout:      env.CacheReadTimeout,
+		WriteTimeout:     env.CacheWriteTimeout,
 	}
 }
 
+func (r DatabaseCache) options() *redis.UniversalOptions {
+	addrs := r.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{fmt.Sprintf("%s:%s", r.Host, r.Port)}
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               r.DB,
+		Username:         r.Username,
+		Password:         r.Password,
+		SentinelPassword: r.SentinelPassword,
+		MasterName:       r.MasterName,
+		PoolSize:         r.PoolSize,
+		MinIdleConns:     r.MinIdleConns,
+		DialTimeout:      r.DialTimeout,
+		ReadTimeout:      r.ReadTimeout,
+		WriteTimeout:     r.WriteTimeout,
+	}
+
+	if r.TLS {
+		options.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: r.TLSSkipVerify,
+		}
+	}
+
+	return options
+}
+
+// Connect create a sentinel failover client when MasterName is set, a cluster client when Cluster is set or Addrs has
+// several nodes, and a single node client otherwise
 func (r DatabaseCache) Connect() (ICache, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s:%s", r.Host, r.Port),
-	})
+	options := r.options()
+
+	var rdb redis.UniversalClient
+	if r.Cluster && r.MasterName == "" {
+		rdb = redis.NewClusterClient(options.Cluster())
+	} else {
+		rdb = redis.NewUniversalClient(options)
+	}
 
-	status := rdb.Ping(ctx)
+	status := rdb.Ping(context.Background())
 	if status.Err() != nil {
+		_ = rdb.Close()
 		return nil, status.Err()
 	}
 
-	return &cache{rdb}, nil
+	return &cache{rdb: rdb, ctx: context.Background(), remember: newCacheRemember()}, nil
+}
+
+// WithContext return a copy of the cache that runs every command with ctx
+func (c cache) WithContext(ctx context.Context) ICache {
+	c.ctx = ctx
+	return &c
+}
+
+func (c cache) getContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+func (c cache) Ping() error {
+	return c.rdb.Ping(c.getContext()).Err()
 }
 
 func (c cache) Close() {
@@ -57,31 +215,46 @@ func (c cache) Close() {
 }
 
 func (c cache) Set(key string, value interface{}, expiration time.Duration) error {
-	return c.rdb.Set(ctx, key, value, expiration).Err()
+	return c.rdb.Set(c.getContext(), key, value, expiration).Err()
+}
+
+func (c cache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.rdb.SetNX(c.getContext(), key, value, expiration).Result()
+}
+
+func (c cache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.rdb.Eval(c.getContext(), script, keys, args...).Result()
 }
 
 func (c cache) Get(dest interface{}, key string) error {
-	return c.rdb.Get(ctx, key).Scan(dest)
+	return c.rdb.Get(c.getContext(), key).Scan(dest)
 }
 
 func (c cache) Del(key string) error {
-	if strings.Contains(key, "*") {
-		iter := c.rdb.Scan(ctx, 0, key, 0).Iterator()
-		if err := iter.Err(); err != nil {
-			return err
-		}
+	if !strings.Contains(key, "*") {
+		return c.rdb.Del(c.getContext(), key).Err()
+	}
 
-		for iter.Next(ctx) {
-			err := c.rdb.Del(ctx, iter.Val()).Err()
-			if err != nil {
-				return err
-			}
-		}
+	// a cluster spreads the keys on its masters, so every master is scanned
+	if cluster, ok := c.rdb.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(c.getContext(), func(ctx context.Context, client *redis.Client) error {
+			return c.delPattern(ctx, client, key)
+		})
+	}
 
-		return nil
-	} else {
-		return c.rdb.Del(ctx, key).Err()
+	return c.delPattern(c.getContext(), c.rdb, key)
+}
+
+func (c cache) delPattern(ctx context.Context, rdb redis.Cmdable, pattern string) error {
+	iter := rdb.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		err := rdb.Del(ctx, iter.Val()).Err()
+		if err != nil {
+			return err
+		}
 	}
+
+	return iter.Err()
 }
 
 func (c cache) SetJSON(key string, value interface{}, expiration time.Duration) error {
@@ -98,3 +271,332 @@ func (c cache) GetJSON(dest interface{}, key string) error {
 
 	return utils.JSONParse(utils.StringToBytes(str), dest)
 }
+
+func (c cache) SetNXJSON(key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.SetNX(key, utils.JSONToString(value), expiration)
+}
+
+// isCluster report whether the keys can belong to different nodes, a cluster rejects a multi-key command or a
+// transaction on keys of different slots with CROSSSLOT
+func (c cache) isCluster() bool {
+	_, ok := c.rdb.(*redis.ClusterClient)
+	return ok
+}
+
+func (c cache) Exists(keys ...string) (int64, error) {
+	if !c.isCluster() || len(keys) <= 1 {
+		return c.rdb.Exists(c.getContext(), keys...).Result()
+	}
+
+	cmds := make([]*redis.IntCmd, 0, len(keys))
+	_, err := c.rdb.Pipelined(c.getContext(), func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.Exists(c.getContext(), key))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, cmd := range cmds {
+		count += cmd.Val()
+	}
+
+	return count, nil
+}
+
+func (c cache) Expire(key string, expiration time.Duration) (bool, error) {
+	return c.rdb.Expire(c.getContext(), key, expiration).Result()
+}
+
+func (c cache) TTL(key string) (time.Duration, error) {
+	return c.rdb.TTL(c.getContext(), key).Result()
+}
+
+// cacheIncrByScript increment the key and set its expiration when it has none, so a counter window starts at its first increment
+const cacheIncrByScript = `local value = redis.call("incrby", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call("pttl", KEYS[1]) == -1 then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return value`
+
+func (c cache) Incr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, 1, expiration)
+}
+
+func (c cache) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	if expiration <= 0 {
+		return c.rdb.IncrBy(c.getContext(), key, value).Result()
+	}
+
+	return c.rdb.Eval(c.getContext(), cacheIncrByScript, []string{key}, value, expiration.Milliseconds()).Int64()
+}
+
+func (c cache) Decr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -1, expiration)
+}
+
+func (c cache) DecrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -value, expiration)
+}
+
+func (c cache) MGet(keys ...string) ([]interface{}, error) {
+	if !c.isCluster() {
+		return c.rdb.MGet(c.getContext(), keys...).Result()
+	}
+
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	_, err := c.rdb.Pipelined(c.getContext(), func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.Get(c.getContext(), key))
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	// Pipelined only returns the first error, a failure after a miss must not be read as a miss
+	values := make([]interface{}, 0, len(keys))
+	for _, cmd := range cmds {
+		value, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			values = append(values, nil)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (c cache) MSet(values map[string]interface{}, expiration time.Duration) error {
+	if expiration <= 0 && !c.isCluster() {
+		return c.rdb.MSet(c.getContext(), values).Err()
+	}
+
+	pipelined := c.rdb.TxPipelined
+	if c.isCluster() {
+		pipelined = c.rdb.Pipelined
+	}
+
+	_, err := pipelined(c.getContext(), func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(c.getContext(), key, value, expiration)
+		}
+
+		return nil
+	})
+	return err
+}
+
+func (c cache) MSetJSON(values map[string]interface{}, expiration time.Duration) error {
+	newValues := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		newValues[key] = utils.JSONToString(value)
+	}
+
+	return c.MSet(newValues, expiration)
+}
+
+func (c cache) HSet(key string, values map[string]interface{}) error {
+	return c.rdb.HSet(c.getContext(), key, values).Err()
+}
+
+func (c cache) HSetJSON(key string, field string, value interface{}) error {
+	return c.rdb.HSet(c.getContext(), key, field, utils.JSONToString(value)).Err()
+}
+
+func (c cache) HGet(dest interface{}, key string, field string) error {
+	return c.rdb.HGet(c.getContext(), key, field).Scan(dest)
+}
+
+func (c cache) HGetJSON(dest interface{}, key string, field string) error {
+	str, err := c.rdb.HGet(c.getContext(), key, field).Result()
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c cache) HGetAll(key string) (map[string]string, error) {
+	return c.rdb.HGetAll(c.getContext(), key).Result()
+}
+
+func (c cache) HDel(key string, fields ...string) error {
+	return c.rdb.HDel(c.getContext(), key, fields...).Err()
+}
+
+func (c cache) HExists(key string, field string) (bool, error) {
+	return c.rdb.HExists(c.getContext(), key, field).Result()
+}
+
+func (c cache) HIncrBy(key string, field string, value int64) (int64, error) {
+	return c.rdb.HIncrBy(c.getContext(), key, field, value).Result()
+}
+
+func (c cache) LPush(key string, values ...interface{}) (int64, error) {
+	return c.rdb.LPush(c.getContext(), key, values...).Result()
+}
+
+func (c cache) RPush(key string, values ...interface{}) (int64, error) {
+	return c.rdb.RPush(c.getContext(), key, values...).Result()
+}
+
+func cacheJSONValues(values []interface{}) []interface{} {
+	newValues := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		newValues = append(newValues, utils.JSONToString(value))
+	}
+
+	return newValues
+}
+
+func (c cache) LPushJSON(key string, values ...interface{}) (int64, error) {
+	return c.LPush(key, cacheJSONValues(values)...)
+}
+
+func (c cache) RPushJSON(key string, values ...interface{}) (int64, error) {
+	return c.RPush(key, cacheJSONValues(values)...)
+}
+
+func (c cache) LPop(dest interface{}, key string) error {
+	return c.rdb.LPop(c.getContext(), key).Scan(dest)
+}
+
+func (c cache) RPop(dest interface{}, key string) error {
+	return c.rdb.RPop(c.getContext(), key).Scan(dest)
+}
+
+func (c cache) LPopJSON(dest interface{}, key string) error {
+	str, err := c.rdb.LPop(c.getContext(), key).Result()
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c cache) RPopJSON(dest interface{}, key string) error {
+	str, err := c.rdb.RPop(c.getContext(), key).Result()
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c cache) LRange(key string, start int64, stop int64) ([]string, error) {
+	return c.rdb.LRange(c.getContext(), key, start, stop).Result()
+}
+
+func (c cache) LLen(key string) (int64, error) {
+	return c.rdb.LLen(c.getContext(), key).Result()
+}
+
+func (c cache) LTrim(key string, start int64, stop int64) error {
+	return c.rdb.LTrim(c.getContext(), key, start, stop).Err()
+}
+
+func (c cache) SAdd(key string, members ...interface{}) (int64, error) {
+	return c.rdb.SAdd(c.getContext(), key, members...).Result()
+}
+
+func (c cache) SRem(key string, members ...interface{}) (int64, error) {
+	return c.rdb.SRem(c.getContext(), key, members...).Result()
+}
+
+func (c cache) SMembers(key string) ([]string, error) {
+	return c.rdb.SMembers(c.getContext(), key).Result()
+}
+
+func (c cache) SIsMember(key string, member interface{}) (bool, error) {
+	return c.rdb.SIsMember(c.getContext(), key, member).Result()
+}
+
+func (c cache) SCard(key string) (int64, error) {
+	return c.rdb.SCard(c.getContext(), key).Result()
+}
+
+func (c cache) ZAdd(key string, members ...*redis.Z) (int64, error) {
+	return c.rdb.ZAdd(c.getContext(), key, members...).Result()
+}
+
+func (c cache) ZRem(key string, members ...interface{}) (int64, error) {
+	return c.rdb.ZRem(c.getContext(), key, members...).Result()
+}
+
+func (c cache) ZScore(key string, member string) (float64, error) {
+	return c.rdb.ZScore(c.getContext(), key, member).Result()
+}
+
+func (c cache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return c.rdb.ZIncrBy(c.getContext(), key, increment, member).Result()
+}
+
+func (c cache) ZRange(key string, start int64, stop int64) ([]string, error) {
+	return c.rdb.ZRange(c.getContext(), key, start, stop).Result()
+}
+
+func (c cache) ZRangeWithScores(key string, start int64, stop int64) ([]redis.Z, error) {
+	return c.rdb.ZRangeWithScores(c.getContext(), key, start, stop).Result()
+}
+
+func (c cache) ZRangeByScore(key string, opt *redis.ZRangeBy) ([]string, error) {
+	return c.rdb.ZRangeByScore(c.getContext(), key, opt).Result()
+}
+
+func (c cache) ZRevRange(key string, start int64, stop int64) ([]string, error) {
+	return c.rdb.ZRevRange(c.getContext(), key, start, stop).Result()
+}
+
+func (c cache) ZCard(key string) (int64, error) {
+	return c.rdb.ZCard(c.getContext(), key).Result()
+}
+
+func (c cache) Pipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return c.rdb.Pipelined(c.getContext(), fn)
+}
+
+func (c cache) TxPipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return c.rdb.TxPipelined(c.getContext(), fn)
+}
+
+func (c cache) Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	return c.remember.remember(&c, dest, key, ttl, loader, options...)
+}
+
+func (c cache) Stats() CacheStats {
+	return c.remember.stats()
+}
+
+func (c cache) Publish(channel string, message interface{}) error {
+	return c.rdb.Publish(c.getContext(), channel, message).Err()
+}
+
+func (c cache) Subscribe(handler func(channel string, payload string), channels ...string) (func() error, error) {
+	pubsub := c.rdb.Subscribe(context.Background(), channels...)
+	_, err := pubsub.Receive(c.getContext())
+	if err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	go func() {
+		for message := range pubsub.Channel() {
+			handler(message.Channel, message.Payload)
+		}
+	}()
+
+	return pubsub.Close, nil
+}
@@ -0,0 +1,1207 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/pskclub/mine-core/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultMemoryCacheMaxEntries = 10000
+
+var (
+	// ErrCacheNotSupported is returned by the memory cache for Eval and the pipelines, which need a Redis server
+	ErrCacheNotSupported = errors.New("cache: not supported by the memory cache")
+	ErrCacheWrongType    = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrCacheNotInteger   = errors.New("ERR value is not an integer or out of range")
+)
+
+type MemoryCacheOptions struct {
+	// MaxEntries evict the least recently used keys above this size, defaults to DefaultMemoryCacheMaxEntries, a negative value is unlimited
+	MaxEntries int
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+type memoryCacheStore struct {
+	mutex       sync.Mutex
+	entries     map[string]*list.Element
+	lru         *list.List
+	maxEntries  int
+	subscribers map[string][]*memoryCacheSubscriber
+}
+
+type memoryCacheSubscriber struct {
+	handler func(channel string, payload string)
+}
+
+type memoryCache struct {
+	store    *memoryCacheStore
+	remember *cacheRemember
+}
+
+// NewMemoryCache create an in-process ICache with the Redis semantics, a missing key is redis.Nil.
+// Every key is evicted by its expiration or by the LRU order above MaxEntries, Eval and the pipelines are not supported
+func NewMemoryCache(options *MemoryCacheOptions) ICache {
+	maxEntries := DefaultMemoryCacheMaxEntries
+	if options != nil && options.MaxEntries != 0 {
+		maxEntries = options.MaxEntries
+	}
+
+	return &memoryCache{
+		store: &memoryCacheStore{
+			entries:     make(map[string]*list.Element),
+			lru:         list.New(),
+			maxEntries:  maxEntries,
+			subscribers: make(map[string][]*memoryCacheSubscriber),
+		},
+		remember: newCacheRemember(),
+	}
+}
+
+// memoryCacheString convert value like go-redis writes an argument
+func memoryCacheString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		return string(b), err
+	}
+
+	return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", value)
+}
+
+// get return the live entry of key and mark it as recently used, the caller must hold the mutex
+func (s *memoryCacheStore) get(key string) *memoryCacheEntry {
+	element, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		s.remove(key)
+		return nil
+	}
+
+	s.lru.MoveToFront(element)
+	return entry
+}
+
+// set store value for key, a zero expiration keeps the key forever, the caller must hold the mutex
+func (s *memoryCacheStore) set(key string, value interface{}, expiration time.Duration) *memoryCacheEntry {
+	expiresAt := time.Time{}
+	if expiration > 0 {
+		expiresAt = time.Now().Add(expiration)
+	}
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.lru.MoveToFront(element)
+		return entry
+	}
+
+	entry := &memoryCacheEntry{key: key, value: value, expiresAt: expiresAt}
+	s.entries[key] = s.lru.PushFront(entry)
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back().Value.(*memoryCacheEntry).key)
+	}
+
+	return entry
+}
+
+// setKeep store value for key and keep its expiration, like the Redis commands that modify a value
+func (s *memoryCacheStore) setKeep(key string, value interface{}) {
+	if entry := s.get(key); entry != nil {
+		entry.value = value
+		return
+	}
+
+	s.set(key, value, 0)
+}
+
+func (s *memoryCacheStore) remove(key string) {
+	if element, ok := s.entries[key]; ok {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+}
+
+// removeEmpty delete key once its hash, list, set or sorted set is empty, like Redis
+func (s *memoryCacheStore) removeEmpty(key string, size int) {
+	if size == 0 {
+		s.remove(key)
+	}
+}
+
+func (c memoryCache) getString(key string) (string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	entry := c.store.get(key)
+	if entry == nil {
+		return "", redis.Nil
+	}
+
+	value, ok := entry.value.(string)
+	if !ok {
+		return "", ErrCacheWrongType
+	}
+
+	return value, nil
+}
+
+func (c memoryCache) WithContext(ctx context.Context) ICache {
+	return &c
+}
+
+func (c memoryCache) Ping() error {
+	return nil
+}
+
+func (c memoryCache) Close() {}
+
+func (c memoryCache) Set(key string, value interface{}, expiration time.Duration) error {
+	str, err := memoryCacheString(value)
+	if err != nil {
+		return err
+	}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	c.store.set(key, str, expiration)
+	return nil
+}
+
+func (c memoryCache) SetJSON(key string, value interface{}, expiration time.Duration) error {
+	return c.Set(key, utils.JSONToString(value), expiration)
+}
+
+func (c memoryCache) Get(dest interface{}, key string) error {
+	return redis.NewStringResult(c.getString(key)).Scan(dest)
+}
+
+func (c memoryCache) GetJSON(dest interface{}, key string) error {
+	str, err := c.getString(key)
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c memoryCache) Del(key string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if !strings.Contains(key, "*") {
+		c.store.remove(key)
+		return nil
+	}
+
+	for k := range c.store.entries {
+		if memoryCacheMatch(key, k) {
+			c.store.remove(k)
+		}
+	}
+
+	return nil
+}
+
+// memoryCacheMatch report whether str matches the glob pattern of the Redis KEYS and SCAN commands, * and ? match any
+// character including /, [abc], [^abc] and [a-z] match a set of characters and \ escapes the next character
+func memoryCacheMatch(pattern string, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(str); i++ {
+				if memoryCacheMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+
+			str = str[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) > 1:
+					pattern = pattern[1:]
+					match = match || pattern[0] == str[0]
+				case len(pattern) > 2 && pattern[1] == '-':
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+
+					match = match || (str[0] >= start && str[0] <= end)
+					pattern = pattern[2:]
+				default:
+					match = match || pattern[0] == str[0]
+				}
+
+				pattern = pattern[1:]
+			}
+
+			if match == not {
+				return false
+			}
+
+			str = str[1:]
+			if len(pattern) == 0 {
+				// an unclosed set ends the pattern
+				return len(str) == 0
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+
+			str = str[1:]
+		}
+
+		pattern = pattern[1:]
+	}
+
+	return len(str) == 0
+}
+
+func (c memoryCache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	str, err := memoryCacheString(value)
+	if err != nil {
+		return false, err
+	}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	if c.store.get(key) != nil {
+		return false, nil
+	}
+
+	c.store.set(key, str, expiration)
+	return true, nil
+}
+
+func (c memoryCache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, ErrCacheNotSupported
+}
+
+func (c memoryCache) SetNXJSON(key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.SetNX(key, utils.JSONToString(value), expiration)
+}
+
+func (c memoryCache) Exists(keys ...string) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	var count int64
+	for _, key := range keys {
+		if c.store.get(key) != nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (c memoryCache) Expire(key string, expiration time.Duration) (bool, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	entry := c.store.get(key)
+	if entry == nil {
+		return false, nil
+	}
+
+	if expiration <= 0 {
+		c.store.remove(key)
+		return true, nil
+	}
+
+	entry.expiresAt = time.Now().Add(expiration)
+	return true, nil
+}
+
+func (c memoryCache) TTL(key string) (time.Duration, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	entry := c.store.get(key)
+	if entry == nil {
+		return -2, nil
+	}
+
+	if entry.expiresAt.IsZero() {
+		return -1, nil
+	}
+
+	// Redis rounds the remaining time to the nearest second
+	return time.Until(entry.expiresAt).Round(time.Second), nil
+}
+
+func (c memoryCache) Incr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, 1, expiration)
+}
+
+func (c memoryCache) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	entry := c.store.get(key)
+	if entry == nil {
+		c.store.set(key, strconv.FormatInt(value, 10), expiration)
+		return value, nil
+	}
+
+	str, ok := entry.value.(string)
+	if !ok {
+		return 0, ErrCacheWrongType
+	}
+
+	current, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, ErrCacheNotInteger
+	}
+
+	entry.value = strconv.FormatInt(current+value, 10)
+	if entry.expiresAt.IsZero() && expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	return current + value, nil
+}
+
+func (c memoryCache) Decr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -1, expiration)
+}
+
+func (c memoryCache) DecrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -value, expiration)
+}
+
+func (c memoryCache) MGet(keys ...string) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		value, err := c.getString(key)
+		if err != nil {
+			values = append(values, nil)
+			continue
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (c memoryCache) MSet(values map[string]interface{}, expiration time.Duration) error {
+	for key, value := range values {
+		if err := c.Set(key, value, expiration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c memoryCache) MSetJSON(values map[string]interface{}, expiration time.Duration) error {
+	for key, value := range values {
+		if err := c.SetJSON(key, value, expiration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hash return the hash of key, it is created when create is set, the caller must hold the mutex
+func (c memoryCache) hash(key string, create bool) (map[string]string, error) {
+	entry := c.store.get(key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+
+		hash := make(map[string]string)
+		c.store.set(key, hash, 0)
+		return hash, nil
+	}
+
+	hash, ok := entry.value.(map[string]string)
+	if !ok {
+		return nil, ErrCacheWrongType
+	}
+
+	return hash, nil
+}
+
+func (c memoryCache) HSet(key string, values map[string]interface{}) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	hash, err := c.hash(key, true)
+	if err != nil {
+		return err
+	}
+
+	for field, value := range values {
+		str, err := memoryCacheString(value)
+		if err != nil {
+			return err
+		}
+
+		hash[field] = str
+	}
+
+	return nil
+}
+
+func (c memoryCache) HSetJSON(key string, field string, value interface{}) error {
+	return c.HSet(key, map[string]interface{}{field: utils.JSONToString(value)})
+}
+
+func (c memoryCache) hGet(key string, field string) (string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	hash, err := c.hash(key, false)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := hash[field]
+	if !ok {
+		return "", redis.Nil
+	}
+
+	return value, nil
+}
+
+func (c memoryCache) HGet(dest interface{}, key string, field string) error {
+	return redis.NewStringResult(c.hGet(key, field)).Scan(dest)
+}
+
+func (c memoryCache) HGetJSON(dest interface{}, key string, field string) error {
+	str, err := c.hGet(key, field)
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c memoryCache) HGetAll(key string) (map[string]string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	hash, err := c.hash(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(hash))
+	for field, value := range hash {
+		values[field] = value
+	}
+
+	return values, nil
+}
+
+func (c memoryCache) HDel(key string, fields ...string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	hash, err := c.hash(key, false)
+	if err != nil || hash == nil {
+		return err
+	}
+
+	for _, field := range fields {
+		delete(hash, field)
+	}
+
+	c.store.removeEmpty(key, len(hash))
+	return nil
+}
+
+func (c memoryCache) HExists(key string, field string) (bool, error) {
+	_, err := c.hGet(key, field)
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (c memoryCache) HIncrBy(key string, field string, value int64) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	hash, err := c.hash(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	current := int64(0)
+	if str, ok := hash[field]; ok {
+		current, err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, ErrCacheNotInteger
+		}
+	}
+
+	hash[field] = strconv.FormatInt(current+value, 10)
+	return current + value, nil
+}
+
+// list return the list of key, the caller must hold the mutex
+func (c memoryCache) list(key string) ([]string, error) {
+	entry := c.store.get(key)
+	if entry == nil {
+		return nil, nil
+	}
+
+	values, ok := entry.value.([]string)
+	if !ok {
+		return nil, ErrCacheWrongType
+	}
+
+	return values, nil
+}
+
+func (c memoryCache) push(key string, left bool, values ...interface{}) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	current, err := c.list(key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		str, err := memoryCacheString(value)
+		if err != nil {
+			return 0, err
+		}
+
+		if left {
+			current = append([]string{str}, current...)
+		} else {
+			current = append(current, str)
+		}
+	}
+
+	c.store.setKeep(key, current)
+	return int64(len(current)), nil
+}
+
+func (c memoryCache) LPush(key string, values ...interface{}) (int64, error) {
+	return c.push(key, true, values...)
+}
+
+func (c memoryCache) RPush(key string, values ...interface{}) (int64, error) {
+	return c.push(key, false, values...)
+}
+
+func (c memoryCache) LPushJSON(key string, values ...interface{}) (int64, error) {
+	return c.push(key, true, cacheJSONValues(values)...)
+}
+
+func (c memoryCache) RPushJSON(key string, values ...interface{}) (int64, error) {
+	return c.push(key, false, cacheJSONValues(values)...)
+}
+
+func (c memoryCache) pop(key string, left bool) (string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	current, err := c.list(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(current) == 0 {
+		return "", redis.Nil
+	}
+
+	var value string
+	if left {
+		value, current = current[0], current[1:]
+	} else {
+		value, current = current[len(current)-1], current[:len(current)-1]
+	}
+
+	c.store.setKeep(key, current)
+	c.store.removeEmpty(key, len(current))
+	return value, nil
+}
+
+func (c memoryCache) LPop(dest interface{}, key string) error {
+	return redis.NewStringResult(c.pop(key, true)).Scan(dest)
+}
+
+func (c memoryCache) RPop(dest interface{}, key string) error {
+	return redis.NewStringResult(c.pop(key, false)).Scan(dest)
+}
+
+func (c memoryCache) LPopJSON(dest interface{}, key string) error {
+	str, err := c.pop(key, true)
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c memoryCache) RPopJSON(dest interface{}, key string) error {
+	str, err := c.pop(key, false)
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+// memoryCacheRange convert the inclusive Redis range, negative indexes count from the end, to a slice range
+func memoryCacheRange(start int64, stop int64, size int) (int, int) {
+	n := int64(size)
+	if start < 0 {
+		start += n
+	}
+
+	if stop < 0 {
+		stop += n
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	if stop >= n {
+		stop = n - 1
+	}
+
+	if start > stop || start >= n {
+		return 0, 0
+	}
+
+	return int(start), int(stop) + 1
+}
+
+func (c memoryCache) LRange(key string, start int64, stop int64) ([]string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	current, err := c.list(key)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := memoryCacheRange(start, stop, len(current))
+	return append([]string{}, current[from:to]...), nil
+}
+
+func (c memoryCache) LLen(key string) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	current, err := c.list(key)
+	return int64(len(current)), err
+}
+
+func (c memoryCache) LTrim(key string, start int64, stop int64) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	current, err := c.list(key)
+	if err != nil || current == nil {
+		return err
+	}
+
+	from, to := memoryCacheRange(start, stop, len(current))
+	current = append([]string{}, current[from:to]...)
+	c.store.setKeep(key, current)
+	c.store.removeEmpty(key, len(current))
+	return nil
+}
+
+// set return the set of key, it is created when create is set, the caller must hold the mutex
+func (c memoryCache) set(key string, create bool) (map[string]struct{}, error) {
+	entry := c.store.get(key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+
+		members := make(map[string]struct{})
+		c.store.set(key, members, 0)
+		return members, nil
+	}
+
+	members, ok := entry.value.(map[string]struct{})
+	if !ok {
+		return nil, ErrCacheWrongType
+	}
+
+	return members, nil
+}
+
+func (c memoryCache) SAdd(key string, members ...interface{}) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	set, err := c.set(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int64
+	for _, member := range members {
+		str, err := memoryCacheString(member)
+		if err != nil {
+			return added, err
+		}
+
+		if _, ok := set[str]; !ok {
+			set[str] = struct{}{}
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+func (c memoryCache) SRem(key string, members ...interface{}) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	set, err := c.set(key, false)
+	if err != nil || set == nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, member := range members {
+		str, err := memoryCacheString(member)
+		if err != nil {
+			return removed, err
+		}
+
+		if _, ok := set[str]; ok {
+			delete(set, str)
+			removed++
+		}
+	}
+
+	c.store.removeEmpty(key, len(set))
+	return removed, nil
+}
+
+func (c memoryCache) SMembers(key string) ([]string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	set, err := c.set(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func (c memoryCache) SIsMember(key string, member interface{}) (bool, error) {
+	str, err := memoryCacheString(member)
+	if err != nil {
+		return false, err
+	}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	set, err := c.set(key, false)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := set[str]
+	return ok, nil
+}
+
+func (c memoryCache) SCard(key string) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	set, err := c.set(key, false)
+	return int64(len(set)), err
+}
+
+// zset return the sorted set of key, it is created when create is set, the caller must hold the mutex
+func (c memoryCache) zset(key string, create bool) (map[string]float64, error) {
+	entry := c.store.get(key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+
+		members := make(map[string]float64)
+		c.store.set(key, members, 0)
+		return members, nil
+	}
+
+	members, ok := entry.value.(map[string]float64)
+	if !ok {
+		return nil, ErrCacheWrongType
+	}
+
+	return members, nil
+}
+
+// sorted return the members of key by score then member, the caller must hold the mutex
+func (c memoryCache) sorted(key string) ([]redis.Z, error) {
+	zset, err := c.zset(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]redis.Z, 0, len(zset))
+	for member, score := range zset {
+		members = append(members, redis.Z{Score: score, Member: member})
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member.(string) < members[j].Member.(string)
+	})
+	return members, nil
+}
+
+func memoryCacheMembers(members []redis.Z) []string {
+	values := make([]string, 0, len(members))
+	for _, member := range members {
+		values = append(values, member.Member.(string))
+	}
+
+	return values
+}
+
+func (c memoryCache) ZAdd(key string, members ...*redis.Z) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	zset, err := c.zset(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int64
+	for _, member := range members {
+		str, err := memoryCacheString(member.Member)
+		if err != nil {
+			return added, err
+		}
+
+		if _, ok := zset[str]; !ok {
+			added++
+		}
+		zset[str] = member.Score
+	}
+
+	return added, nil
+}
+
+func (c memoryCache) ZRem(key string, members ...interface{}) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	zset, err := c.zset(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, member := range members {
+		str, err := memoryCacheString(member)
+		if err != nil {
+			return removed, err
+		}
+
+		if _, ok := zset[str]; ok {
+			delete(zset, str)
+			removed++
+		}
+	}
+
+	c.store.removeEmpty(key, len(zset))
+	return removed, nil
+}
+
+func (c memoryCache) ZScore(key string, member string) (float64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	zset, err := c.zset(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	score, ok := zset[member]
+	if !ok {
+		return 0, redis.Nil
+	}
+
+	return score, nil
+}
+
+func (c memoryCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	zset, err := c.zset(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	zset[member] += increment
+	return zset[member], nil
+}
+
+func (c memoryCache) ZRange(key string, start int64, stop int64) ([]string, error) {
+	members, err := c.ZRangeWithScores(key, start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	return memoryCacheMembers(members), nil
+}
+
+func (c memoryCache) ZRangeWithScores(key string, start int64, stop int64) ([]redis.Z, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	members, err := c.sorted(key)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := memoryCacheRange(start, stop, len(members))
+	return members[from:to], nil
+}
+
+// memoryCacheScoreBound parse a ZRANGEBYSCORE bound, -inf, +inf or a score prefixed by ( when it is exclusive
+func memoryCacheScoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch bound {
+	case "-inf":
+		return -1 * (1 << 62), exclusive, nil
+	case "+inf", "inf":
+		return 1 << 62, exclusive, nil
+	}
+
+	score, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+
+	return score, exclusive, nil
+}
+
+func (c memoryCache) ZRangeByScore(key string, opt *redis.ZRangeBy) ([]string, error) {
+	min, minExclusive, err := memoryCacheScoreBound(opt.Min)
+	if err != nil {
+		return nil, err
+	}
+
+	max, maxExclusive, err := memoryCacheScoreBound(opt.Max)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	members, err := c.sorted(key)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	skipped := int64(0)
+	for _, member := range members {
+		if member.Score < min || (minExclusive && member.Score == min) || member.Score > max || (maxExclusive && member.Score == max) {
+			continue
+		}
+
+		if skipped < opt.Offset {
+			skipped++
+			continue
+		}
+
+		if opt.Count > 0 && int64(len(values)) >= opt.Count {
+			break
+		}
+
+		values = append(values, member.Member.(string))
+	}
+
+	return values, nil
+}
+
+func (c memoryCache) ZRevRange(key string, start int64, stop int64) ([]string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	members, err := c.sorted(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+
+	from, to := memoryCacheRange(start, stop, len(members))
+	return memoryCacheMembers(members[from:to]), nil
+}
+
+func (c memoryCache) ZCard(key string) (int64, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	zset, err := c.zset(key, false)
+	return int64(len(zset)), err
+}
+
+func (c memoryCache) Pipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, ErrCacheNotSupported
+}
+
+func (c memoryCache) TxPipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, ErrCacheNotSupported
+}
+
+func (c memoryCache) Publish(channel string, message interface{}) error {
+	payload, err := memoryCacheString(message)
+	if err != nil {
+		return err
+	}
+
+	c.store.mutex.Lock()
+	subscribers := append([]*memoryCacheSubscriber{}, c.store.subscribers[channel]...)
+	c.store.mutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.handler(channel, payload)
+	}
+
+	return nil
+}
+
+func (c memoryCache) Subscribe(handler func(channel string, payload string), channels ...string) (func() error, error) {
+	subscriber := &memoryCacheSubscriber{handler: handler}
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for _, channel := range channels {
+		c.store.subscribers[channel] = append(c.store.subscribers[channel], subscriber)
+	}
+
+	return func() error {
+		c.store.mutex.Lock()
+		defer c.store.mutex.Unlock()
+
+		for _, channel := range channels {
+			subscribers := make([]*memoryCacheSubscriber, 0)
+			for _, s := range c.store.subscribers[channel] {
+				if s != subscriber {
+					subscribers = append(subscribers, s)
+				}
+			}
+			c.store.subscribers[channel] = subscribers
+		}
+
+		return nil
+	}, nil
+}
+
+func (c memoryCache) Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	return c.remember.remember(&c, dest, key, ttl, loader, options...)
+}
+
+func (c memoryCache) Stats() CacheStats {
+	return c.remember.stats()
+}
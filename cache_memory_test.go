@@ -0,0 +1,188 @@
+package core
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_GetSet(t *testing.T) {
+	cache := NewMemoryCache(nil)
+
+	var missing string
+	assert.True(t, errors.Is(cache.Get(&missing, "missing"), redis.Nil))
+
+	assert.NoError(t, cache.Set("count", 10, 0))
+	var count int
+	assert.NoError(t, cache.Get(&count, "count"))
+	assert.Equal(t, 10, count)
+
+	assert.NoError(t, cache.SetJSON("user", map[string]string{"name": "john"}, 0))
+	user := map[string]string{}
+	assert.NoError(t, cache.GetJSON(&user, "user"))
+	assert.Equal(t, "john", user["name"])
+
+	ok, err := cache.SetNX("count", 20, 0)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, cache.Del("cou*"))
+	exists, err := cache.Exists("count", "user")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), exists)
+}
+
+func TestMemoryCache_Expiration(t *testing.T) {
+	cache := NewMemoryCache(nil)
+	assert.NoError(t, cache.Set("long", "value", 10*time.Second))
+	ttl, err := cache.TTL("long")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, ttl)
+
+	assert.NoError(t, cache.Set("key", "value", 20*time.Millisecond))
+	ttl, err = cache.TTL("key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	time.Sleep(30 * time.Millisecond)
+	var value string
+	assert.True(t, errors.Is(cache.Get(&value, "key"), redis.Nil))
+
+	ttl, err = cache.TTL("key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(-2), ttl)
+}
+
+func TestMemoryCacheMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"http:/api/*", "http:/api/products/1", true},
+		{"http:/api/*", "http:/web/products", false},
+		{"*", "", true},
+		{"user:*:name", "user:1:name", true},
+		{"user:*:name", "user:1:email", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:10", false},
+		{"user:[0-9]", "user:7", true},
+		{"user:[^0-9]", "user:7", false},
+		{"user:[abc]", "user:b", true},
+		{"user:[abc]", "user:d", false},
+		{`user:\*`, "user:*", true},
+		{`user:\*`, "user:1", false},
+		{"a**b", "axyzb", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.match, memoryCacheMatch(test.pattern, test.key), test.pattern+" "+test.key)
+	}
+}
+
+func TestMemoryCache_DelPattern(t *testing.T) {
+	cache := NewMemoryCache(nil)
+	assert.NoError(t, cache.Set("http:/api/products/1", "1", 0))
+	assert.NoError(t, cache.Set("http:/api/orders", "2", 0))
+	assert.NoError(t, cache.Set("http:/web/products", "3", 0))
+
+	assert.NoError(t, cache.Del("http:/api/*"))
+	exists, err := cache.Exists("http:/api/products/1", "http:/api/orders", "http:/web/products")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), exists)
+}
+
+func TestMemoryCache_LRU(t *testing.T) {
+	cache := NewMemoryCache(&MemoryCacheOptions{MaxEntries: 2})
+	assert.NoError(t, cache.Set("a", "1", 0))
+	assert.NoError(t, cache.Set("b", "2", 0))
+
+	var value string
+	assert.NoError(t, cache.Get(&value, "a"))
+	assert.NoError(t, cache.Set("c", "3", 0))
+
+	assert.NoError(t, cache.Get(&value, "a"))
+	assert.True(t, errors.Is(cache.Get(&value, "b"), redis.Nil))
+	assert.NoError(t, cache.Get(&value, "c"))
+}
+
+func TestMemoryCache_Counters(t *testing.T) {
+	cache := NewMemoryCache(nil)
+
+	value, err := cache.Incr("hits", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+
+	value, err = cache.IncrBy("hits", 5, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), value)
+
+	value, err = cache.Decr("hits", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), value)
+
+	assert.NoError(t, cache.Set("name", "john", 0))
+	_, err = cache.Incr("name", 0)
+	assert.Equal(t, ErrCacheNotInteger, err)
+}
+
+func TestMemoryCache_Collections(t *testing.T) {
+	cache := NewMemoryCache(nil)
+
+	assert.NoError(t, cache.HSet("hash", map[string]interface{}{"a": 1}))
+	count, err := cache.HIncrBy("hash", "a", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = cache.LPush("hash", "x")
+	assert.Equal(t, ErrCacheWrongType, err)
+
+	_, err = cache.RPush("list", "a", "b", "c")
+	assert.NoError(t, err)
+	values, err := cache.LRange("list", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+
+	var first string
+	assert.NoError(t, cache.LPop(&first, "list"))
+	assert.Equal(t, "a", first)
+
+	added, err := cache.SAdd("set", "a", "b", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), added)
+	isMember, err := cache.SIsMember("set", "b")
+	assert.NoError(t, err)
+	assert.True(t, isMember)
+
+	_, err = cache.ZAdd("zset", &redis.Z{Score: 2, Member: "b"}, &redis.Z{Score: 1, Member: "a"}, &redis.Z{Score: 3, Member: "c"})
+	assert.NoError(t, err)
+	values, err = cache.ZRange("zset", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+
+	values, err = cache.ZRangeByScore("zset", &redis.ZRangeBy{Min: "(1", Max: "+inf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, values)
+
+	values, err = cache.ZRevRange("zset", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, values)
+}
+
+func TestMemoryCache_PublishSubscribe(t *testing.T) {
+	cache := NewMemoryCache(nil)
+
+	messages := make([]string, 0)
+	unsubscribe, err := cache.Subscribe(func(channel string, payload string) {
+		messages = append(messages, channel+":"+payload)
+	}, "events")
+	assert.NoError(t, err)
+
+	assert.NoError(t, cache.Publish("events", "created"))
+	assert.NoError(t, unsubscribe())
+	assert.NoError(t, cache.Publish("events", "deleted"))
+
+	assert.Equal(t, []string{"events:created"}, messages)
+}
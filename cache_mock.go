@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/mock"
 	"time"
 )
@@ -13,6 +15,17 @@ func NewMockCache() *MockCache {
 	return &MockCache{}
 }
 
+func (m *MockCache) WithContext(ctx context.Context) ICache {
+	args := m.Called(ctx)
+	cache, _ := args.Get(0).(ICache)
+	return cache
+}
+
+func (m *MockCache) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *MockCache) Close() {
 	m.Called()
 }
@@ -27,6 +40,16 @@ func (m *MockCache) Get(dest interface{}, key string) error {
 	return args.Error(0)
 }
 
+func (m *MockCache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	args := m.Called(key, value, expiration)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	mockArgs := m.Called(script, keys, args)
+	return mockArgs.Get(0), mockArgs.Error(1)
+}
+
 func (m *MockCache) Del(key string) error {
 	args := m.Called(key)
 	return args.Error(0)
@@ -41,3 +64,264 @@ func (m *MockCache) GetJSON(dest interface{}, key string) error {
 	args := m.Called(dest, key)
 	return args.Error(0)
 }
+
+func (m *MockCache) SetNXJSON(key string, value interface{}, expiration time.Duration) (bool, error) {
+	args := m.Called(key, value, expiration)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) Exists(keys ...string) (int64, error) {
+	args := m.Called(keys)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) Expire(key string, expiration time.Duration) (bool, error) {
+	args := m.Called(key, expiration)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) TTL(key string) (time.Duration, error) {
+	args := m.Called(key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockCache) Incr(key string, expiration time.Duration) (int64, error) {
+	args := m.Called(key, expiration)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	args := m.Called(key, value, expiration)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) Decr(key string, expiration time.Duration) (int64, error) {
+	args := m.Called(key, expiration)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) DecrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	args := m.Called(key, value, expiration)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) MGet(keys ...string) ([]interface{}, error) {
+	args := m.Called(keys)
+	value, _ := args.Get(0).([]interface{})
+	return value, args.Error(1)
+}
+
+func (m *MockCache) MSet(values map[string]interface{}, expiration time.Duration) error {
+	args := m.Called(values, expiration)
+	return args.Error(0)
+}
+
+func (m *MockCache) MSetJSON(values map[string]interface{}, expiration time.Duration) error {
+	args := m.Called(values, expiration)
+	return args.Error(0)
+}
+
+func (m *MockCache) HSet(key string, values map[string]interface{}) error {
+	args := m.Called(key, values)
+	return args.Error(0)
+}
+
+func (m *MockCache) HSetJSON(key string, field string, value interface{}) error {
+	args := m.Called(key, field, value)
+	return args.Error(0)
+}
+
+func (m *MockCache) HGet(dest interface{}, key string, field string) error {
+	args := m.Called(dest, key, field)
+	return args.Error(0)
+}
+
+func (m *MockCache) HGetJSON(dest interface{}, key string, field string) error {
+	args := m.Called(dest, key, field)
+	return args.Error(0)
+}
+
+func (m *MockCache) HGetAll(key string) (map[string]string, error) {
+	args := m.Called(key)
+	value, _ := args.Get(0).(map[string]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) HDel(key string, fields ...string) error {
+	args := m.Called(key, fields)
+	return args.Error(0)
+}
+
+func (m *MockCache) HExists(key string, field string) (bool, error) {
+	args := m.Called(key, field)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) HIncrBy(key string, field string, value int64) (int64, error) {
+	args := m.Called(key, field, value)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) LPush(key string, values ...interface{}) (int64, error) {
+	args := m.Called(key, values)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) RPush(key string, values ...interface{}) (int64, error) {
+	args := m.Called(key, values)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) LPushJSON(key string, values ...interface{}) (int64, error) {
+	args := m.Called(key, values)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) RPushJSON(key string, values ...interface{}) (int64, error) {
+	args := m.Called(key, values)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) LPop(dest interface{}, key string) error {
+	args := m.Called(dest, key)
+	return args.Error(0)
+}
+
+func (m *MockCache) RPop(dest interface{}, key string) error {
+	args := m.Called(dest, key)
+	return args.Error(0)
+}
+
+func (m *MockCache) LPopJSON(dest interface{}, key string) error {
+	args := m.Called(dest, key)
+	return args.Error(0)
+}
+
+func (m *MockCache) RPopJSON(dest interface{}, key string) error {
+	args := m.Called(dest, key)
+	return args.Error(0)
+}
+
+func (m *MockCache) LRange(key string, start int64, stop int64) ([]string, error) {
+	args := m.Called(key, start, stop)
+	value, _ := args.Get(0).([]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) LLen(key string) (int64, error) {
+	args := m.Called(key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) LTrim(key string, start int64, stop int64) error {
+	args := m.Called(key, start, stop)
+	return args.Error(0)
+}
+
+func (m *MockCache) SAdd(key string, members ...interface{}) (int64, error) {
+	args := m.Called(key, members)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) SRem(key string, members ...interface{}) (int64, error) {
+	args := m.Called(key, members)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) SMembers(key string) ([]string, error) {
+	args := m.Called(key)
+	value, _ := args.Get(0).([]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) SIsMember(key string, member interface{}) (bool, error) {
+	args := m.Called(key, member)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) SCard(key string) (int64, error) {
+	args := m.Called(key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) ZAdd(key string, members ...*redis.Z) (int64, error) {
+	args := m.Called(key, members)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) ZRem(key string, members ...interface{}) (int64, error) {
+	args := m.Called(key, members)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) ZScore(key string, member string) (float64, error) {
+	args := m.Called(key, member)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	args := m.Called(key, increment, member)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockCache) ZRange(key string, start int64, stop int64) ([]string, error) {
+	args := m.Called(key, start, stop)
+	value, _ := args.Get(0).([]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) ZRangeWithScores(key string, start int64, stop int64) ([]redis.Z, error) {
+	args := m.Called(key, start, stop)
+	value, _ := args.Get(0).([]redis.Z)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) ZRangeByScore(key string, opt *redis.ZRangeBy) ([]string, error) {
+	args := m.Called(key, opt)
+	value, _ := args.Get(0).([]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) ZRevRange(key string, start int64, stop int64) ([]string, error) {
+	args := m.Called(key, start, stop)
+	value, _ := args.Get(0).([]string)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) ZCard(key string) (int64, error) {
+	args := m.Called(key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) Pipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	args := m.Called(fn)
+	value, _ := args.Get(0).([]redis.Cmder)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) TxPipelined(fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	args := m.Called(fn)
+	value, _ := args.Get(0).([]redis.Cmder)
+	return value, args.Error(1)
+}
+
+func (m *MockCache) Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	args := m.Called(dest, key, ttl, loader, options)
+	return args.Error(0)
+}
+
+func (m *MockCache) Stats() CacheStats {
+	args := m.Called()
+	return args.Get(0).(CacheStats)
+}
+
+func (m *MockCache) Publish(channel string, message interface{}) error {
+	args := m.Called(channel, message)
+	return args.Error(0)
+}
+
+func (m *MockCache) Subscribe(handler func(channel string, payload string), channels ...string) (func() error, error) {
+	args := m.Called(handler, channels)
+	closeFunc, _ := args.Get(0).(func() error)
+	return closeFunc, args.Error(1)
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCacheRememberLockTTL  = 10 * time.Second
+	DefaultCacheRememberLockWait = 5 * time.Second
+	cacheRememberPollInterval    = 50 * time.Millisecond
+)
+
+// ErrCacheNotFound is returned by Remember when the loader did not find the value, or when the not found result is cached
+var ErrCacheNotFound = errors.New("cache: not found")
+
+type CacheRememberOptions struct {
+	// StaleTTL keep serving the expired value for this long while it is refreshed in background
+	StaleTTL time.Duration
+	// NegativeTTL cache a not found result for this long, a not found result is not cached when it is zero
+	NegativeTTL time.Duration
+	// IsNotFound tell if a loader error is a not found result, defaults to ErrCacheNotFound, gorm.ErrRecordNotFound and mongo.ErrNoDocuments
+	IsNotFound func(err error) bool
+	// Locker let a single replica load a missing key, the other replicas wait up to LockWait for its value before loading it themselves
+	Locker   ILocker
+	LockTTL  time.Duration
+	LockWait time.Duration
+}
+
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	StaleHits    int64 `json:"stale_hits"`
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	LoadErrors   int64 `json:"load_errors"`
+}
+
+// cacheRememberEntry is the value stored by Remember, it stays in the cache for StaleTTL after FreshUntil
+type cacheRememberEntry struct {
+	Value      json.RawMessage `json:"value,omitempty"`
+	NotFound   bool            `json:"not_found,omitempty"`
+	FreshUntil time.Time       `json:"fresh_until"`
+}
+
+// cacheRemember implement Remember on top of any ICache, it is shared by the copies returned by WithContext
+type cacheRemember struct {
+	group        singleflight.Group
+	hits         int64
+	staleHits    int64
+	negativeHits int64
+	misses       int64
+	loadErrors   int64
+}
+
+func newCacheRemember() *cacheRemember {
+	return &cacheRemember{}
+}
+
+func isCacheNotFound(err error) bool {
+	return errors.Is(err, ErrCacheNotFound) || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, mongo.ErrNoDocuments)
+}
+
+func (r *cacheRemember) stats() CacheStats {
+	return CacheStats{
+		Hits:         atomic.LoadInt64(&r.hits),
+		StaleHits:    atomic.LoadInt64(&r.staleHits),
+		NegativeHits: atomic.LoadInt64(&r.negativeHits),
+		Misses:       atomic.LoadInt64(&r.misses),
+		LoadErrors:   atomic.LoadInt64(&r.loadErrors),
+	}
+}
+
+func (r *cacheRemember) remember(c ICache, dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	rememberOptions := &CacheRememberOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*rememberOptions = *options[0]
+	}
+
+	if rememberOptions.IsNotFound == nil {
+		rememberOptions.IsNotFound = isCacheNotFound
+	}
+
+	if rememberOptions.LockTTL <= 0 {
+		rememberOptions.LockTTL = DefaultCacheRememberLockTTL
+	}
+
+	if rememberOptions.LockWait <= 0 {
+		rememberOptions.LockWait = DefaultCacheRememberLockWait
+	}
+
+	entry := &cacheRememberEntry{}
+	err := c.GetJSON(entry, key)
+	if err == nil {
+		switch {
+		case time.Now().Before(entry.FreshUntil) && entry.NotFound:
+			atomic.AddInt64(&r.negativeHits, 1)
+			return entry.decode(dest)
+		case time.Now().Before(entry.FreshUntil):
+			atomic.AddInt64(&r.hits, 1)
+			return entry.decode(dest)
+		case rememberOptions.StaleTTL > 0:
+			// the request does not wait for the refresh, which outlives it
+			atomic.AddInt64(&r.staleHits, 1)
+			go func() {
+				_, _, _ = r.group.Do(key, func() (interface{}, error) {
+					return r.load(c.WithContext(context.Background()), key, ttl, loader, rememberOptions)
+				})
+			}()
+			return entry.decode(dest)
+		}
+	}
+
+	// a cache failure is handled as a miss, the value is still loaded. The load is shared by every caller of the key,
+	// so it does not use the context of the first one, which would fail the others when it is cancelled
+	atomic.AddInt64(&r.misses, 1)
+	loaded, err, _ := r.group.Do(key, func() (interface{}, error) {
+		return r.load(c.WithContext(context.Background()), key, ttl, loader, rememberOptions)
+	})
+	if err != nil {
+		return err
+	}
+
+	return loaded.(*cacheRememberEntry).decode(dest)
+}
+
+// load call loader and store its result, under the lock of options.Locker when it is set
+func (r *cacheRemember) load(c ICache, key string, ttl time.Duration, loader func() (interface{}, error), options *CacheRememberOptions) (*cacheRememberEntry, error) {
+	if options.Locker != nil {
+		lock, err := options.Locker.TryLock(context.Background(), "lock:"+key, options.LockTTL)
+		if err == nil && lock == nil {
+			if entry := r.wait(c, key, options.LockWait); entry != nil {
+				return entry, nil
+			}
+		}
+
+		if lock != nil {
+			defer func() {
+				_ = lock.Unlock(context.Background())
+			}()
+		}
+	}
+
+	value, err := loader()
+	if err != nil && options.IsNotFound(err) {
+		entry := &cacheRememberEntry{NotFound: true, FreshUntil: time.Now().Add(options.NegativeTTL)}
+		if options.NegativeTTL > 0 {
+			_ = c.SetJSON(key, entry, options.NegativeTTL)
+		}
+
+		return entry, nil
+	}
+
+	if err != nil {
+		atomic.AddInt64(&r.loadErrors, 1)
+		return nil, err
+	}
+
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheRememberEntry{Value: body, FreshUntil: time.Now().Add(ttl)}
+	_ = c.SetJSON(key, entry, ttl+options.StaleTTL)
+	return entry, nil
+}
+
+// wait poll the key until another replica stores a fresh value, it returns nil when timeout is elapsed
+func (r *cacheRemember) wait(c ICache, key string, timeout time.Duration) *cacheRememberEntry {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(cacheRememberPollInterval)
+
+		entry := &cacheRememberEntry{}
+		err := c.GetJSON(entry, key)
+		if err == nil && time.Now().Before(entry.FreshUntil) {
+			return entry
+		}
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (e cacheRememberEntry) decode(dest interface{}) error {
+	if e.NotFound {
+		return ErrCacheNotFound
+	}
+
+	return json.Unmarshal(e.Value, dest)
+}
+
+// CacheRemember is the typed version of ICache.Remember
+func CacheRemember[T any](cache ICache, key string, ttl time.Duration, loader func() (*T, error), options ...*CacheRememberOptions) (*T, error) {
+	dest := new(T)
+	err := cache.Remember(dest, key, ttl, func() (interface{}, error) {
+		return loader()
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return dest, nil
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheRememberTestCache struct {
+	*MockCache
+	remember *cacheRemember
+}
+
+func newCacheRememberTestCache() *cacheRememberTestCache {
+	return &cacheRememberTestCache{MockCache: NewMockCache(), remember: newCacheRemember()}
+}
+
+func (c *cacheRememberTestCache) Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	return c.remember.remember(c, dest, key, ttl, loader, options...)
+}
+
+func (c *cacheRememberTestCache) WithContext(ctx context.Context) ICache {
+	return c
+}
+
+type cacheRememberTestUser struct {
+	Name string `json:"name"`
+}
+
+func TestCache_RememberMiss(t *testing.T) {
+	cache := newCacheRememberTestCache()
+	cache.On("GetJSON", mock.Anything, "user:1").Return(redis.Nil)
+	cache.On("SetJSON", "user:1", mock.Anything, time.Minute).Return(nil)
+
+	var calls int32
+	loader := func() (*cacheRememberTestUser, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return &cacheRememberTestUser{Name: "john"}, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := CacheRemember(cache, "user:1", time.Minute, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, "john", user.Name)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, int64(10), cache.remember.stats().Misses)
+}
+
+func TestCache_RememberHitAndStale(t *testing.T) {
+	cache := newCacheRememberTestCache()
+	freshUntil := time.Now().Add(time.Minute)
+	cache.On("GetJSON", mock.Anything, "user:1").Return(nil).Run(func(args mock.Arguments) {
+		entry := args.Get(0).(*cacheRememberEntry)
+		entry.Value = json.RawMessage(`{"name":"john"}`)
+		entry.FreshUntil = freshUntil
+	})
+
+	refreshed := make(chan struct{})
+	loader := func() (interface{}, error) {
+		close(refreshed)
+		return &cacheRememberTestUser{Name: "jane"}, nil
+	}
+
+	user := &cacheRememberTestUser{}
+	assert.NoError(t, cache.Remember(user, "user:1", time.Minute, loader))
+	assert.Equal(t, "john", user.Name)
+	assert.Equal(t, int64(1), cache.remember.stats().Hits)
+
+	freshUntil = time.Now().Add(-time.Second)
+	cache.On("SetJSON", "user:1", mock.Anything, 2*time.Minute).Return(nil)
+	assert.NoError(t, cache.Remember(user, "user:1", time.Minute, loader, &CacheRememberOptions{StaleTTL: time.Minute}))
+	assert.Equal(t, "john", user.Name)
+	assert.Equal(t, int64(1), cache.remember.stats().StaleHits)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the stale value is not refreshed")
+	}
+}
+
+func TestCache_RememberNotFound(t *testing.T) {
+	cache := newCacheRememberTestCache()
+	cache.On("GetJSON", mock.Anything, "user:2").Return(redis.Nil)
+	cache.On("SetJSON", "user:2", mock.MatchedBy(func(entry *cacheRememberEntry) bool {
+		return entry.NotFound
+	}), 10*time.Second).Return(nil).Once()
+
+	_, err := CacheRemember(cache, "user:2", time.Minute, func() (*cacheRememberTestUser, error) {
+		return nil, gorm.ErrRecordNotFound
+	}, &CacheRememberOptions{NegativeTTL: 10 * time.Second})
+	assert.ErrorIs(t, err, ErrCacheNotFound)
+	cache.AssertExpectations(t)
+}
+
+// cacheRememberContextCache fail the commands once its context is done, like the Redis client
+type cacheRememberContextCache struct {
+	ICache
+	ctx context.Context
+}
+
+func (c *cacheRememberContextCache) WithContext(ctx context.Context) ICache {
+	return &cacheRememberContextCache{ICache: c.ICache, ctx: ctx}
+}
+
+func (c *cacheRememberContextCache) GetJSON(dest interface{}, key string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.ICache.GetJSON(dest, key)
+}
+
+func (c *cacheRememberContextCache) SetJSON(key string, value interface{}, expiration time.Duration) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.ICache.SetJSON(key, value, expiration)
+}
+
+func TestCache_RememberCancelledCaller(t *testing.T) {
+	memory := NewMemoryCache(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := (&cacheRememberContextCache{ICache: memory}).WithContext(ctx)
+
+	loaded := make(chan struct{})
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		close(loaded)
+		<-release
+		return &cacheRememberTestUser{Name: "john"}, nil
+	}
+
+	remember := newCacheRemember()
+	first := make(chan error)
+	go func() {
+		user := &cacheRememberTestUser{}
+		first <- remember.remember(cache, user, "user:1", time.Minute, loader)
+	}()
+
+	<-loaded
+	waiter := make(chan *cacheRememberTestUser)
+	go func() {
+		user := &cacheRememberTestUser{}
+		_ = remember.remember((&cacheRememberContextCache{ICache: memory}).WithContext(context.Background()), user, "user:1", time.Minute, loader)
+		waiter <- user
+	}()
+
+	// the first caller is cancelled while the shared load is running
+	cancel()
+	close(release)
+
+	assert.NoError(t, <-first)
+	assert.Equal(t, "john", (<-waiter).Name)
+
+	stored := &cacheRememberEntry{}
+	assert.NoError(t, memory.GetJSON(stored, "user:1"))
+	assert.JSONEq(t, `{"name":"john"}`, string(stored.Value))
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewCache_Options(t *testing.T) {
+	options := NewCache(&ENVConfig{CacheHost: "localhost", CachePort: "6379", CachePassword: "secret", CacheDB: 2}).options()
+	assert.Equal(t, []string{"localhost:6379"}, options.Addrs)
+	assert.Equal(t, "secret", options.Password)
+	assert.Equal(t, 2, options.DB)
+	assert.Nil(t, options.TLSConfig)
+
+	options = NewCache(&ENVConfig{
+		CacheHost:       "localhost",
+		CacheAddrs:      "sentinel-1:26379, sentinel-2:26379,",
+		CacheMasterName: "mymaster",
+		CacheTLS:        true,
+	}).options()
+	assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, options.Addrs)
+	assert.Equal(t, "mymaster", options.MasterName)
+	assert.NotNil(t, options.TLSConfig)
+	assert.False(t, options.TLSConfig.InsecureSkipVerify)
+}
+
+// testCacheCommands check the commands of ICache, every implementation must pass it with the same results
+func testCacheCommands(t *testing.T, cache ICache) {
+	assert.NoError(t, cache.Del("core-test:*"))
+
+	assert.NoError(t, cache.MSet(map[string]interface{}{"core-test:a": "1", "core-test:b": "2"}, 0))
+	assert.NoError(t, cache.MSetJSON(map[string]interface{}{"core-test:c": map[string]int{"id": 3}}, time.Minute))
+	values, err := cache.MGet("core-test:a", "core-test:missing", "core-test:b")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1", nil, "2"}, values)
+
+	c := map[string]int{}
+	assert.NoError(t, cache.GetJSON(&c, "core-test:c"))
+	assert.Equal(t, 3, c["id"])
+
+	exists, err := cache.Exists("core-test:a", "core-test:b", "core-test:c", "core-test:missing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), exists)
+
+	ttl, err := cache.TTL("core-test:a")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+	ttl, err = cache.TTL("core-test:c")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 58*time.Second && ttl <= time.Minute, ttl)
+
+	ok, err := cache.Expire("core-test:a", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cache.Expire("core-test:missing", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = cache.SetNXJSON("core-test:c", map[string]int{"id": 4}, 0)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	counter, err := cache.IncrBy("core-test:counter", 5, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	counter, err = cache.DecrBy("core-test:counter", 2, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+	ttl, err = cache.TTL("core-test:counter")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 58*time.Second && ttl <= time.Minute, ttl)
+
+	assert.NoError(t, cache.HSet("core-test:hash", map[string]interface{}{"name": "john", "age": "20"}))
+	assert.NoError(t, cache.HSetJSON("core-test:hash", "address", map[string]string{"city": "bangkok"}))
+	var name string
+	assert.NoError(t, cache.HGet(&name, "core-test:hash", "name"))
+	assert.Equal(t, "john", name)
+	address := map[string]string{}
+	assert.NoError(t, cache.HGetJSON(&address, "core-test:hash", "address"))
+	assert.Equal(t, "bangkok", address["city"])
+	age, err := cache.HIncrBy("core-test:hash", "age", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(21), age)
+	assert.NoError(t, cache.HDel("core-test:hash", "address"))
+	ok, err = cache.HExists("core-test:hash", "address")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	hash, err := cache.HGetAll("core-test:hash")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "john", "age": "21"}, hash)
+
+	length, err := cache.RPushJSON("core-test:list", map[string]int{"id": 1}, map[string]int{"id": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), length)
+	length, err = cache.LPush("core-test:list", "first")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), length)
+	var first string
+	assert.NoError(t, cache.LPop(&first, "core-test:list"))
+	assert.Equal(t, "first", first)
+	last := map[string]int{}
+	assert.NoError(t, cache.RPopJSON(&last, "core-test:list"))
+	assert.Equal(t, 2, last["id"])
+	_, err = cache.RPush("core-test:list", "a", "b")
+	assert.NoError(t, err)
+	assert.NoError(t, cache.LTrim("core-test:list", 1, -1))
+	list, err := cache.LRange("core-test:list", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, list)
+	length, err = cache.LLen("core-test:list")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), length)
+	assert.True(t, errors.Is(cache.LPop(&first, "core-test:missing"), redis.Nil))
+
+	_, err = cache.SAdd("core-test:set", "a", "b", "c")
+	assert.NoError(t, err)
+	removed, err := cache.SRem("core-test:set", "b", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	members, err := cache.SMembers("core-test:set")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "c"}, members)
+	card, err := cache.SCard("core-test:set")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), card)
+
+	_, err = cache.ZAdd("core-test:zset", &redis.Z{Score: 1, Member: "a"}, &redis.Z{Score: 2, Member: "b"})
+	assert.NoError(t, err)
+	score, err := cache.ZIncrBy("core-test:zset", 2, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), score)
+	score, err = cache.ZScore("core-test:zset", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), score)
+	scores, err := cache.ZRangeWithScores("core-test:zset", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []redis.Z{{Score: 2, Member: "b"}, {Score: 3, Member: "a"}}, scores)
+	removed, err = cache.ZRem("core-test:zset", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	card, err = cache.ZCard("core-test:zset")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), card)
+
+	_, err = cache.LPush("core-test:hash", "x")
+	assert.Error(t, err)
+
+	assert.NoError(t, cache.Del("core-test:*"))
+	exists, err = cache.Exists("core-test:a", "core-test:hash", "core-test:list", "core-test:set", "core-test:zset")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+}
+
+func TestMemoryCache_Commands(t *testing.T) {
+	testCacheCommands(t, NewMemoryCache(nil))
+}
+
+// TestCache_Commands run against the Redis of CACHE_TEST_ADDRS, a comma separated list of nodes, with
+// CACHE_TEST_CLUSTER=true for a cluster
+func TestCache_Commands(t *testing.T) {
+	addrs := envList(os.Getenv("CACHE_TEST_ADDRS"))
+	if len(addrs) == 0 {
+		t.Skip("CACHE_TEST_ADDRS is not set")
+	}
+
+	cache, err := (&DatabaseCache{Addrs: addrs, Cluster: os.Getenv("CACHE_TEST_CLUSTER") == "true"}).Connect()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cache.Close()
+
+	testCacheCommands(t, cache)
+}
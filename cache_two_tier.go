@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/pskclub/mine-core/utils"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTwoTierCacheLocalTTL = 5 * time.Second
+	DefaultTwoTierCacheChannel  = "cache:invalidate"
+)
+
+type TwoTierCacheOptions struct {
+	// LocalTTL is how long a value read from the remote cache is served by the local layer, defaults to DefaultTwoTierCacheLocalTTL
+	LocalTTL time.Duration
+	// MaxEntries of the local layer, see MemoryCacheOptions
+	MaxEntries int
+	// Channel publish the written keys to the other replicas, every replica must use the same one, defaults to DefaultTwoTierCacheChannel
+	Channel string
+}
+
+type twoTierCache struct {
+	ICache
+	local       ICache
+	options     TwoTierCacheOptions
+	instanceID  string
+	unsubscribe func() error
+	remember    *cacheRemember
+}
+
+// NewTwoTierCache front remote with a local memory layer, Get and GetJSON are served locally for LocalTTL, or until the
+// key expires on remote when it is sooner. Set, SetJSON, SetNX, SetNXJSON, Del, Expire, Incr, IncrBy, Decr, DecrBy,
+// MSet, MSetJSON and the keys of Eval delete the key locally and publish it on Channel, so the other replicas delete it
+// too. The other writes, e.g. Pipelined, TxPipelined or another client, are only seen once the local value expires
+func NewTwoTierCache(remote ICache, options *TwoTierCacheOptions) (ICache, error) {
+	cacheOptions := TwoTierCacheOptions{}
+	if options != nil {
+		cacheOptions = *options
+	}
+
+	if cacheOptions.LocalTTL <= 0 {
+		cacheOptions.LocalTTL = DefaultTwoTierCacheLocalTTL
+	}
+
+	if cacheOptions.Channel == "" {
+		cacheOptions.Channel = DefaultTwoTierCacheChannel
+	}
+
+	c := &twoTierCache{
+		ICache:     remote,
+		local:      NewMemoryCache(&MemoryCacheOptions{MaxEntries: cacheOptions.MaxEntries}),
+		options:    cacheOptions,
+		instanceID: utils.GetUUID(),
+		remember:   newCacheRemember(),
+	}
+
+	unsubscribe, err := remote.Subscribe(c.onInvalidate, cacheOptions.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	c.unsubscribe = unsubscribe
+	return c, nil
+}
+
+// onInvalidate delete the keys written by another replica, a message is "<instance id>|<key>"
+func (c *twoTierCache) onInvalidate(channel string, payload string) {
+	instanceID, key, ok := strings.Cut(payload, "|")
+	if !ok || instanceID == c.instanceID {
+		return
+	}
+
+	_ = c.local.Del(key)
+}
+
+// invalidate delete keys locally and on the other replicas
+func (c *twoTierCache) invalidate(keys ...string) {
+	for _, key := range keys {
+		_ = c.local.Del(key)
+		_ = c.ICache.Publish(c.options.Channel, c.instanceID+"|"+key)
+	}
+}
+
+// getString return the raw value of key from the local layer, or from the remote cache which is then stored locally
+// for LocalTTL at most, a key expiring sooner on remote is not served locally after it expired there
+func (c *twoTierCache) getString(key string) (string, error) {
+	var value string
+	err := c.local.Get(&value, key)
+	if err == nil {
+		return value, nil
+	}
+
+	err = c.ICache.Get(&value, key)
+	if err != nil {
+		return "", err
+	}
+
+	ttl, err := c.ICache.TTL(key)
+	if err != nil {
+		return value, nil
+	}
+
+	// -1 is a key without expiration, -2 a key expired since it was read
+	if ttl == -1 || ttl > c.options.LocalTTL {
+		ttl = c.options.LocalTTL
+	}
+
+	if ttl > 0 {
+		_ = c.local.Set(key, value, ttl)
+	}
+
+	return value, nil
+}
+
+func (c twoTierCache) WithContext(ctx context.Context) ICache {
+	c.ICache = c.ICache.WithContext(ctx)
+	return &c
+}
+
+func (c *twoTierCache) Close() {
+	if c.unsubscribe != nil {
+		_ = c.unsubscribe()
+	}
+
+	c.ICache.Close()
+}
+
+func (c *twoTierCache) Get(dest interface{}, key string) error {
+	return redis.NewStringResult(c.getString(key)).Scan(dest)
+}
+
+func (c *twoTierCache) GetJSON(dest interface{}, key string) error {
+	str, err := c.getString(key)
+	if err != nil {
+		return err
+	}
+
+	return utils.JSONParse(utils.StringToBytes(str), dest)
+}
+
+func (c *twoTierCache) Set(key string, value interface{}, expiration time.Duration) error {
+	defer c.invalidate(key)
+	return c.ICache.Set(key, value, expiration)
+}
+
+func (c *twoTierCache) SetJSON(key string, value interface{}, expiration time.Duration) error {
+	defer c.invalidate(key)
+	return c.ICache.SetJSON(key, value, expiration)
+}
+
+func (c *twoTierCache) Del(key string) error {
+	defer c.invalidate(key)
+	return c.ICache.Del(key)
+}
+
+func (c *twoTierCache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	defer c.invalidate(key)
+	return c.ICache.SetNX(key, value, expiration)
+}
+
+func (c *twoTierCache) SetNXJSON(key string, value interface{}, expiration time.Duration) (bool, error) {
+	defer c.invalidate(key)
+	return c.ICache.SetNXJSON(key, value, expiration)
+}
+
+func (c *twoTierCache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	defer c.invalidate(keys...)
+	return c.ICache.Eval(script, keys, args...)
+}
+
+func (c *twoTierCache) Expire(key string, expiration time.Duration) (bool, error) {
+	defer c.invalidate(key)
+	return c.ICache.Expire(key, expiration)
+}
+
+func (c *twoTierCache) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	defer c.invalidate(key)
+	return c.ICache.IncrBy(key, value, expiration)
+}
+
+func (c *twoTierCache) Incr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, 1, expiration)
+}
+
+func (c *twoTierCache) Decr(key string, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -1, expiration)
+}
+
+func (c *twoTierCache) DecrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	return c.IncrBy(key, -value, expiration)
+}
+
+func (c *twoTierCache) MSet(values map[string]interface{}, expiration time.Duration) error {
+	defer c.invalidate(twoTierCacheKeys(values)...)
+	return c.ICache.MSet(values, expiration)
+}
+
+func (c *twoTierCache) MSetJSON(values map[string]interface{}, expiration time.Duration) error {
+	defer c.invalidate(twoTierCacheKeys(values)...)
+	return c.ICache.MSetJSON(values, expiration)
+}
+
+func (c *twoTierCache) Remember(dest interface{}, key string, ttl time.Duration, loader func() (interface{}, error), options ...*CacheRememberOptions) error {
+	return c.remember.remember(c, dest, key, ttl, loader, options...)
+}
+
+func (c *twoTierCache) Stats() CacheStats {
+	return c.remember.stats()
+}
+
+func twoTierCacheKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
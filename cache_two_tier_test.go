@@ -0,0 +1,73 @@
+package core
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTwoTierCache_ServeLocally(t *testing.T) {
+	remote := NewMemoryCache(nil)
+	cache, err := NewTwoTierCache(remote, &TwoTierCacheOptions{LocalTTL: time.Minute})
+	assert.NoError(t, err)
+
+	assert.NoError(t, cache.SetJSON("user", map[string]string{"name": "john"}, 0))
+	user := map[string]string{}
+	assert.NoError(t, cache.GetJSON(&user, "user"))
+
+	// a write from another client is not seen until the local ttl is elapsed
+	assert.NoError(t, remote.SetJSON("user", map[string]string{"name": "jane"}, 0))
+	assert.NoError(t, cache.GetJSON(&user, "user"))
+	assert.Equal(t, "john", user["name"])
+
+	var missing string
+	assert.True(t, errors.Is(cache.Get(&missing, "missing"), redis.Nil))
+}
+
+func TestTwoTierCache_RemoteTTL(t *testing.T) {
+	remote := NewMemoryCache(nil)
+	cache, err := NewTwoTierCache(remote, &TwoTierCacheOptions{LocalTTL: time.Minute})
+	assert.NoError(t, err)
+	local := cache.(*twoTierCache).local
+
+	assert.NoError(t, remote.Set("session", "john", 2*time.Second))
+	assert.NoError(t, remote.Set("name", "john", 0))
+	var name string
+	assert.NoError(t, cache.Get(&name, "session"))
+	assert.NoError(t, cache.Get(&name, "name"))
+
+	// the local value expires with the remote key
+	ttl, err := local.TTL("session")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 2*time.Second)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	ttl, err = local.TTL("name")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+}
+
+func TestTwoTierCache_InvalidateReplicas(t *testing.T) {
+	remote := NewMemoryCache(nil)
+	replica1, err := NewTwoTierCache(remote, &TwoTierCacheOptions{LocalTTL: time.Minute})
+	assert.NoError(t, err)
+	replica2, err := NewTwoTierCache(remote, &TwoTierCacheOptions{LocalTTL: time.Minute})
+	assert.NoError(t, err)
+
+	assert.NoError(t, replica1.Set("name", "john", 0))
+	var name string
+	assert.NoError(t, replica2.Get(&name, "name"))
+	assert.Equal(t, "john", name)
+
+	assert.NoError(t, replica1.Set("name", "jane", 0))
+	assert.NoError(t, replica2.Get(&name, "name"))
+	assert.Equal(t, "jane", name)
+
+	assert.NoError(t, replica1.Del("name"))
+	assert.True(t, errors.Is(replica2.Get(&name, "name"), redis.Nil))
+
+	replica2.Close()
+	assert.NoError(t, replica1.Set("name", "jack", 0))
+}
@@ -6,3 +6,4 @@ const HTTP ContextType = "HTTP"
 const E2E ContextType = "E2E"
 const MQ ContextType = "MQ"
 const CRONJOB ContextType = "CRONJOB"
+const JOB ContextType = "JOB"
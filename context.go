@@ -1,11 +1,13 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-errors/errors"
 	"github.com/pskclub/mine-core/consts"
 	"gorm.io/gorm"
+	"sync"
 	"time"
 )
 
@@ -18,6 +20,8 @@ type ContextUser struct {
 	Data     map[string]string `json:"data,omitempty"`
 }
 type IContext interface {
+	StdContext() context.Context
+	SetStdContext(ctx context.Context)
 	MQ() IMQ
 	DB() *gorm.DB
 	DBS(name string) *gorm.DB
@@ -35,6 +39,8 @@ type IContext interface {
 	SetData(name string, data interface{})
 	SetUser(user *ContextUser)
 	GetUser() *ContextUser
+	Transaction(fn func(txCtx IContext) IError) IError
+	AfterCommit(fn func())
 }
 
 type ContextOptions struct {
@@ -48,6 +54,8 @@ type ContextOptions struct {
 	MQ          IMQ
 	contextType consts.ContextType
 	DATA        map[string]interface{}
+	// StdContext is the parent context.Context, defaults to context.Background()
+	StdContext context.Context
 }
 
 func NewContext(options *ContextOptions) IContext {
@@ -62,7 +70,19 @@ func NewContext(options *ContextOptions) IContext {
 		defer sentry.Flush(2 * time.Second)
 	}
 
+	stdCtx := options.StdContext
+	if stdCtx == nil {
+		stdCtx = context.Background()
+	}
+
+	// every context owns a copy of DATA, the options are shared by the contexts of every request
+	data := make(map[string]interface{}, len(options.DATA))
+	for name, value := range options.DATA {
+		data[name] = value
+	}
+
 	return &coreContext{
+		ctx:            stdCtx,
 		database:       options.DB,
 		databases:      options.DBS,
 		contextType:    options.contextType,
@@ -72,11 +92,13 @@ func NewContext(options *ContextOptions) IContext {
 		cache:          options.Cache,
 		caches:         options.Caches,
 		mq:             options.MQ,
-		data:           options.DATA,
+		dataMutex:      &sync.RWMutex{},
+		data:           data,
 	}
 }
 
 type coreContext struct {
+	ctx            context.Context
 	contextType    consts.ContextType
 	database       *gorm.DB
 	databases      map[string]*gorm.DB
@@ -87,8 +109,43 @@ type coreContext struct {
 	mq             IMQ
 	env            IENV
 	logger         ILogger
+	dataMutex      *sync.RWMutex
 	data           map[string]interface{}
 	user           *ContextUser
+	transaction    *contextTransaction
+}
+
+// StdContext return the context.Context bound to this context, every backend call made through it honours its cancellation and deadline
+func (c *coreContext) StdContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+func (c *coreContext) SetStdContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// withContext return a shallow copy of the context that shares connections but is bound to ctx and owns a copy of the data
+func (c *coreContext) withContext(ctx context.Context) *coreContext {
+	newCtx := *c
+	newCtx.ctx = ctx
+	newCtx.logger = nil
+	newCtx.dataMutex = &sync.RWMutex{}
+	newCtx.data = c.GetAllData()
+	return &newCtx
+}
+
+// NewChildContext return a copy of ctx bound to stdCtx, it falls back to SetStdContext when ctx is not created by NewContext
+func NewChildContext(ctx IContext, stdCtx context.Context) IContext {
+	if c, ok := ctx.(*coreContext); ok {
+		return c.withContext(stdCtx)
+	}
+
+	ctx.SetStdContext(stdCtx)
+	return ctx
 }
 
 func (c *coreContext) SetUser(user *ContextUser) {
@@ -99,22 +156,30 @@ func (c *coreContext) GetUser() *ContextUser {
 	return c.user
 }
 
+// GetAllData return a copy of the data, so it can be read while other goroutines keep setting data
 func (c *coreContext) GetAllData() map[string]interface{} {
-	if c.data == nil {
-		c.data = make(map[string]interface{})
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	data := make(map[string]interface{}, len(c.data))
+	for name, value := range c.data {
+		data[name] = value
 	}
 
-	return c.data
+	return data
 }
 
 func (c *coreContext) GetData(name string) interface{} {
-	if c.data == nil {
-		c.data = make(map[string]interface{})
-	}
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
 	return c.data[name]
 }
 
 func (c *coreContext) SetData(name string, data interface{}) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
 	if c.data == nil {
 		c.data = make(map[string]interface{})
 	}
@@ -122,19 +187,27 @@ func (c *coreContext) SetData(name string, data interface{}) {
 }
 
 func (c *coreContext) Cache() ICache {
-	return c.cache
+	if c.cache == nil {
+		return nil
+	}
+
+	return c.cache.WithContext(c.StdContext())
 }
 
 func (c *coreContext) MQ() IMQ {
-	return c.mq
+	if c.mq == nil {
+		return nil
+	}
+
+	return c.mq.WithContext(c.StdContext())
 }
 
 func (c *coreContext) Caches(name string) ICache {
 	cache, ok := c.caches[name]
-	if !ok {
+	if !ok || cache == nil {
 		return nil
 	}
-	return cache
+	return cache.WithContext(c.StdContext())
 }
 
 func (c *coreContext) Requester() IRequester {
@@ -159,27 +232,35 @@ func (c *coreContext) Type() consts.ContextType {
 }
 
 func (c *coreContext) DB() *gorm.DB {
-	return c.database
+	if c.database == nil {
+		return nil
+	}
+
+	return c.database.WithContext(c.StdContext())
 }
 
 func (c *coreContext) DBS(name string) *gorm.DB {
 	db, ok := c.databases[name]
-	if !ok {
+	if !ok || db == nil {
 		return nil
 	}
-	return db
+	return db.WithContext(c.StdContext())
 }
 
 func (c *coreContext) DBMongo() IMongoDB {
-	return c.databaseMongo
+	if c.databaseMongo == nil {
+		return nil
+	}
+
+	return c.databaseMongo.WithContext(c.StdContext())
 }
 
 func (c *coreContext) DBSMongo(name string) IMongoDB {
 	db, ok := c.databasesMongo[name]
-	if !ok {
+	if !ok || db == nil {
 		return nil
 	}
-	return db
+	return db.WithContext(c.StdContext())
 }
 
 func (c *coreContext) NewError(err error, errorType IError, args ...interface{}) IError {
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"github.com/pskclub/mine-core/consts"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
@@ -27,6 +28,15 @@ type ContextMock struct {
 	MockDB        *MockDatabase
 }
 
+func (m *ContextMock) StdContext() context.Context {
+	args := m.Called()
+	return args.Get(0).(context.Context)
+}
+
+func (m *ContextMock) SetStdContext(ctx context.Context) {
+	m.Called(ctx)
+}
+
 func (m *ContextMock) Cache() ICache {
 	args := m.Called()
 	return args.Get(0).(ICache)
@@ -96,3 +106,12 @@ func (m *ContextMock) ENV() IENV {
 	args := m.Called()
 	return args.Get(0).(IENV)
 }
+
+func (m *ContextMock) Transaction(fn func(txCtx IContext) IError) IError {
+	args := m.Called(fn)
+	return MockIError(args, 0)
+}
+
+func (m *ContextMock) AfterCommit(fn func()) {
+	m.Called(fn)
+}
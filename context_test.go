@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// newTestENV mock the ENV of a test context, config defaults to an empty ENVConfig. A context logging an error also
+// reads IsDev and All
+func newTestENV(config *ENVConfig) *mockENV {
+	if config == nil {
+		config = &ENVConfig{}
+	}
+
+	env := NewMockENV()
+	env.On("Config").Return(config)
+	env.On("IsDev").Return(false)
+	env.On("All").Return(map[string]string{})
+	return env
+}
+
+// newTestContext create a context with options, ENV defaults to newTestENV
+func newTestContext(options *ContextOptions) IContext {
+	if options == nil {
+		options = &ContextOptions{}
+	}
+
+	if options.ENV == nil {
+		options.ENV = newTestENV(nil)
+	}
+
+	return NewContext(options)
+}
+
+func TestNewContext_DefaultStdContext(t *testing.T) {
+	ctx := newTestContext(nil)
+	assert.Equal(t, context.Background(), ctx.StdContext())
+}
+
+func TestNewChildContext_BindStdContext(t *testing.T) {
+	cache := NewMockCache()
+	mq := NewMockMQ()
+	parent := newTestContext(&ContextOptions{Cache: cache, MQ: mq})
+
+	stdCtx, cancel := context.WithCancel(context.Background())
+	child := NewChildContext(parent, stdCtx)
+	cancel()
+	cache.On("WithContext", stdCtx).Return(cache)
+	mq.On("WithContext", stdCtx).Return(mq)
+
+	assert.Equal(t, stdCtx, child.StdContext())
+	assert.Equal(t, context.Background(), parent.StdContext())
+	assert.Equal(t, context.Canceled, child.StdContext().Err())
+	assert.Equal(t, cache, child.Cache())
+	assert.Equal(t, mq, child.MQ())
+	cache.AssertCalled(t, "WithContext", stdCtx)
+	mq.AssertCalled(t, "WithContext", stdCtx)
+}
+
+func TestNewChildContext_IsolateData(t *testing.T) {
+	parent := newTestContext(nil)
+	parent.SetData("service", "orders")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := NewChildContext(parent, context.Background())
+			child.SetData("message", i)
+			child.SetUser(&ContextUser{ID: "user"})
+
+			assert.Equal(t, "orders", child.GetData("service"))
+			assert.Equal(t, i, child.GetData("message"))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Nil(t, parent.GetData("message"))
+	assert.Nil(t, parent.GetUser())
+}
+
+func TestNewContext_CopyData(t *testing.T) {
+	options := &ContextOptions{ENV: newTestENV(nil), DATA: map[string]interface{}{"service": "orders"}}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := NewContext(options)
+			ctx.SetData("message", i)
+
+			assert.Equal(t, "orders", ctx.GetData("service"))
+			assert.Equal(t, i, ctx.GetData("message"))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]interface{}{"service": "orders"}, options.DATA)
+}
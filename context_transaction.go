@@ -0,0 +1,106 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"sync"
+)
+
+var TransactionError = Error{
+	Status:  http.StatusInternalServerError,
+	Code:    "DATABASE_ERROR",
+	Message: "database internal error"}
+
+// contextTransaction collect the after-commit hooks of a transaction, a savepoint has its parent transaction
+type contextTransaction struct {
+	parent *contextTransaction
+	mutex  sync.Mutex
+	hooks  []func()
+}
+
+func (t *contextTransaction) add(hooks ...func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.hooks = append(t.hooks, hooks...)
+}
+
+// commit run the hooks once the outermost transaction is committed, the hooks of a savepoint are handed to its parent
+func (t *contextTransaction) commit(ctx IContext) {
+	t.mutex.Lock()
+	hooks := t.hooks
+	t.hooks = nil
+	t.mutex.Unlock()
+
+	if t.parent != nil {
+		t.parent.add(hooks...)
+		return
+	}
+
+	for _, hook := range hooks {
+		runAfterCommitHook(ctx, hook)
+	}
+}
+
+// runAfterCommitHook run hook, a panic is reported so the next hooks still run
+func runAfterCommitHook(ctx IContext, hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			ctx.NewError(err, TransactionError, "after commit hook panicked")
+		}
+	}()
+
+	hook()
+}
+
+// Transaction run fn in a transaction of DB(), txCtx.DB() is the transaction so every repository created with txCtx takes part in it.
+// The transaction is committed when fn returns nil and rolled back when fn returns an error or panics, the panic is not recovered.
+// Calling Transaction on txCtx creates a savepoint, DBS(name) is not part of the transaction
+func (c *coreContext) Transaction(fn func(txCtx IContext) IError) IError {
+	db := c.DB()
+	if db == nil {
+		return c.NewError(errors.New("database is not configured"), TransactionError)
+	}
+
+	transaction := &contextTransaction{parent: c.transaction}
+	txCtx := c.withContext(c.StdContext())
+	txCtx.transaction = transaction
+
+	var ierr IError
+	err := db.Transaction(func(tx *gorm.DB) error {
+		txCtx.database = tx
+		ierr = fn(txCtx)
+		if ierr != nil {
+			return ierr
+		}
+
+		return nil
+	})
+	if ierr != nil {
+		return ierr
+	}
+
+	if err != nil {
+		return c.NewError(err, TransactionError)
+	}
+
+	transaction.commit(c)
+	return nil
+}
+
+// AfterCommit run fn once the transaction of the context is committed, it is discarded when the transaction is rolled back.
+// fn runs right away when the context is not in a transaction
+func (c *coreContext) AfterCommit(fn func()) {
+	if c.transaction == nil {
+		runAfterCommitHook(c, fn)
+		return
+	}
+
+	c.transaction.add(fn)
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+func newTransactionTestContext() (IContext, *MockDatabase) {
+	db := NewMockDatabase()
+	return newTestContext(&ContextOptions{DB: db.Gorm}), db
+}
+
+func TestContext_TransactionCommit(t *testing.T) {
+	ctx, db := newTransactionTestContext()
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectCommit()
+
+	committed := false
+	ierr := ctx.Transaction(func(txCtx IContext) IError {
+		assert.NotEqual(t, ctx.DB().Statement.ConnPool, txCtx.DB().Statement.ConnPool)
+		txCtx.AfterCommit(func() {
+			committed = true
+		})
+		assert.False(t, committed)
+		return nil
+	})
+
+	assert.NoError(t, ierr)
+	assert.True(t, committed)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestContext_TransactionRollback(t *testing.T) {
+	ctx, db := newTransactionTestContext()
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectRollback()
+
+	notFound := Error{Status: http.StatusNotFound, Code: "NOT_FOUND", Message: "not found"}
+	committed := false
+	ierr := ctx.Transaction(func(txCtx IContext) IError {
+		txCtx.AfterCommit(func() {
+			committed = true
+		})
+		return notFound
+	})
+
+	assert.Equal(t, notFound, ierr)
+	assert.False(t, committed)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestContext_TransactionPanic(t *testing.T) {
+	ctx, db := newTransactionTestContext()
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectRollback()
+
+	assert.Panics(t, func() {
+		_ = ctx.Transaction(func(txCtx IContext) IError {
+			panic("boom")
+		})
+	})
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestContext_TransactionSavepoint(t *testing.T) {
+	ctx, db := newTransactionTestContext()
+	db.Mock.ExpectBegin()
+	// gorm names a savepoint after the pointer of its function, so only its prefix is stable
+	db.Mock.ExpectExec(`^SAVEPOINT gorm_\d+$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectExec(`^ROLLBACK TO SAVEPOINT gorm_\d+$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectExec(`^SAVEPOINT gorm_\d+$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectCommit()
+
+	hooks := make([]string, 0)
+	ierr := ctx.Transaction(func(txCtx IContext) IError {
+		txCtx.AfterCommit(func() {
+			hooks = append(hooks, "outer")
+		})
+
+		ierr := txCtx.Transaction(func(savepointCtx IContext) IError {
+			savepointCtx.AfterCommit(func() {
+				hooks = append(hooks, "rolled back")
+			})
+			return Error{Status: http.StatusBadRequest, Code: "INVALID", Message: "invalid"}
+		})
+		assert.Error(t, ierr)
+
+		return txCtx.Transaction(func(savepointCtx IContext) IError {
+			savepointCtx.AfterCommit(func() {
+				hooks = append(hooks, "inner")
+			})
+			return nil
+		})
+	})
+
+	assert.NoError(t, ierr)
+	assert.Equal(t, []string{"outer", "inner"}, hooks)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestContext_AfterCommitOutsideTransaction(t *testing.T) {
+	ctx, _ := newTransactionTestContext()
+
+	called := false
+	ctx.AfterCommit(func() {
+		called = true
+	})
+	assert.True(t, called)
+
+	logger := NewMockLogger()
+	logger.On("ErrorWithSkip", mock.Anything, mock.Anything, mock.Anything).Return()
+	ctx.(*coreContext).logger = logger
+
+	next := false
+	assert.NotPanics(t, func() {
+		ctx.AfterCommit(func() {
+			panic(errors.New("boom"))
+		})
+		ctx.AfterCommit(func() {
+			next = true
+		})
+	})
+	assert.True(t, next)
+	logger.AssertNumberOfCalls(t, "ErrorWithSkip", 1)
+	logger.AssertCalled(t, "ErrorWithSkip", mock.Anything, mock.MatchedBy(func(err error) bool {
+		return err.Error() == "boom"
+	}), mock.Anything)
+}
@@ -1,12 +1,21 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron"
+	"github.com/labstack/echo/v4"
 	"github.com/pskclub/mine-core/consts"
+	"github.com/pskclub/mine-core/utils"
 )
 
 var cronjobError = Error{
@@ -18,38 +27,433 @@ type ICronjobContext interface {
 	IContext
 	Job() *gocron.Scheduler
 	Start()
-	AddJob(job *gocron.Scheduler, handlerFunc func(ctx ICronjobContext) error)
+	AddJob(job *gocron.Scheduler, handlerFunc func(ctx ICronjobContext) error, options ...*CronjobJobOptions)
+	Register(name string, handlerFunc func(ctx ICronjobContext) error, options ...*CronjobJobOptions)
+	Trigger(name string) (*CronjobRun, IError)
+	Jobs() []CronjobJobInfo
+	History() ICronjobHistory
+}
+
+const (
+	// CronjobOverlapAllow start a run even if the previous one is still running
+	CronjobOverlapAllow = "allow"
+	// CronjobOverlapSkip skip a run while the previous one is still running, it is recorded as skipped
+	CronjobOverlapSkip = "skip"
+	// CronjobOverlapQueue wait for the previous run to finish before starting
+	CronjobOverlapQueue = "queue"
+)
+
+const (
+	DefaultCronjobLockTTL    = time.Minute
+	DefaultCronjobRetryDelay = 10 * time.Second
+	// DefaultCronjobLockMargin is released before the next tick, so the instance holding the lock can run it too
+	DefaultCronjobLockMargin = time.Second
+)
+
+// ErrCronjobLockName is returned by AddJob for a job with a Locker and no Name, the name of a function is not
+// stable enough to be a lock key
+var ErrCronjobLockName = errors.New("cronjob: a job with a Locker must have a Name")
+
+type CronjobJobOptions struct {
+	// Name identify the job in the logs, the history and the lock key, defaults to the name of the handler function.
+	// It is required with a Locker
+	Name string
+	// Locker make a single instance run the job per tick, the other instances skip the run while the lock is held
+	Locker ILocker
+	// LockTTL is the expiration of the lock, it is refreshed every LockTTL/3 while the job runs, defaults to DefaultCronjobLockTTL
+	LockTTL time.Duration
+	// LockMinHold keep the lock at least this long after the run started, so an instance whose clock is late skips the same tick.
+	// It defaults to the time left before the next tick, up to LockTTL, minus DefaultCronjobLockMargin, a negative value
+	// release the lock as soon as the run ends
+	LockMinHold time.Duration
+	// Timeout cancel ctx.StdContext() of the run, retries included, the handler must return once it is done
+	Timeout time.Duration
+	// Overlap is one of CronjobOverlapAllow, CronjobOverlapSkip or CronjobOverlapQueue, defaults to CronjobOverlapAllow
+	Overlap string
+	// Retries is the number of times a failed run is retried
+	Retries int
+	// RetryDelay is the wait between two attempts, defaults to DefaultCronjobRetryDelay
+	RetryDelay time.Duration
+	// Schedule is used by Register when CRON_<NAME>_SCHEDULE is not set
+	Schedule string
+	// TimeZone is used by Register when CRON_<NAME>_TIMEZONE is not set, defaults to CronjobContextOptions.TimeLocation
+	TimeZone string
+}
+
+type cronjobJob struct {
+	handler  func(ctx ICronjobContext) error
+	options  *CronjobJobOptions
+	job      *gocron.Job
+	disabled bool
+	running  int32
+	queue    sync.Mutex
+}
+
+type cronjobRegistry struct {
+	mutex sync.RWMutex
+	jobs  []*cronjobJob
 }
 
 type CronjobContext struct {
 	IContext
-	cron *gocron.Scheduler
+	cron      *gocron.Scheduler
+	lifecycle ILifecycle
+	health    IHealth
+	history   ICronjobHistory
+	registry  *cronjobRegistry
 }
 
-func (c CronjobContext) AddJob(job *gocron.Scheduler, handlerFunc func(ctx ICronjobContext) error) {
-	_, err := job.Do(func() {
+func (c CronjobContext) AddJob(job *gocron.Scheduler, handlerFunc func(ctx ICronjobContext) error, options ...*CronjobJobOptions) {
+	if len(options) > 0 && options[0] != nil && options[0].Locker != nil && options[0].Name == "" {
+		c.NewError(ErrCronjobLockName, cronjobError)
+		return
+	}
+
+	entry := newCronjobJob(handlerFunc, options...)
+	err := c.schedule(job, entry)
+	if err != nil {
+		c.NewError(err, cronjobError)
+		return
+	}
+
+	c.addJob(entry)
+}
+
+// newCronjobJob copy options and set their defaults
+func newCronjobJob(handlerFunc func(ctx ICronjobContext) error, options ...*CronjobJobOptions) *cronjobJob {
+	jobOptions := &CronjobJobOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*jobOptions = *options[0]
+	}
+
+	if jobOptions.Name == "" {
+		jobOptions.Name = runtime.FuncForPC(reflect.ValueOf(handlerFunc).Pointer()).Name()
+	}
+
+	if jobOptions.LockTTL <= 0 {
+		jobOptions.LockTTL = DefaultCronjobLockTTL
+	}
+
+	if jobOptions.Overlap == "" {
+		jobOptions.Overlap = CronjobOverlapAllow
+	}
+
+	if jobOptions.RetryDelay <= 0 {
+		jobOptions.RetryDelay = DefaultCronjobRetryDelay
+	}
+
+	return &cronjobJob{handler: handlerFunc, options: jobOptions}
+}
+
+func (c CronjobContext) schedule(job *gocron.Scheduler, entry *cronjobJob) error {
+	scheduled, err := job.Do(func() {
+		c.run(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.registry.mutex.Lock()
+	entry.job = scheduled
+	c.registry.mutex.Unlock()
+	return nil
+}
+
+func (c CronjobContext) addJob(entry *cronjobJob) {
+	c.registry.mutex.Lock()
+	defer c.registry.mutex.Unlock()
+
+	c.registry.jobs = append(c.registry.jobs, entry)
+}
+
+// findJob return the job named name, or nil when no job has this name
+func (c CronjobContext) findJob(name string) *cronjobJob {
+	c.registry.mutex.RLock()
+	defer c.registry.mutex.RUnlock()
+
+	for _, entry := range c.registry.jobs {
+		if entry.options.Name == name {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// Jobs return the jobs added by AddJob with their last and next run times
+func (c CronjobContext) Jobs() []CronjobJobInfo {
+	c.registry.mutex.RLock()
+	defer c.registry.mutex.RUnlock()
+
+	jobs := make([]CronjobJobInfo, 0, len(c.registry.jobs))
+	for _, entry := range c.registry.jobs {
+		info := CronjobJobInfo{
+			Name:     entry.options.Name,
+			Schedule: entry.options.Schedule,
+			Disabled: entry.disabled,
+			Overlap:  entry.options.Overlap,
+			Timeout:  entry.options.Timeout,
+			Retries:  entry.options.Retries,
+			Running:  atomic.LoadInt32(&entry.running),
+		}
+
+		if entry.job == nil {
+			jobs = append(jobs, info)
+			continue
+		}
+
+		if lastRun := entry.job.LastRun(); !lastRun.IsZero() {
+			info.LastRun = &lastRun
+		}
+
+		if nextRun := entry.job.NextRun(); !nextRun.IsZero() {
+			info.NextRun = &nextRun
+		}
+
+		jobs = append(jobs, info)
+	}
+
+	return jobs
+}
+
+func (c CronjobContext) History() ICronjobHistory {
+	return c.history
+}
+
+// run call the handler of job with the overlap, lock, timeout and retry options of job, it returns the recorded run
+func (c CronjobContext) run(job *cronjobJob) *CronjobRun {
+	options := job.options
+	if options.Overlap == CronjobOverlapQueue {
+		// a queued run starts its clock and its timeout once the previous run is finished
+		job.queue.Lock()
+		defer job.queue.Unlock()
+	}
+
+	var stdCtx context.Context
+	var cancel context.CancelFunc
+	if options.Timeout > 0 {
+		stdCtx, cancel = context.WithTimeout(c.StdContext(), options.Timeout)
+	} else {
+		stdCtx, cancel = context.WithCancel(c.StdContext())
+	}
+	defer cancel()
+
+	// every run owns its data, user, request id and logger, so concurrent runs do not leak into each other
+	runCtx := &CronjobContext{IContext: NewChildContext(c.IContext, stdCtx), cron: c.cron, lifecycle: c.lifecycle, health: c.health, history: c.history, registry: c.registry}
+	runCtx.SetData(echo.HeaderXRequestID, utils.GetUUID())
+
+	run := &CronjobRun{
+		ID:        utils.GetUUID(),
+		Name:      options.Name,
+		RequestID: runCtx.GetData(echo.HeaderXRequestID).(string),
+		StartedAt: time.Now(),
+	}
+
+	running := atomic.AddInt32(&job.running, 1)
+	defer atomic.AddInt32(&job.running, -1)
+	if options.Overlap == CronjobOverlapSkip && running > 1 {
+		runCtx.Log().Info(fmt.Sprintf("Cronjob '%s' skipped, the previous run is still running", options.Name))
+		run.Status = CronjobRunStatusSkipped
+		c.saveRun(runCtx, run)
+		return run
+	}
+
+	if options.Locker != nil {
+		key := fmt.Sprintf("cronjob:%s:%s", c.ENV().Config().Service, options.Name)
+		lock, err := options.Locker.TryLock(stdCtx, key, options.LockTTL)
+		if err != nil {
+			run.Status = CronjobRunStatusFailed
+			run.Error = err.Error()
+			runCtx.NewError(err, cronjobError)
+			c.saveRun(runCtx, run)
+			return run
+		}
+
+		if lock == nil {
+			runCtx.Log().Info(fmt.Sprintf("Cronjob '%s' skipped, the lock is held by another instance", options.Name))
+			run.Status = CronjobRunStatusSkipped
+			c.saveRun(runCtx, run)
+			return run
+		}
+
+		start := time.Now()
+		stopRefresh := c.refreshLock(runCtx, lock, options, cancel)
 		defer func() {
-			if err := recover(); err != nil {
-				err, ok := err.(error)
-				if !ok {
-					err = fmt.Errorf("%v", err)
+			stopRefresh()
+			c.releaseLock(runCtx, lock, c.lockHold(job, start))
+		}()
+	}
+
+	var err error
+	for run.Attempts = 1; ; run.Attempts++ {
+		err = c.attempt(runCtx, job.handler)
+		if err == nil || run.Attempts > options.Retries || stdCtx.Err() != nil {
+			break
+		}
+
+		runCtx.NewError(err, cronjobError, fmt.Sprintf("Cronjob '%s' failed, attempt %d of %d", options.Name, run.Attempts, options.Retries+1))
+		select {
+		case <-time.After(options.RetryDelay):
+		case <-stdCtx.Done():
+		}
+	}
+
+	switch {
+	case errors.Is(stdCtx.Err(), context.DeadlineExceeded):
+		run.Status = CronjobRunStatusTimeout
+		if err == nil {
+			err = stdCtx.Err()
+		}
+	case err != nil:
+		run.Status = CronjobRunStatusFailed
+	default:
+		run.Status = CronjobRunStatusSuccess
+	}
+
+	if err != nil {
+		run.Error = err.Error()
+		runCtx.NewError(err, cronjobError)
+	}
+
+	c.saveRun(runCtx, run)
+	return run
+}
+
+// attempt call handlerFunc once, a panic is returned as an error
+func (c CronjobContext) attempt(runCtx ICronjobContext, handlerFunc func(ctx ICronjobContext) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			err, ok = r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	return handlerFunc(runCtx)
+}
+
+// saveRun record run in the history when it is set
+func (c CronjobContext) saveRun(runCtx ICronjobContext, run *CronjobRun) {
+	if c.history == nil {
+		return
+	}
+
+	run.FinishedAt = time.Now()
+	run.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	err := c.history.Save(context.Background(), run)
+	if err != nil {
+		runCtx.NewError(err, cronjobError)
+	}
+}
+
+// refreshLock extend the lock while the job runs, the run is cancelled when the lock is lost
+func (c CronjobContext) refreshLock(runCtx ICronjobContext, lock ILock, options *CronjobJobOptions, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(options.LockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lock.Refresh(runCtx.StdContext(), options.LockTTL); err != nil {
+					runCtx.NewError(err, cronjobError, fmt.Sprintf("Cronjob '%s' lost its lock", options.Name))
+					cancel()
+					return
 				}
-				c.NewError(err, cronjobError)
 			}
-		}()
+		}
+	}()
 
-		err := handlerFunc(c)
-		if err != nil {
-			c.NewError(err, cronjobError)
+	return func() {
+		close(done)
+	}
+}
+
+// lockHold return how long the lock is kept after the run of job started at start
+func (c CronjobContext) lockHold(job *cronjobJob, start time.Time) time.Duration {
+	if job.options.LockMinHold != 0 {
+		return job.options.LockMinHold - time.Since(start)
+	}
+
+	if c.registry == nil {
+		return 0
+	}
+
+	c.registry.mutex.RLock()
+	scheduled := job.job
+	c.registry.mutex.RUnlock()
+	if scheduled == nil {
+		return 0
+	}
+
+	hold := time.Until(scheduled.NextRun())
+	if hold > job.options.LockTTL {
+		hold = job.options.LockTTL
+	}
+
+	return hold - DefaultCronjobLockMargin
+}
+
+// releaseLock unlock now, or once hold is elapsed when it is positive, the lock is extended for hold so it does not
+// expire before
+func (c CronjobContext) releaseLock(runCtx ICronjobContext, lock ILock, hold time.Duration) {
+	unlock := func() {
+		err := lock.Unlock(context.Background())
+		if err != nil && !errors.Is(err, ErrLockNotHeld) {
+			runCtx.NewError(err, cronjobError)
 		}
-	})
+	}
+
+	if hold <= 0 {
+		unlock()
+		return
+	}
+
+	err := lock.Refresh(context.Background(), hold)
 	if err != nil {
-		c.NewError(err, cronjobError)
+		runCtx.NewError(err, cronjobError)
 	}
+
+	time.AfterFunc(hold, unlock)
 }
 
 func (c CronjobContext) Start() {
-	c.cron.StartBlocking()
+	if name := cronjobRunArg(os.Args[1:]); name != "" {
+		c.runOnce(name)
+		return
+	}
+
+	if c.health != nil && c.ENV().Config().HealthHost != "" {
+		StartHealthServer(c.ENV().Config().HealthHost, c.health, c.lifecycle)
+	}
+
+	if c.lifecycle == nil {
+		c.cron.StartBlocking()
+		return
+	}
+
+	// Stop waits for the running jobs, so no new job is started and the in-flight ones are drained
+	c.lifecycle.AddService("cronjob", func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			c.cron.Stop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	c.cron.StartAsync()
+	_ = c.lifecycle.Wait()
 }
 
 func (c CronjobContext) Job() *gocron.Scheduler {
@@ -59,6 +463,11 @@ func (c CronjobContext) Job() *gocron.Scheduler {
 type CronjobContextOptions struct {
 	ContextOptions *ContextOptions
 	TimeLocation   *time.Location
+	Lifecycle      ILifecycle
+	// Health is served on ENVConfig.HealthHost by a side listener when both are set
+	Health IHealth
+	// History record every run of the jobs when it is set
+	History ICronjobHistory
 }
 
 func NewCronjobContext(options *CronjobContextOptions) ICronjobContext {
@@ -71,5 +480,12 @@ func NewCronjobContext(options *CronjobContextOptions) ICronjobContext {
 	cron := gocron.NewScheduler(options.TimeLocation)
 
 	fmt.Println(fmt.Sprintf("Cronjob Service: %s", options.ContextOptions.ENV.Config().Service))
-	return &CronjobContext{IContext: NewContext(ctxOptions), cron: cron}
+	return &CronjobContext{
+		IContext:  NewContext(ctxOptions),
+		cron:      cron,
+		lifecycle: options.Lifecycle,
+		health:    options.Health,
+		history:   options.History,
+		registry:  &cronjobRegistry{},
+	}
 }
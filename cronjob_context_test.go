@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/go-co-op/gocron"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryCronjobHistory struct {
+	mutex sync.Mutex
+	runs  []CronjobRun
+}
+
+func (h *memoryCronjobHistory) Save(ctx context.Context, run *CronjobRun) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.runs = append([]CronjobRun{*run}, h.runs...)
+	return nil
+}
+
+func (h *memoryCronjobHistory) List(ctx context.Context, name string, limit int) ([]CronjobRun, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	runs := make([]CronjobRun, 0)
+	for _, run := range h.runs {
+		if (name == "" || run.Name == name) && len(runs) < limit {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
+
+func newCronjobTestContext(history ICronjobHistory) *CronjobContext {
+	return &CronjobContext{
+		IContext: newTestContext(&ContextOptions{ENV: newTestENV(&ENVConfig{Service: "orders"})}),
+		cron:     gocron.NewScheduler(time.UTC),
+		history:  history,
+		registry: &cronjobRegistry{},
+	}
+}
+
+func TestCronjobContext_RunRetry(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+
+	calls := 0
+	handler := func(ctx ICronjobContext) error {
+		calls++
+		if calls < 2 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+
+	c.run(&cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Retries: 2, RetryDelay: time.Millisecond, Overlap: CronjobOverlapAllow}})
+	assert.Equal(t, 2, calls)
+	assert.Len(t, history.runs, 1)
+	assert.Equal(t, CronjobRunStatusSuccess, history.runs[0].Status)
+	assert.Equal(t, 2, history.runs[0].Attempts)
+	assert.NotEmpty(t, history.runs[0].RequestID)
+}
+
+func TestCronjobContext_RunTimeout(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+
+	handler := func(ctx ICronjobContext) error {
+		<-ctx.StdContext().Done()
+		return ctx.StdContext().Err()
+	}
+
+	c.run(&cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Timeout: 10 * time.Millisecond, Retries: 3, RetryDelay: time.Millisecond}})
+	assert.Len(t, history.runs, 1)
+	assert.Equal(t, CronjobRunStatusTimeout, history.runs[0].Status)
+	assert.Equal(t, 1, history.runs[0].Attempts)
+	assert.Equal(t, context.DeadlineExceeded.Error(), history.runs[0].Error)
+}
+
+func TestCronjobContext_RunOverlapSkip(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(ctx ICronjobContext) error {
+		close(started)
+		<-release
+		return nil
+	}
+
+	job := &cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Overlap: CronjobOverlapSkip}}
+	done := make(chan struct{})
+	go func() {
+		c.run(job)
+		close(done)
+	}()
+
+	<-started
+	c.run(job)
+	close(release)
+	<-done
+
+	assert.Len(t, history.runs, 2)
+	assert.Equal(t, CronjobRunStatusSuccess, history.runs[0].Status)
+	assert.Equal(t, CronjobRunStatusSkipped, history.runs[1].Status)
+}
+
+func TestCronjobContext_RunOverlapQueue(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := int32(0)
+	handler := func(ctx ICronjobContext) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	}
+
+	job := &cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Overlap: CronjobOverlapQueue, Timeout: 50 * time.Millisecond}}
+	first := make(chan *CronjobRun)
+	go func() {
+		first <- c.run(job)
+	}()
+
+	<-started
+	queued := make(chan *CronjobRun)
+	go func() {
+		queued <- c.run(job)
+	}()
+
+	// the queued run waits longer than its timeout, which only starts once the first run is finished
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	firstRun := <-first
+	run := <-queued
+
+	assert.Equal(t, CronjobRunStatusSuccess, run.Status)
+	assert.False(t, run.StartedAt.Before(firstRun.FinishedAt))
+	assert.Less(t, run.DurationMS, int64(50))
+}
+
+func TestCronjobAdminHandler(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+	c.AddJob(c.Job().Every(1).Hour(), func(ctx ICronjobContext) error {
+		return nil
+	}, &CronjobJobOptions{Name: "sync"})
+	_ = history.Save(context.Background(), &CronjobRun{Name: "sync", Status: CronjobRunStatusFailed})
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	err := CronjobAdminHandler(c)(e.NewContext(httptest.NewRequest(http.MethodGet, "/cronjobs", nil), rec))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"sync"`)
+	assert.Contains(t, rec.Body.String(), `"status":"failed"`)
+	assert.Contains(t, rec.Body.String(), `"overlap":"allow"`)
+}
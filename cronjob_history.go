@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	CronjobRunStatusSuccess = "success"
+	CronjobRunStatusFailed  = "failed"
+	CronjobRunStatusTimeout = "timeout"
+	CronjobRunStatusSkipped = "skipped"
+)
+
+const DefaultCronjobHistoryLimit = 20
+
+// CronjobRun is a run of a job recorded by ICronjobHistory
+type CronjobRun struct {
+	ID         string    `json:"id" gorm:"column:id;primaryKey;size:36" bson:"_id"`
+	Name       string    `json:"name" gorm:"column:name;size:255;index:idx_cronjob_runs_name_started_at" bson:"name"`
+	RequestID  string    `json:"request_id" gorm:"column:request_id;size:36" bson:"request_id"`
+	Status     string    `json:"status" gorm:"column:status;size:20" bson:"status"`
+	Attempts   int       `json:"attempts" gorm:"column:attempts" bson:"attempts"`
+	Error      string    `json:"error,omitempty" gorm:"column:error;type:text" bson:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at" gorm:"column:started_at;index:idx_cronjob_runs_name_started_at" bson:"started_at"`
+	FinishedAt time.Time `json:"finished_at" gorm:"column:finished_at" bson:"finished_at"`
+	DurationMS int64     `json:"duration_ms" gorm:"column:duration_ms" bson:"duration_ms"`
+}
+
+func (CronjobRun) TableName() string {
+	return "cronjob_runs"
+}
+
+type ICronjobHistory interface {
+	Save(ctx context.Context, run *CronjobRun) error
+	// List return the latest runs first, every job is listed when name is empty
+	List(ctx context.Context, name string, limit int) ([]CronjobRun, error)
+}
+
+type dbCronjobHistory struct {
+	db *gorm.DB
+}
+
+// NewDBCronjobHistory record the runs in the cronjob_runs table
+func NewDBCronjobHistory(db *gorm.DB) ICronjobHistory {
+	return &dbCronjobHistory{db: db}
+}
+
+// MigrateCronjobHistory create the table of NewDBCronjobHistory
+func MigrateCronjobHistory(db *gorm.DB) error {
+	return db.AutoMigrate(&CronjobRun{})
+}
+
+func (h dbCronjobHistory) Save(ctx context.Context, run *CronjobRun) error {
+	return h.db.WithContext(ctx).Create(run).Error
+}
+
+func (h dbCronjobHistory) List(ctx context.Context, name string, limit int) ([]CronjobRun, error) {
+	runs := make([]CronjobRun, 0)
+	db := h.db.WithContext(ctx)
+	if name != "" {
+		db = db.Where("name = ?", name)
+	}
+
+	err := db.Order("started_at DESC").Limit(limit).Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+type mongoCronjobHistory struct {
+	db   IMongoDB
+	coll string
+}
+
+// NewMongoCronjobHistory record the runs in the collection coll
+func NewMongoCronjobHistory(db IMongoDB, coll string) ICronjobHistory {
+	return &mongoCronjobHistory{db: db, coll: coll}
+}
+
+func (h mongoCronjobHistory) Save(ctx context.Context, run *CronjobRun) error {
+	_, err := h.db.WithContext(ctx).Create(h.coll, run)
+	return err
+}
+
+func (h mongoCronjobHistory) List(ctx context.Context, name string, limit int) ([]CronjobRun, error) {
+	filter := bson.M{}
+	if name != "" {
+		filter["name"] = name
+	}
+
+	runs := make([]CronjobRun, 0)
+	err := h.db.WithContext(ctx).Find(&runs, h.coll, filter, options.Find().
+		SetSort(bson.D{{Key: "started_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// CronjobJobInfo is the state of a job added by AddJob
+type CronjobJobInfo struct {
+	Name     string        `json:"name"`
+	Schedule string        `json:"schedule,omitempty"`
+	Disabled bool          `json:"disabled"`
+	Overlap  string        `json:"overlap"`
+	Timeout  time.Duration `json:"timeout"`
+	Retries  int           `json:"retries"`
+	Running  int32         `json:"running"`
+	LastRun  *time.Time    `json:"last_run"`
+	NextRun  *time.Time    `json:"next_run"`
+	History  []CronjobRun  `json:"history,omitempty"`
+}
+
+// CronjobAdminHandler list the jobs of ctx with their next run time and their recent runs,
+// the number of runs per job is set by the limit query param
+func CronjobAdminHandler(ctx ICronjobContext) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if limit <= 0 {
+			limit = DefaultCronjobHistoryLimit
+		}
+
+		jobs := ctx.Jobs()
+		history := ctx.History()
+		if history != nil {
+			for i := range jobs {
+				runs, err := history.List(c.Request().Context(), jobs[i].Name, limit)
+				if err != nil {
+					ierr := ctx.NewError(err, cronjobError)
+					return c.JSON(ierr.GetStatus(), ierr.JSON())
+				}
+
+				jobs[i].History = runs
+			}
+		}
+
+		return c.JSON(http.StatusOK, jobs)
+	}
+}
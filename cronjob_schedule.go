@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"github.com/go-co-op/gocron"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CronjobRunFlag is the command line flag running a registered job once instead of starting the scheduler,
+// e.g. `./app --cronjob-run=sync_orders`
+const CronjobRunFlag = "cronjob-run"
+
+var CronjobNotFoundError = Error{
+	Status:  http.StatusNotFound,
+	Code:    "CRONJOB_NOT_FOUND",
+	Message: "cronjob not found"}
+
+var cronjobEnvKeyReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// cronjobEnvKey return the CRON_<NAME>_<suffix> key of the job name
+func cronjobEnvKey(name string, suffix string) string {
+	return fmt.Sprintf("CRON_%s_%s", cronjobEnvKeyReplacer.ReplaceAllString(strings.ToUpper(name), "_"), suffix)
+}
+
+// Register add handlerFunc as the job name, scheduled by the CRON_<NAME>_SCHEDULE and CRON_<NAME>_TIMEZONE env,
+// the schedule is a cron expression with or without seconds, a descriptor like @daily or an interval like 5m.
+// The job is not scheduled when CRON_<NAME>_DISABLED is true or it has no schedule, it can still be run with Trigger
+func (c CronjobContext) Register(name string, handlerFunc func(ctx ICronjobContext) error, options ...*CronjobJobOptions) {
+	entry := newCronjobJob(handlerFunc, options...)
+	entry.options.Name = name
+	if schedule := c.ENV().String(cronjobEnvKey(name, "SCHEDULE")); schedule != "" {
+		entry.options.Schedule = schedule
+	}
+
+	if timeZone := c.ENV().String(cronjobEnvKey(name, "TIMEZONE")); timeZone != "" {
+		entry.options.TimeZone = timeZone
+	}
+
+	defer c.addJob(entry)
+	if c.ENV().Bool(cronjobEnvKey(name, "DISABLED")) {
+		entry.disabled = true
+		c.Log().Info(fmt.Sprintf("Cronjob '%s' is disabled", name))
+		return
+	}
+
+	if entry.options.Schedule == "" {
+		entry.disabled = true
+		c.NewError(fmt.Errorf("cronjob '%s' has no schedule, set %s", name, cronjobEnvKey(name, "SCHEDULE")), cronjobError)
+		return
+	}
+
+	job, err := c.scheduler(entry.options)
+	if err == nil {
+		err = c.schedule(job, entry)
+	}
+
+	if err != nil {
+		entry.disabled = true
+		c.NewError(err, cronjobError, fmt.Sprintf("Cronjob '%s' has an invalid schedule '%s'", name, entry.options.Schedule))
+	}
+}
+
+// scheduler start the gocron job of the schedule and time zone of options
+func (c CronjobContext) scheduler(options *CronjobJobOptions) (*gocron.Scheduler, error) {
+	schedule := strings.TrimSpace(options.Schedule)
+	if interval, err := time.ParseDuration(schedule); err == nil {
+		return c.cron.Every(interval), nil
+	}
+
+	if options.TimeZone != "" {
+		if _, err := time.LoadLocation(options.TimeZone); err != nil {
+			return nil, err
+		}
+
+		schedule = fmt.Sprintf("CRON_TZ=%s %s", options.TimeZone, schedule)
+	}
+
+	if len(strings.Fields(options.Schedule)) == 6 {
+		return c.cron.CronWithSeconds(schedule), nil
+	}
+
+	return c.cron.Cron(schedule), nil
+}
+
+// Trigger run the job name now with its options, the run is recorded in the history like a scheduled run
+func (c CronjobContext) Trigger(name string) (*CronjobRun, IError) {
+	entry := c.findJob(name)
+	if entry == nil {
+		return nil, CronjobNotFoundError
+	}
+
+	c.Log().Info(fmt.Sprintf("Cronjob '%s' triggered", name))
+	return c.run(entry), nil
+}
+
+// CronjobTriggerHandler run the job of the name path param in the background and reply 202 Accepted,
+// the outcome of the run is found in the history
+func CronjobTriggerHandler(ctx ICronjobContext) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		found := false
+		for _, job := range ctx.Jobs() {
+			if job.Name == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return c.JSON(CronjobNotFoundError.GetStatus(), CronjobNotFoundError.JSON())
+		}
+
+		go func() {
+			_, _ = ctx.Trigger(name)
+		}()
+
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"name": name,
+		})
+	}
+}
+
+// runOnce run the job name for CronjobRunFlag, the process exits with 1 when the run fails or times out, a run skipped
+// because another instance holds the lock is not a failure
+func (c CronjobContext) runOnce(name string) {
+	run, ierr := c.Trigger(name)
+	if ierr != nil {
+		c.Log().Error(ierr, fmt.Sprintf("Cronjob '%s' is not registered", name))
+		os.Exit(1)
+	}
+
+	if run.Status != CronjobRunStatusSuccess && run.Status != CronjobRunStatusSkipped {
+		os.Exit(1)
+	}
+}
+
+// cronjobRunArg return the value of CronjobRunFlag in args, or an empty string when it is not set
+func cronjobRunArg(args []string) string {
+	for i, arg := range args {
+		flag := strings.TrimLeft(arg, "-")
+		if flag == arg {
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(flag, CronjobRunFlag+"="); ok {
+			return value
+		}
+
+		if flag == CronjobRunFlag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
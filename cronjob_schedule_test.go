@@ -0,0 +1,82 @@
+package core
+
+import (
+	"github.com/go-co-op/gocron"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCronjobEnvKey(t *testing.T) {
+	assert.Equal(t, "CRON_SYNC_ORDERS_SCHEDULE", cronjobEnvKey("sync-orders", "SCHEDULE"))
+	assert.Equal(t, "CRON_REPORT_DAILY_DISABLED", cronjobEnvKey("report.daily", "DISABLED"))
+}
+
+func TestCronjobRunArg(t *testing.T) {
+	assert.Equal(t, "sync", cronjobRunArg([]string{"--cronjob-run=sync"}))
+	assert.Equal(t, "sync", cronjobRunArg([]string{"-v", "-cronjob-run", "sync"}))
+	assert.Equal(t, "", cronjobRunArg([]string{"cronjob-run", "sync"}))
+	assert.Equal(t, "", cronjobRunArg([]string{"--cronjob-run"}))
+}
+
+func TestCronjobContext_Register(t *testing.T) {
+	env := newTestENV(&ENVConfig{Service: "orders"})
+	env.On("String", "CRON_SYNC_SCHEDULE").Return("*/5 * * * *")
+	env.On("String", "CRON_SYNC_TIMEZONE").Return("Asia/Bangkok")
+	env.On("Bool", "CRON_SYNC_DISABLED").Return(false)
+	env.On("String", "CRON_REPORT_SCHEDULE").Return("")
+	env.On("String", "CRON_REPORT_TIMEZONE").Return("")
+	env.On("Bool", "CRON_REPORT_DISABLED").Return(true)
+	env.On("String", mock.Anything).Return("")
+	env.On("Bool", mock.Anything).Return(false)
+
+	c := &CronjobContext{
+		IContext: newTestContext(&ContextOptions{ENV: env}),
+		cron:     gocron.NewScheduler(time.UTC),
+		registry: &cronjobRegistry{},
+	}
+
+	calls := 0
+	handler := func(ctx ICronjobContext) error {
+		calls++
+		return nil
+	}
+
+	c.Register("sync", handler)
+	c.Register("report", handler, &CronjobJobOptions{Schedule: "1h"})
+	c.Register("broken", handler, &CronjobJobOptions{Schedule: "every monday"})
+
+	jobs := c.Jobs()
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, "*/5 * * * *", jobs[0].Schedule)
+	assert.False(t, jobs[0].Disabled)
+	assert.True(t, jobs[1].Disabled)
+	assert.True(t, jobs[2].Disabled)
+	assert.Len(t, c.cron.Jobs(), 1)
+
+	run, ierr := c.Trigger("report")
+	assert.NoError(t, ierr)
+	assert.Equal(t, CronjobRunStatusSuccess, run.Status)
+	assert.Equal(t, 1, calls)
+
+	_, ierr = c.Trigger("unknown")
+	assert.Equal(t, CronjobNotFoundError, ierr)
+}
+
+func TestCronjobTriggerHandler_NotFound(t *testing.T) {
+	c := newCronjobTestContext(nil)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/cronjobs/unknown/trigger", nil), rec)
+	ctx.SetParamNames("name")
+	ctx.SetParamValues("unknown")
+
+	err := CronjobTriggerHandler(c)(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -9,8 +9,10 @@ import (
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"net"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 type KeywordCondition string
@@ -49,36 +51,53 @@ type Database struct {
 	User     string
 	Password string
 	Port     string
-	config   *gorm.Config
+	// ReplicaHosts are host or host:port of the read replicas, the port defaults to Port
+	ReplicaHosts []string
+	// ReplicaDSNs take precedence over ReplicaHosts
+	ReplicaDSNs     []string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	config          *gorm.Config
 }
 
 func NewDatabase(env *ENVConfig) *Database {
 	return &Database{
-		Driver:   env.DBDriver,
-		DSN:      env.DBDsn,
-		Name:     env.DBName,
-		Host:     env.DBHost,
-		User:     env.DBUser,
-		Password: env.DBPassword,
-		Port:     env.DBPort,
-		config:   &gorm.Config{},
+		Driver:          env.DBDriver,
+		DSN:             env.DBDsn,
+		Name:            env.DBName,
+		Host:            env.DBHost,
+		User:            env.DBUser,
+		Password:        env.DBPassword,
+		Port:            env.DBPort,
+		ReplicaHosts:    envList(env.DBReplicaHosts),
+		ReplicaDSNs:     envList(env.DBReplicaDsns),
+		MaxOpenConns:    env.DBMaxOpenConns,
+		MaxIdleConns:    env.DBMaxIdleConns,
+		ConnMaxLifetime: env.DBConnMaxLifetime,
+		config:          &gorm.Config{},
 	}
 }
 
 func NewDatabaseWithConfig(env *ENVConfig, config *gorm.Config) *Database {
 	return &Database{
-		Driver:   env.DBDriver,
-		DSN:      env.DBDsn,
-		Name:     env.DBName,
-		Host:     env.DBHost,
-		User:     env.DBUser,
-		Password: env.DBPassword,
-		Port:     env.DBPort,
-		config:   config,
+		Driver:          env.DBDriver,
+		DSN:             env.DBDsn,
+		Name:            env.DBName,
+		Host:            env.DBHost,
+		User:            env.DBUser,
+		Password:        env.DBPassword,
+		Port:            env.DBPort,
+		ReplicaHosts:    envList(env.DBReplicaHosts),
+		ReplicaDSNs:     envList(env.DBReplicaDsns),
+		MaxOpenConns:    env.DBMaxOpenConns,
+		MaxIdleConns:    env.DBMaxIdleConns,
+		ConnMaxLifetime: env.DBConnMaxLifetime,
+		config:          config,
 	}
 }
 
-// Connect to connect Database
+// Connect to connect Database, the reads are routed to the replicas when there are some, see DBUseReplicas
 func (db *Database) Connect() (*gorm.DB, error) {
 	logLevel := logger.Silent
 	if NewEnv().Config().LogLevel == logrus.DebugLevel {
@@ -89,40 +108,98 @@ func (db *Database) Connect() (*gorm.DB, error) {
 		logLevel = logger.Error
 	}
 
-	dsn := db.DSN
-	var newDB *gorm.DB
-	var err error
-
 	db.config.Logger = logger.Default.LogMode(logLevel)
 
+	newDB, err := db.open(db.dialector(db.DSN, db.Host, db.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*gorm.DB, 0)
+	for _, dsn := range db.ReplicaDSNs {
+		replica, err := db.open(db.dialector(dsn, "", ""))
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+
+	if len(db.ReplicaDSNs) == 0 {
+		for _, replicaHost := range db.ReplicaHosts {
+			host, port, err := net.SplitHostPort(replicaHost)
+			if err != nil {
+				host, port = replicaHost, db.Port
+			}
+
+			replica, err := db.open(db.dialector("", host, port))
+			if err != nil {
+				return nil, err
+			}
+			replicas = append(replicas, replica)
+		}
+	}
+
+	if len(replicas) > 0 {
+		err = DBUseReplicas(newDB, replicas...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newDB, nil
+}
+
+// open connect dialector and set the pool options
+func (db *Database) open(dialector gorm.Dialector) (*gorm.DB, error) {
+	newDB, err := gorm.Open(dialector, db.config)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := newDB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if db.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(db.MaxOpenConns)
+	}
+
+	if db.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(db.MaxIdleConns)
+	}
+
+	if db.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(db.ConnMaxLifetime)
+	}
+
+	return newDB, nil
+}
+
+// dialector return the dialector of the driver for dsn, or for host and port when dsn is empty
+func (db *Database) dialector(dsn string, host string, port string) gorm.Dialector {
 	switch db.Driver {
 	case DatabaseDriverMSSQL:
 		if len(dsn) == 0 {
 			dsn = fmt.Sprintf("sqlserver://%v:%v@%v:%v?database=%v",
-				db.User, db.Password, db.Host, db.Port, db.Name,
+				db.User, db.Password, host, port, db.Name,
 			)
 		}
-		newDB, err = gorm.Open(sqlserver.Open(dsn), db.config)
+		return sqlserver.Open(dsn)
 	case DatabaseDriverPOSTGRES:
 		if len(dsn) == 0 {
 			dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=utc",
-				db.Host, db.User, db.Password, db.Name, db.Port)
+				host, db.User, db.Password, db.Name, port)
 		}
-		newDB, err = gorm.Open(postgres.Open(dsn), db.config)
+		return postgres.Open(dsn)
 	default:
 		if len(dsn) == 0 {
 			dsn = fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?charset=utf8&parseTime=True&loc=Local&multiStatements=True&loc=UTC",
-				db.User, db.Password, db.Host, db.Port, db.Name,
+				db.User, db.Password, host, port, db.Name,
 			)
 		}
-		newDB, err = gorm.Open(mysql.Open(dsn), db.config)
-	}
-
-	if err != nil {
-		return nil, err
+		return mysql.Open(dsn)
 	}
-
-	return newDB, nil
 }
 
 func Paginate(db *gorm.DB, model interface{}, options *PageOptions) (*PageResponse, error) {
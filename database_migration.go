@@ -0,0 +1,482 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	DefaultDBMigrationTable       = "schema_migrations"
+	DefaultDBMigrationLockTimeout = time.Minute
+	dbMigrationLockPollInterval   = 500 * time.Millisecond
+)
+
+// DBMigrateCommand is the command line running the migrations instead of the service,
+// e.g. `./app migrate up`, `./app migrate down 2`, `./app migrate status` or `./app migrate up --dry-run`
+const DBMigrateCommand = "migrate"
+
+var ErrDBMigrationLockTimeout = errors.New("migration: timeout waiting for the migration lock")
+
+// dbMigrationFileName match <version>_<name>.up.sql and <version>_<name>.down.sql
+var dbMigrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type DBMigration struct {
+	// Version order the migrations, it is usually a timestamp like 20230401120000
+	Version string
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down revert Up, the migration cannot be rolled back when it is nil
+	Down func(tx *gorm.DB) error
+	// NoTransaction run the migration outside of a transaction, e.g. for CREATE INDEX CONCURRENTLY on postgres
+	NoTransaction bool
+}
+
+func (m *DBMigration) version() string {
+	return m.Version
+}
+
+func (m *DBMigration) name() string {
+	return m.Name
+}
+
+func (m *DBMigration) hasUp() bool {
+	return m.Up != nil
+}
+
+func (m *DBMigration) hasDown() bool {
+	return m.Down != nil
+}
+
+// DBMigrationRecord is an applied migration in the bookkeeping table
+type DBMigrationRecord struct {
+	Version   string    `gorm:"primaryKey;size:191" json:"version"`
+	Name      string    `gorm:"size:255" json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (r DBMigrationRecord) status() MigrationStatus {
+	return MigrationStatus{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: &r.AppliedAt}
+}
+
+type IDBMigrator interface {
+	Add(migrations ...*DBMigration)
+	// Up apply the pending migrations in version order, it returns the applied migrations
+	Up() ([]MigrationStatus, error)
+	// Down revert the last steps applied migrations, it returns the reverted migrations
+	Down(steps int) ([]MigrationStatus, error)
+	Status() ([]MigrationStatus, error)
+	// Command run DBMigrateCommand from args, it returns false when args is not this command
+	Command(args []string) (bool, error)
+}
+
+type DBMigratorOptions struct {
+	// Table is the bookkeeping table, defaults to DefaultDBMigrationTable
+	Table string
+	// LockTimeout is the wait for the migrations run by another replica, defaults to DefaultDBMigrationLockTimeout
+	LockTimeout time.Duration
+	// DryRun report the migrations Up and Down would run without running them
+	DryRun bool
+	// Output of Command, defaults to os.Stdout
+	Output io.Writer
+}
+
+type DBMigrator struct {
+	db         *gorm.DB
+	options    DBMigratorOptions
+	migrations []*DBMigration
+}
+
+// NewDBMigrator create a migrator for postgres, mysql and mssql, the replicas running it at the same time wait for
+// each other with an advisory lock. Every migration runs in a transaction with its bookkeeping row,
+// beware that mysql commits the DDL statements right away
+func NewDBMigrator(db *gorm.DB, options *DBMigratorOptions) IDBMigrator {
+	migratorOptions := DBMigratorOptions{}
+	if options != nil {
+		migratorOptions = *options
+	}
+
+	if migratorOptions.Table == "" {
+		migratorOptions.Table = DefaultDBMigrationTable
+	}
+
+	if migratorOptions.LockTimeout <= 0 {
+		migratorOptions.LockTimeout = DefaultDBMigrationLockTimeout
+	}
+
+	if migratorOptions.Output == nil {
+		migratorOptions.Output = os.Stdout
+	}
+
+	return &DBMigrator{db: db, options: migratorOptions}
+}
+
+// LoadDBMigrations read the <version>_<name>.up.sql and <version>_<name>.down.sql files at the root of fsys,
+// e.g. an embed.FS passed through fs.Sub. Each file is executed as a single statement batch
+func LoadDBMigrations(fsys fs.FS) ([]*DBMigration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[string]*DBMigration)
+	for _, entry := range entries {
+		match := dbMigrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := migrations[match[1]]
+		if !ok {
+			migration = &DBMigration{Version: match[1], Name: match[2]}
+			migrations[match[1]] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration: version %s is used by %s and %s", match[1], migration.Name, match[2])
+		}
+
+		run := dbMigrationSQL(string(body))
+		if match[3] == "up" {
+			migration.Up = run
+		} else {
+			migration.Down = run
+		}
+	}
+
+	list := make([]*DBMigration, 0, len(migrations))
+	for _, migration := range migrations {
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration: %s_%s has no up file", migration.Version, migration.Name)
+		}
+
+		list = append(list, migration)
+	}
+
+	return sortMigrations(list)
+}
+
+func dbMigrationSQL(statements string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec(statements).Error
+	}
+}
+
+func (m *DBMigrator) Add(migrations ...*DBMigration) {
+	m.migrations = append(m.migrations, migrations...)
+}
+
+// applied return the records of the bookkeeping table by version, it is empty when the table does not exist
+func (m *DBMigrator) applied(db *gorm.DB) (map[string]DBMigrationRecord, error) {
+	records := make(map[string]DBMigrationRecord)
+	if !db.Migrator().HasTable(m.options.Table) {
+		return records, nil
+	}
+
+	list := make([]DBMigrationRecord, 0)
+	err := db.Table(m.options.Table).Order("version").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range list {
+		records[record.Version] = record
+	}
+
+	return records, nil
+}
+
+// lockName return the advisory lock of the bookkeeping table
+func (m *DBMigrator) lockName() string {
+	return "migrate:" + m.options.Table
+}
+
+// withLock run fn on a single connection holding the migration lock, the bookkeeping table is created first.
+// A dry run neither locks nor creates the table
+func (m *DBMigrator) withLock(fn func(conn *gorm.DB) error) error {
+	if m.options.DryRun {
+		return fn(m.db)
+	}
+
+	return m.db.Connection(func(conn *gorm.DB) error {
+		unlock, err := m.lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if !conn.Migrator().HasTable(m.options.Table) {
+			err = conn.Table(m.options.Table).Migrator().CreateTable(&DBMigrationRecord{})
+			if err != nil {
+				return err
+			}
+		}
+
+		return fn(conn)
+	})
+}
+
+// lock take the session lock of the dialect of conn, the other dialects are not locked
+func (m *DBMigrator) lock(conn *gorm.DB) (func(), error) {
+	name := m.lockName()
+	switch conn.Dialector.Name() {
+	case "postgres":
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(name))
+		key := int64(hash.Sum64())
+		deadline := time.Now().Add(m.options.LockTimeout)
+		for {
+			locked := false
+			err := conn.Raw("SELECT pg_try_advisory_lock(?)", key).Row().Scan(&locked)
+			if err != nil {
+				return nil, err
+			}
+
+			if locked {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				return nil, ErrDBMigrationLockTimeout
+			}
+			time.Sleep(dbMigrationLockPollInterval)
+		}
+
+		return func() {
+			conn.Exec("SELECT pg_advisory_unlock(?)", key)
+		}, nil
+	case "mysql":
+		var locked *int64
+		err := conn.Raw("SELECT GET_LOCK(?, ?)", name, int64(m.options.LockTimeout.Seconds())).Row().Scan(&locked)
+		if err != nil {
+			return nil, err
+		}
+
+		if locked == nil || *locked != 1 {
+			return nil, ErrDBMigrationLockTimeout
+		}
+
+		return func() {
+			conn.Exec("SELECT RELEASE_LOCK(?)", name)
+		}, nil
+	case "sqlserver":
+		result := 0
+		err := conn.Raw("DECLARE @result int; EXEC @result = sp_getapplock @Resource = ?, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = ?; SELECT @result",
+			name, m.options.LockTimeout.Milliseconds()).Row().Scan(&result)
+		if err != nil {
+			return nil, err
+		}
+
+		if result < 0 {
+			return nil, ErrDBMigrationLockTimeout
+		}
+
+		return func() {
+			conn.Exec("EXEC sp_releaseapplock @Resource = ?, @LockOwner = 'Session'", name)
+		}, nil
+	}
+
+	return func() {}, nil
+}
+
+// run execute the up or down function of migration with its bookkeeping row
+func (m *DBMigrator) run(conn *gorm.DB, migration *DBMigration, up bool) error {
+	run := func(tx *gorm.DB) error {
+		fn := migration.Up
+		if !up {
+			fn = migration.Down
+		}
+
+		err := fn(tx)
+		if err != nil {
+			return fmt.Errorf("migration: %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		if up {
+			return tx.Table(m.options.Table).Create(&DBMigrationRecord{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		}
+
+		return tx.Table(m.options.Table).Where("version = ?", migration.Version).Delete(&DBMigrationRecord{}).Error
+	}
+
+	if migration.NoTransaction {
+		return run(conn)
+	}
+
+	return conn.Transaction(run)
+}
+
+func (m *DBMigrator) Up() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	err = m.withLock(func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if !m.options.DryRun {
+				err = m.run(conn, migration, true)
+				if err != nil {
+					return err
+				}
+			}
+
+			statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: !m.options.DryRun})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *DBMigrator) Down(steps int) ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	err = m.withLock(func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		reverted, err := revertMigrations(migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range reverted {
+			if !m.options.DryRun {
+				err = m.run(conn, migration, false)
+				if err != nil {
+					return err
+				}
+			}
+
+			statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: m.options.DryRun})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *DBMigrator) Status() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(DBPrimary(m.db))
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(migrations, applied), nil
+}
+
+// Command run `migrate up`, `migrate down [steps]` or `migrate status` from args, usually os.Args[1:],
+// a --dry-run flag reports the migrations without running them. Down reverts one migration by default
+func (m *DBMigrator) Command(args []string) (bool, error) {
+	if len(args) == 0 || args[0] != DBMigrateCommand {
+		return false, nil
+	}
+
+	command := "up"
+	steps := 1
+	for _, arg := range args[1:] {
+		if strings.TrimLeft(arg, "-") == "dry-run" {
+			m.options.DryRun = true
+			continue
+		}
+
+		if n, err := strconv.Atoi(arg); err == nil {
+			steps = n
+			continue
+		}
+
+		command = arg
+	}
+
+	switch command {
+	case "up":
+		statuses, err := m.Up()
+		m.print(statuses, "apply", "applied")
+		return true, err
+	case "down":
+		statuses, err := m.Down(steps)
+		m.print(statuses, "revert", "reverted")
+		return true, err
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return true, err
+		}
+
+		writer := tabwriter.NewWriter(m.options.Output, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state := "pending"
+			appliedAt := ""
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			if status.Missing {
+				state = "missing"
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+
+		return true, writer.Flush()
+	}
+
+	return true, fmt.Errorf("migration: unknown command '%s', expected up, down or status", command)
+}
+
+func (m *DBMigrator) print(statuses []MigrationStatus, dryRunVerb string, verb string) {
+	if len(statuses) == 0 {
+		_, _ = fmt.Fprintln(m.options.Output, "No migration to run")
+	}
+
+	for _, status := range statuses {
+		if m.options.DryRun {
+			_, _ = fmt.Fprintf(m.options.Output, "Would %s %s_%s\n", dryRunVerb, status.Version, status.Name)
+		} else {
+			_, _ = fmt.Fprintf(m.options.Output, "Migration %s %s_%s\n", verb, status.Version, status.Name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func expectDBMigrationTable(db *MockDatabase, exists bool) {
+	count := 0
+	if exists {
+		count = 1
+	}
+
+	db.Mock.ExpectQuery("SELECT DATABASE()").WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("app"))
+	db.Mock.ExpectQuery("SELECT count\\(\\*\\) FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func TestLoadDBMigrations(t *testing.T) {
+	migrations, err := LoadDBMigrations(fstest.MapFS{
+		"20230102000000_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email VARCHAR(255)")},
+		"20230101000000_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT)")},
+		"20230101000000_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+		"README.md":                            {Data: []byte("migrations")},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "20230101000000", migrations[0].Version)
+	assert.Equal(t, "create_users", migrations[0].Name)
+	assert.NotNil(t, migrations[0].Down)
+	assert.Equal(t, "add_email", migrations[1].Name)
+	assert.Nil(t, migrations[1].Down)
+
+	_, err = LoadDBMigrations(fstest.MapFS{
+		"20230101000000_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	})
+	assert.Error(t, err)
+}
+
+func TestDBMigrator_Up(t *testing.T) {
+	db := NewMockDatabase()
+	migrator := NewDBMigrator(db.Gorm, nil)
+
+	ran := make([]string, 0)
+	migrator.Add(&DBMigration{Version: "2", Name: "add_email", Up: func(tx *gorm.DB) error {
+		ran = append(ran, "add_email")
+		return nil
+	}}, &DBMigration{Version: "1", Name: "create_users", Up: func(tx *gorm.DB) error {
+		ran = append(ran, "create_users")
+		return nil
+	}})
+
+	db.Mock.ExpectQuery("SELECT GET_LOCK").WithArgs("migrate:schema_migrations", 60).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	expectDBMigrationTable(db, true)
+	expectDBMigrationTable(db, true)
+	db.Mock.ExpectQuery("SELECT \\* FROM `schema_migrations`").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).AddRow("1", "create_users", time.Now()))
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectExec("INSERT INTO `schema_migrations`").WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectCommit()
+	db.Mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	statuses, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationStatus{{Version: "2", Name: "add_email", Applied: true}}, statuses)
+	assert.Equal(t, []string{"add_email"}, ran)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestDBMigrator_DryRun(t *testing.T) {
+	db := NewMockDatabase()
+	output := &bytes.Buffer{}
+	migrator := NewDBMigrator(db.Gorm, &DBMigratorOptions{Output: output})
+	migrator.Add(&DBMigration{Version: "1", Name: "create_users", Up: func(tx *gorm.DB) error {
+		t.Fatal("a dry run must not run the migration")
+		return nil
+	}})
+
+	expectDBMigrationTable(db, false)
+
+	ok, err := migrator.Command([]string{"migrate", "up", "--dry-run"})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "Would apply 1_create_users\n", output.String())
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+
+	ok, err = migrator.Command([]string{"serve"})
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestDBMigrator_Down(t *testing.T) {
+	db := NewMockDatabase()
+	migrator := NewDBMigrator(db.Gorm, nil)
+	migrator.Add(&DBMigration{Version: "1", Name: "create_users", Up: func(tx *gorm.DB) error {
+		return nil
+	}})
+
+	db.Mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	expectDBMigrationTable(db, true)
+	expectDBMigrationTable(db, true)
+	db.Mock.ExpectQuery("SELECT \\* FROM `schema_migrations`").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).AddRow("1", "create_users", time.Now()))
+	db.Mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := migrator.Down(1)
+	assert.EqualError(t, err, "migration: 1_create_users has no down migration")
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
+
+func TestDBMigrator_DuplicateVersion(t *testing.T) {
+	migrator := NewDBMigrator(NewMockDatabase().Gorm, nil)
+	up := func(tx *gorm.DB) error {
+		return nil
+	}
+	migrator.Add(&DBMigration{Version: "1", Name: "a", Up: up}, &DBMigration{Version: "1", Name: "b", Up: up})
+
+	_, err := migrator.Up()
+	assert.EqualError(t, err, "migration: version 1 is used by a and b")
+}
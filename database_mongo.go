@@ -25,9 +25,54 @@ type DatabaseMongo struct {
 }
 
 type MongoListIndexResult struct {
-	Key     map[string]int64 `json:"key" bson:"key"`
-	Name    string           `json:"name" bson:"name"`
-	Version int64            `json:"version" bson:"v"`
+	// Key hold the numeric keys, a text, hashed or 2dsphere key is 0, see Keys for the order and the kind of every key
+	Key                map[string]int64 `json:"key" bson:"key"`
+	Keys               bson.D           `json:"keys" bson:"-"`
+	Name               string           `json:"name" bson:"name"`
+	Version            int64            `json:"version" bson:"v"`
+	Unique             bool             `json:"unique,omitempty" bson:"unique,omitempty"`
+	Sparse             bool             `json:"sparse,omitempty" bson:"sparse,omitempty"`
+	ExpireAfterSeconds *int64           `json:"expire_after_seconds,omitempty" bson:"expireAfterSeconds,omitempty"`
+}
+
+// UnmarshalBSON decode the key document in order into Keys, and its numeric values into Key
+func (r *MongoListIndexResult) UnmarshalBSON(data []byte) error {
+	raw := struct {
+		Key                bson.D `bson:"key"`
+		Name               string `bson:"name"`
+		Version            int64  `bson:"v"`
+		Unique             bool   `bson:"unique,omitempty"`
+		Sparse             bool   `bson:"sparse,omitempty"`
+		ExpireAfterSeconds *int64 `bson:"expireAfterSeconds,omitempty"`
+	}{}
+	err := bson.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*r = MongoListIndexResult{
+		Key:                make(map[string]int64, len(raw.Key)),
+		Keys:               raw.Key,
+		Name:               raw.Name,
+		Version:            raw.Version,
+		Unique:             raw.Unique,
+		Sparse:             raw.Sparse,
+		ExpireAfterSeconds: raw.ExpireAfterSeconds,
+	}
+	for _, key := range raw.Key {
+		switch value := key.Value.(type) {
+		case int32:
+			r.Key[key.Key] = int64(value)
+		case int64:
+			r.Key[key.Key] = value
+		case float64:
+			r.Key[key.Key] = int64(value)
+		default:
+			r.Key[key.Key] = 0
+		}
+	}
+
+	return nil
 }
 
 type MongoDropIndexResult struct {
@@ -59,11 +104,12 @@ func (db *DatabaseMongo) Connect() (IMongoDB, error) {
 		return nil, err
 	}
 
-	return &MongoDB{database: client.Database(db.Name), databaseClient: client}, nil
+	return &MongoDB{database: client.Database(db.Name), databaseClient: client, ctx: context.Background()}, nil
 }
 
 type IMongoDB interface {
 	DB() *mongo.Database
+	WithContext(ctx context.Context) IMongoDB
 	Create(coll string, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
 	FindAggregate(dest interface{}, coll string, pipeline interface{}, opts ...*options.AggregateOptions) error
 	FindAggregatePagination(dest interface{}, coll string, pipeline interface{}, pageOptions *PageOptions, opts ...*options.AggregateOptions) (*PageResponse, error)
@@ -90,18 +136,30 @@ type IMongoDB interface {
 type MongoDB struct {
 	database       *mongo.Database
 	databaseClient *mongo.Client
+	ctx            context.Context
 }
 
 func (m MongoDB) Helper() IMongoDBHelper {
 	return NewMongoHelper()
 }
 
+// WithContext return a copy of the database that derives every query from ctx
+func (m MongoDB) WithContext(ctx context.Context) IMongoDB {
+	m.ctx = ctx
+	return &m
+}
+
 func (m MongoDB) getContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), queryTimeOut)
+	parent := m.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	return context.WithTimeout(parent, queryTimeOut)
 }
 
 func (m MongoDB) Close() {
-	ctx, cancel := m.getContext()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeOut)
 	defer cancel()
 
 	if err := m.databaseClient.Disconnect(ctx); err != nil {
@@ -2,8 +2,22 @@ package core
 
 import (
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"strings"
 )
 
+const (
+	MongoIndexDriftMissing    = "missing"
+	MongoIndexDriftChanged    = "changed"
+	MongoIndexDriftUndeclared = "undeclared"
+)
+
+// mongoDefaultIndex is the index of _id, it is never dropped
+const mongoDefaultIndex = "_id_"
+
 type IMongoIndexBatch interface {
 	Name() string
 	Run() error
@@ -11,12 +25,45 @@ type IMongoIndexBatch interface {
 
 type IMongoIndexer interface {
 	Add(batch IMongoIndexBatch)
+	// Declare the indexes of coll, Execute and Sync create the missing ones
+	Declare(coll string, indexes ...MongoIndexSpec)
 	Execute() error
+	// Sync diff the declared indexes with the indexes of their collections and return the drifts
+	Sync(options *MongoIndexSyncOptions) ([]MongoIndexDrift, error)
+}
+
+// MongoIndexSpec is a declared index, Keys keep the order of a compound index
+type MongoIndexSpec struct {
+	// Name defaults to the name generated by Mongo, e.g. email_1_created_at_-1
+	Name               string
+	Keys               bson.D
+	Unique             bool
+	Sparse             bool
+	ExpireAfterSeconds *int32
+}
+
+type MongoIndexSyncOptions struct {
+	// DryRun report the drifts without changing any index
+	DryRun bool
+	// DropUndeclared drop the indexes of a declared collection which are not declared, except _id_
+	DropUndeclared bool
+	// Recreate drop then create the indexes whose keys or options changed, they are only reported otherwise
+	Recreate bool
+}
+
+type MongoIndexDrift struct {
+	Collection string `json:"collection"`
+	Name       string `json:"name"`
+	// Drift is MongoIndexDriftMissing, MongoIndexDriftChanged or MongoIndexDriftUndeclared
+	Drift string `json:"drift"`
+	// Fixed tell if Sync changed the index
+	Fixed bool `json:"fixed"`
 }
 
 type MongoIndexer struct {
-	ctx     IContext
-	Batches []IMongoIndexBatch
+	ctx      IContext
+	Batches  []IMongoIndexBatch
+	Declared map[string][]MongoIndexSpec
 }
 
 func NewMongoIndexer(ctx IContext) IMongoIndexer {
@@ -33,11 +80,16 @@ func (i *MongoIndexer) Add(batch IMongoIndexBatch) {
 	}
 }
 
-func (i *MongoIndexer) Execute() error {
-	if i.Batches == nil {
-		return nil
+func (i *MongoIndexer) Declare(coll string, indexes ...MongoIndexSpec) {
+	if i.Declared == nil {
+		i.Declared = make(map[string][]MongoIndexSpec)
 	}
 
+	i.Declared[coll] = append(i.Declared[coll], indexes...)
+}
+
+// Execute run the batches then create the missing declared indexes
+func (i *MongoIndexer) Execute() error {
 	for _, b := range i.Batches {
 		i.ctx.Log().Debug(fmt.Sprintf(`Mongo Indexing: %s`, b.Name()))
 		err := b.Run()
@@ -46,5 +98,151 @@ func (i *MongoIndexer) Execute() error {
 		}
 	}
 
-	return nil
+	if len(i.Declared) == 0 {
+		return nil
+	}
+
+	_, err := i.Sync(nil)
+	return err
+}
+
+func (i *MongoIndexer) Sync(options *MongoIndexSyncOptions) ([]MongoIndexDrift, error) {
+	if options == nil {
+		options = &MongoIndexSyncOptions{}
+	}
+
+	colls := make([]string, 0, len(i.Declared))
+	for coll := range i.Declared {
+		colls = append(colls, coll)
+	}
+	sort.Strings(colls)
+
+	drifts := make([]MongoIndexDrift, 0)
+	for _, coll := range colls {
+		collDrifts, err := i.syncCollection(coll, i.Declared[coll], options)
+		drifts = append(drifts, collDrifts...)
+		if err != nil {
+			return drifts, err
+		}
+	}
+
+	return drifts, nil
+}
+
+func (i *MongoIndexer) syncCollection(coll string, specs []MongoIndexSpec, syncOptions *MongoIndexSyncOptions) ([]MongoIndexDrift, error) {
+	db := i.ctx.DBMongo()
+	existing, err := db.ListIndex(coll)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]MongoListIndexResult, len(existing))
+	for _, index := range existing {
+		byName[index.Name] = index
+	}
+
+	drifts := make([]MongoIndexDrift, 0)
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		name := spec.name()
+		declared[name] = true
+
+		index, ok := byName[name]
+		if ok && spec.matches(index) {
+			continue
+		}
+
+		drift := MongoIndexDrift{Collection: coll, Name: name, Drift: MongoIndexDriftMissing}
+		if ok {
+			drift.Drift = MongoIndexDriftChanged
+		}
+
+		if !syncOptions.DryRun && (!ok || syncOptions.Recreate) {
+			i.ctx.Log().Debug(fmt.Sprintf(`Mongo Indexing: %s.%s is %s`, coll, name, drift.Drift))
+			if ok {
+				_, err = db.DropIndex(coll, name)
+				if err != nil {
+					return drifts, err
+				}
+			}
+
+			_, err = db.CreateIndex(coll, []mongo.IndexModel{spec.model()})
+			if err != nil {
+				return drifts, err
+			}
+			drift.Fixed = true
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	for _, index := range existing {
+		if declared[index.Name] || index.Name == mongoDefaultIndex {
+			continue
+		}
+
+		drift := MongoIndexDrift{Collection: coll, Name: index.Name, Drift: MongoIndexDriftUndeclared}
+		if !syncOptions.DryRun && syncOptions.DropUndeclared {
+			i.ctx.Log().Debug(fmt.Sprintf(`Mongo Indexing: drop %s.%s`, coll, index.Name))
+			_, err = db.DropIndex(coll, index.Name)
+			if err != nil {
+				return drifts, err
+			}
+			drift.Fixed = true
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	return drifts, nil
+}
+
+// name return the declared name, or the name generated by Mongo from the keys
+func (s MongoIndexSpec) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	parts := make([]string, 0, len(s.Keys)*2)
+	for _, key := range s.Keys {
+		parts = append(parts, key.Key, fmt.Sprintf("%v", key.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// matches tell if index has the keys in the same order and the options of the spec
+func (s MongoIndexSpec) matches(index MongoListIndexResult) bool {
+	if len(index.Keys) != len(s.Keys) || index.Unique != s.Unique || index.Sparse != s.Sparse {
+		return false
+	}
+
+	for i, key := range s.Keys {
+		if index.Keys[i].Key != key.Key || fmt.Sprintf("%v", index.Keys[i].Value) != fmt.Sprintf("%v", key.Value) {
+			return false
+		}
+	}
+
+	if s.ExpireAfterSeconds == nil || index.ExpireAfterSeconds == nil {
+		return s.ExpireAfterSeconds == nil && index.ExpireAfterSeconds == nil
+	}
+
+	return int64(*s.ExpireAfterSeconds) == *index.ExpireAfterSeconds
+}
+
+func (s MongoIndexSpec) model() mongo.IndexModel {
+	indexOptions := options.Index().SetName(s.name())
+	if s.Unique {
+		indexOptions.SetUnique(true)
+	}
+
+	if s.Sparse {
+		indexOptions.SetSparse(true)
+	}
+
+	if s.ExpireAfterSeconds != nil {
+		indexOptions.SetExpireAfterSeconds(*s.ExpireAfterSeconds)
+	}
+
+	return mongo.IndexModel{Keys: s.Keys, Options: indexOptions}
 }
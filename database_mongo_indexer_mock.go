@@ -50,3 +50,13 @@ func (m *MockMongoIndexer) Execute() error {
 	args := m.Called()
 	return args.Error(0)
 }
+
+func (m *MockMongoIndexer) Declare(coll string, indexes ...MongoIndexSpec) {
+	m.Called(coll, indexes)
+}
+
+func (m *MockMongoIndexer) Sync(options *MongoIndexSyncOptions) ([]MongoIndexDrift, error) {
+	args := m.Called(options)
+	drifts, _ := args.Get(0).([]MongoIndexDrift)
+	return drifts, args.Error(1)
+}
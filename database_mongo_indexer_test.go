@@ -2,6 +2,8 @@ package core
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
 	"testing"
 )
 
@@ -41,3 +43,63 @@ func TestMongoIndexer_Execute(t *testing.T) {
 	mg.AssertNumberOfCalls(t, "Add", 1)
 	mg.AssertNumberOfCalls(t, "Execute", 1)
 }
+
+func newMongoIndexerTestContext(db *MockMongoDB) IContext {
+	return newTestContext(&ContextOptions{MongoDB: db})
+}
+
+func TestMongoIndexer_Sync(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("ListIndex", "users", mock.Anything).Return([]MongoListIndexResult{
+		{Name: "_id_", Keys: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}},
+		{Name: "name_1", Keys: bson.D{{Key: "name", Value: int32(1)}}},
+	}, nil)
+	db.On("CreateIndex", "users", mock.Anything, mock.Anything).Return([]string{"created_at_-1"}, nil)
+	db.On("DropIndex", "users", "name_1", mock.Anything).Return(&MongoDropIndexResult{}, nil)
+
+	indexer := NewMongoIndexer(newMongoIndexerTestContext(db))
+	indexer.Declare("users",
+		MongoIndexSpec{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		MongoIndexSpec{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	)
+
+	drifts, err := indexer.Sync(&MongoIndexSyncOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []MongoIndexDrift{
+		{Collection: "users", Name: "email_1", Drift: MongoIndexDriftChanged},
+		{Collection: "users", Name: "created_at_-1", Drift: MongoIndexDriftMissing},
+		{Collection: "users", Name: "name_1", Drift: MongoIndexDriftUndeclared},
+	}, drifts)
+	db.AssertNotCalled(t, "CreateIndex", mock.Anything, mock.Anything, mock.Anything)
+
+	drifts, err = indexer.Sync(&MongoIndexSyncOptions{DropUndeclared: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []MongoIndexDrift{
+		{Collection: "users", Name: "email_1", Drift: MongoIndexDriftChanged},
+		{Collection: "users", Name: "created_at_-1", Drift: MongoIndexDriftMissing, Fixed: true},
+		{Collection: "users", Name: "name_1", Drift: MongoIndexDriftUndeclared, Fixed: true},
+	}, drifts)
+	db.AssertNumberOfCalls(t, "CreateIndex", 1)
+	db.AssertNotCalled(t, "DropIndex", "users", "email_1", mock.Anything)
+}
+
+func TestMongoIndexSpec_Matches(t *testing.T) {
+	data, err := bson.Marshal(bson.D{
+		{Key: "v", Value: int32(2)},
+		{Key: "key", Value: bson.D{{Key: "status", Value: int32(1)}, {Key: "created_at", Value: float64(-1)}, {Key: "_fts", Value: "text"}}},
+		{Key: "name", Value: "search"},
+	})
+	assert.NoError(t, err)
+
+	index := MongoListIndexResult{}
+	assert.NoError(t, bson.Unmarshal(data, &index))
+	assert.Equal(t, map[string]int64{"status": 1, "created_at": -1, "_fts": 0}, index.Key)
+	assert.Equal(t, int64(2), index.Version)
+
+	spec := MongoIndexSpec{Name: "search", Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_fts", Value: "text"}}}
+	assert.True(t, spec.matches(index))
+
+	spec.Keys = bson.D{{Key: "created_at", Value: -1}, {Key: "status", Value: 1}, {Key: "_fts", Value: "text"}}
+	assert.False(t, spec.matches(index))
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const DefaultMongoMigrationCollection = "mongo_migrations"
+
+const (
+	MongoMigrationStatusRunning = "running"
+	MongoMigrationStatusDone    = "done"
+)
+
+type MongoMigration struct {
+	// Version order the migrations, it is usually a timestamp like 20230401120000
+	Version string
+	Name    string
+	Up      func(db IMongoDB) error
+	// Down revert Up, the migration cannot be rolled back when it is nil
+	Down func(db IMongoDB) error
+}
+
+func (m *MongoMigration) version() string {
+	return m.Version
+}
+
+func (m *MongoMigration) name() string {
+	return m.Name
+}
+
+func (m *MongoMigration) hasUp() bool {
+	return m.Up != nil
+}
+
+func (m *MongoMigration) hasDown() bool {
+	return m.Down != nil
+}
+
+// MongoMigrationRecord is a started migration in the bookkeeping collection, its _id is the version
+type MongoMigrationRecord struct {
+	Version string `json:"version" bson:"_id"`
+	Name    string `json:"name" bson:"name"`
+	// Status is MongoMigrationStatusRunning while Up runs then MongoMigrationStatusDone, a record without status is done
+	Status    string    `json:"status" bson:"status,omitempty"`
+	StartedAt time.Time `json:"started_at" bson:"started_at,omitempty"`
+	AppliedAt time.Time `json:"applied_at" bson:"applied_at,omitempty"`
+}
+
+func (r MongoMigrationRecord) running() bool {
+	return r.Status == MongoMigrationStatusRunning
+}
+
+func (r MongoMigrationRecord) status() MigrationStatus {
+	if r.running() {
+		return MigrationStatus{Version: r.Version, Name: r.Name, Running: true}
+	}
+
+	return MigrationStatus{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: &r.AppliedAt}
+}
+
+type IMongoMigrator interface {
+	Add(migrations ...*MongoMigration)
+	// Up apply the pending migrations in version order, it returns the applied migrations and stops at the first error
+	Up() ([]MigrationStatus, error)
+	// Down revert the last steps applied migrations, it returns the reverted migrations
+	Down(steps int) ([]MigrationStatus, error)
+	Status() ([]MigrationStatus, error)
+}
+
+type MongoMigratorOptions struct {
+	// Collection is the bookkeeping collection, defaults to DefaultMongoMigrationCollection
+	Collection string
+}
+
+type MongoMigrator struct {
+	db         IMongoDB
+	options    MongoMigratorOptions
+	migrations []*MongoMigration
+}
+
+// NewMongoMigrator create a migrator recording the applied versions in a bookkeeping collection, so every migration is applied once.
+// A version is recorded as running before its migration runs, another process running the migrator at the same time
+// stops at this version instead of applying the next ones. A process dying during a migration leaves its version
+// running, Up then fails until its record is deleted from the collection
+func NewMongoMigrator(db IMongoDB, options *MongoMigratorOptions) IMongoMigrator {
+	migratorOptions := MongoMigratorOptions{}
+	if options != nil {
+		migratorOptions = *options
+	}
+
+	if migratorOptions.Collection == "" {
+		migratorOptions.Collection = DefaultMongoMigrationCollection
+	}
+
+	return &MongoMigrator{db: db, options: migratorOptions}
+}
+
+func (m *MongoMigrator) Add(migrations ...*MongoMigration) {
+	m.migrations = append(m.migrations, migrations...)
+}
+
+// applied return the records of the bookkeeping collection by version
+func (m *MongoMigrator) applied() (map[string]MongoMigrationRecord, error) {
+	list := make([]MongoMigrationRecord, 0)
+	err := m.db.Find(&list, m.options.Collection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]MongoMigrationRecord, len(list))
+	for _, record := range list {
+		records[record.Version] = record
+	}
+
+	return records, nil
+}
+
+// errRunning is the error of a version which another process is migrating, or which was interrupted
+func (m *MongoMigrator) errRunning(version string, name string) error {
+	return fmt.Errorf("migration: %s_%s is running in another process, delete its record from %s if that process died",
+		version, name, m.options.Collection)
+}
+
+// start record migration as running, it returns false when the version is already done
+func (m *MongoMigrator) start(migration *MongoMigration) (bool, error) {
+	record := &MongoMigrationRecord{Version: migration.Version, Name: migration.Name, Status: MongoMigrationStatusRunning, StartedAt: time.Now().UTC()}
+	_, err := m.db.Create(m.options.Collection, record)
+	if !mongo.IsDuplicateKeyError(err) {
+		return err == nil, err
+	}
+
+	existing := &MongoMigrationRecord{}
+	err = m.db.FindOne(existing, m.options.Collection, bson.M{"_id": migration.Version})
+	if err != nil {
+		return false, err
+	}
+
+	if existing.running() {
+		return false, m.errRunning(migration.Version, migration.Name)
+	}
+
+	return false, nil
+}
+
+func (m *MongoMigrator) Up() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	for _, migration := range migrations {
+		if record, ok := applied[migration.Version]; ok {
+			if record.running() {
+				return statuses, m.errRunning(migration.Version, migration.Name)
+			}
+
+			continue
+		}
+
+		started, err := m.start(migration)
+		if err != nil {
+			return statuses, err
+		}
+
+		if !started {
+			continue
+		}
+
+		err = migration.Up(m.db)
+		if err != nil {
+			_, _ = m.db.DeleteOne(m.options.Collection, bson.M{"_id": migration.Version})
+			return statuses, fmt.Errorf("migration: %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = m.db.UpdateOne(m.options.Collection, bson.M{"_id": migration.Version}, bson.M{"$set": bson.M{
+			"status":     MongoMigrationStatusDone,
+			"applied_at": time.Now().UTC(),
+		}})
+		if err != nil {
+			return statuses, err
+		}
+
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: true})
+	}
+
+	return statuses, nil
+}
+
+func (m *MongoMigrator) Down(steps int) ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range applied {
+		if record.running() {
+			return nil, m.errRunning(record.Version, record.Name)
+		}
+	}
+
+	reverted, err := revertMigrations(migrations, applied, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	for _, migration := range reverted {
+		err = migration.Down(m.db)
+		if err != nil {
+			return statuses, fmt.Errorf("migration: %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = m.db.DeleteOne(m.options.Collection, bson.M{"_id": migration.Version})
+		if err != nil {
+			return statuses, err
+		}
+
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name})
+	}
+
+	return statuses, nil
+}
+
+func (m *MongoMigrator) Status() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(migrations, applied), nil
+}
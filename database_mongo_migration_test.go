@@ -0,0 +1,125 @@
+package core
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+func TestMongoMigrator_Up(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("Find", mock.Anything, DefaultMongoMigrationCollection, bson.M{}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		records := args.Get(0).(*[]MongoMigrationRecord)
+		*records = append(*records, MongoMigrationRecord{Version: "1", Name: "init", AppliedAt: time.Now()})
+	})
+	db.On("Create", DefaultMongoMigrationCollection, mock.Anything, mock.Anything).Return(&mongo.InsertOneResult{}, nil)
+	db.On("UpdateOne", DefaultMongoMigrationCollection, bson.M{"_id": "2"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	migrator := NewMongoMigrator(db, nil)
+	ran := make([]string, 0)
+	for _, name := range []string{"init", "backfill_status"} {
+		name := name
+		version := "1"
+		if name == "backfill_status" {
+			version = "2"
+		}
+
+		migrator.Add(&MongoMigration{Version: version, Name: name, Up: func(db IMongoDB) error {
+			ran = append(ran, name)
+			return nil
+		}})
+	}
+
+	statuses, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationStatus{{Version: "2", Name: "backfill_status", Applied: true}}, statuses)
+	assert.Equal(t, []string{"backfill_status"}, ran)
+	db.AssertNumberOfCalls(t, "Create", 1)
+	assert.Equal(t, MongoMigrationStatusRunning, db.Calls[1].Arguments.Get(1).(*MongoMigrationRecord).Status)
+	assert.Equal(t, MongoMigrationStatusDone, db.Calls[2].Arguments.Get(2).(bson.M)["$set"].(bson.M)["status"])
+}
+
+func TestMongoMigrator_UpRunningInAnotherProcess(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("Find", mock.Anything, DefaultMongoMigrationCollection, bson.M{}, mock.Anything).Return(nil)
+	db.On("Create", DefaultMongoMigrationCollection, mock.Anything, mock.Anything).
+		Return(&mongo.InsertOneResult{}, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})
+	db.On("FindOne", mock.Anything, DefaultMongoMigrationCollection, bson.M{"_id": "1"}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*MongoMigrationRecord) = MongoMigrationRecord{Version: "1", Name: "init", Status: MongoMigrationStatusRunning}
+	})
+
+	ran := false
+	migrator := NewMongoMigrator(db, nil)
+	migrator.Add(&MongoMigration{Version: "1", Name: "init", Up: func(db IMongoDB) error {
+		return nil
+	}}, &MongoMigration{Version: "2", Name: "backfill", Up: func(db IMongoDB) error {
+		ran = true
+		return nil
+	}})
+
+	statuses, err := migrator.Up()
+	assert.EqualError(t, err, "migration: 1_init is running in another process, delete its record from mongo_migrations if that process died")
+	assert.Empty(t, statuses)
+	assert.False(t, ran)
+	db.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestMongoMigrator_UpInterrupted(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("Find", mock.Anything, DefaultMongoMigrationCollection, bson.M{}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		records := args.Get(0).(*[]MongoMigrationRecord)
+		*records = append(*records, MongoMigrationRecord{Version: "1", Name: "init", Status: MongoMigrationStatusRunning})
+	})
+
+	migrator := NewMongoMigrator(db, nil)
+	migrator.Add(&MongoMigration{Version: "1", Name: "init", Up: func(db IMongoDB) error {
+		return nil
+	}})
+
+	_, err := migrator.Up()
+	assert.Error(t, err)
+	db.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+
+	statuses, err := migrator.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationStatus{{Version: "1", Name: "init", Running: true}}, statuses)
+}
+
+func TestMongoMigrator_UpError(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("Find", mock.Anything, DefaultMongoMigrationCollection, bson.M{}, mock.Anything).Return(nil)
+	db.On("Create", DefaultMongoMigrationCollection, mock.Anything, mock.Anything).Return(&mongo.InsertOneResult{}, nil)
+	db.On("DeleteOne", DefaultMongoMigrationCollection, bson.M{"_id": "1"}, mock.Anything).Return(&mongo.DeleteResult{}, nil)
+
+	migrator := NewMongoMigrator(db, nil)
+	migrator.Add(&MongoMigration{Version: "1", Name: "broken", Up: func(db IMongoDB) error {
+		return errors.New("invalid document")
+	}})
+
+	_, err := migrator.Up()
+	assert.EqualError(t, err, "migration: 1_broken failed: invalid document")
+	db.AssertCalled(t, "DeleteOne", DefaultMongoMigrationCollection, bson.M{"_id": "1"}, mock.Anything)
+}
+
+func TestMongoMigrator_Status(t *testing.T) {
+	db := NewMockMongoDB()
+	db.On("Find", mock.Anything, DefaultMongoMigrationCollection, bson.M{}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		records := args.Get(0).(*[]MongoMigrationRecord)
+		*records = append(*records, MongoMigrationRecord{Version: "0", Name: "removed", AppliedAt: time.Now()})
+	})
+
+	migrator := NewMongoMigrator(db, nil)
+	migrator.Add(&MongoMigration{Version: "1", Name: "init", Up: func(db IMongoDB) error {
+		return nil
+	}})
+
+	statuses, err := migrator.Status()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Missing)
+	assert.False(t, statuses[1].Applied)
+}
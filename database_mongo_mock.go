@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -14,6 +16,10 @@ func NewMockMongoDB() *MockMongoDB {
 	return &MockMongoDB{}
 }
 
+func (m *MockMongoDB) WithContext(ctx context.Context) IMongoDB {
+	return m
+}
+
 func (m *MockMongoDB) Close() {
 	m.Called()
 }
@@ -98,3 +104,32 @@ func (m *MockMongoDB) DB() *mongo.Database {
 func (m *MockMongoDB) Helper() IMongoDBHelper {
 	return NewMongoHelper()
 }
+
+func (m *MockMongoDB) CreateIndex(coll string, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) ([]string, error) {
+	args := m.Called(coll, models, opts)
+	names, _ := args.Get(0).([]string)
+	return names, args.Error(1)
+}
+
+func (m *MockMongoDB) DropIndex(coll string, name string, opts ...*options.DropIndexesOptions) (*MongoDropIndexResult, error) {
+	args := m.Called(coll, name, opts)
+	result, _ := args.Get(0).(*MongoDropIndexResult)
+	return result, args.Error(1)
+}
+
+func (m *MockMongoDB) DropAll(coll string, opts ...*options.DropIndexesOptions) (*MongoDropIndexResult, error) {
+	args := m.Called(coll, opts)
+	result, _ := args.Get(0).(*MongoDropIndexResult)
+	return result, args.Error(1)
+}
+
+func (m *MockMongoDB) ListIndex(coll string, opts ...*options.ListIndexesOptions) ([]MongoListIndexResult, error) {
+	args := m.Called(coll, opts)
+	results, _ := args.Get(0).([]MongoListIndexResult)
+	return results, args.Error(1)
+}
+
+func (m *MockMongoDB) FindAggregatePaginationCustomTotal(dest interface{}, coll string, pipeline []bson.M, pipelineTotalCount []bson.M, pageOptions *PageOptions, opts ...*options.AggregateOptions) (*PageResponse, error) {
+	args := m.Called(dest, coll, pipeline, pipelineTotalCount, pageOptions, opts)
+	return args.Get(0).(*PageResponse), args.Error(1)
+}
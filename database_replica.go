@@ -0,0 +1,91 @@
+package core
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	dbReplicasPlugin        = "mine-core:db_replicas"
+	dbReplicasRestorePlugin = "mine-core:db_replicas_restore"
+	dbPrimarySettings       = "mine-core:db_primary"
+	dbReplicaSettings       = "mine-core:db_replica"
+)
+
+// dbReplicas route the reads to the replicas in turn. The writes, the locking reads, the reads forced by DBPrimary and
+// every query of a transaction or of a dedicated connection stay on the primary
+type dbReplicas struct {
+	primary  gorm.ConnPool
+	replicas []gorm.ConnPool
+	next     uint32
+}
+
+func (r *dbReplicas) Name() string {
+	return dbReplicasPlugin
+}
+
+func (r *dbReplicas) Initialize(db *gorm.DB) error {
+	r.primary = db.ConnPool
+	err := db.Callback().Query().Before("*").Register(dbReplicasPlugin, r.route)
+	if err == nil {
+		err = db.Callback().Query().After("*").Register(dbReplicasRestorePlugin, r.restore)
+	}
+
+	if err == nil {
+		err = db.Callback().Row().Before("*").Register(dbReplicasPlugin, r.route)
+	}
+
+	if err == nil {
+		err = db.Callback().Row().After("*").Register(dbReplicasRestorePlugin, r.restore)
+	}
+
+	return err
+}
+
+func (r *dbReplicas) route(db *gorm.DB) {
+	// a transaction or a connection from db.Connection
+	if len(r.replicas) == 0 || db.Statement.ConnPool != r.primary {
+		return
+	}
+
+	if _, ok := db.Statement.Settings.Load(dbPrimarySettings); ok {
+		return
+	}
+
+	if _, locking := db.Statement.Clauses["FOR"]; locking {
+		return
+	}
+
+	if sql := strings.ToUpper(strings.TrimSpace(db.Statement.SQL.String())); sql != "" && (!strings.HasPrefix(sql, "SELECT") || strings.HasSuffix(sql, "FOR UPDATE")) {
+		return
+	}
+
+	i := atomic.AddUint32(&r.next, 1) - 1
+	db.Statement.ConnPool = r.replicas[int(i%uint32(len(r.replicas)))]
+	db.Statement.Settings.Store(dbReplicaSettings, true)
+}
+
+// restore put the primary back on the statement after a read, a chain like repository.BaseRepository reuses its
+// statement for the next queries, which would otherwise write to the replica
+func (r *dbReplicas) restore(db *gorm.DB) {
+	if _, ok := db.Statement.Settings.LoadAndDelete(dbReplicaSettings); ok {
+		db.Statement.ConnPool = r.primary
+	}
+}
+
+// DBUseReplicas route the reads of db to replicas, e.g. connections of the DBS map. The writes and the transactions
+// stay on db, a read which must see a write made just before goes to the primary with DBPrimary
+func DBUseReplicas(db *gorm.DB, replicas ...*gorm.DB) error {
+	pools := make([]gorm.ConnPool, 0, len(replicas))
+	for _, replica := range replicas {
+		pools = append(pools, replica.ConnPool)
+	}
+
+	return db.Use(&dbReplicas{replicas: pools})
+}
+
+// DBPrimary return db reading from the primary even when it has replicas
+func DBPrimary(db *gorm.DB) *gorm.DB {
+	return db.Set(dbPrimarySettings, true)
+}
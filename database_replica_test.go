@@ -0,0 +1,144 @@
+package core
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type replicaTestUser struct {
+	ID   int
+	Name string
+}
+
+func newReplicaTestDatabases(t *testing.T) (*MockDatabase, *MockDatabase, *MockDatabase) {
+	primary := NewMockDatabase()
+	replica1 := NewMockDatabase()
+	replica2 := NewMockDatabase()
+	assert.NoError(t, DBUseReplicas(primary.Gorm, replica1.Gorm, replica2.Gorm))
+
+	return primary, replica1, replica2
+}
+
+func replicaTestRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "john")
+}
+
+func TestDBUseReplicas_ReadsGoToReplicas(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	replica1.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+	replica2.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+	replica1.Mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	users := make([]replicaTestUser, 0)
+	assert.NoError(t, primary.Gorm.Find(&users).Error)
+	assert.NoError(t, primary.Gorm.Find(&users).Error)
+
+	var count int64
+	assert.NoError(t, primary.Gorm.Model(&replicaTestUser{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBUseReplicas_WritesGoToPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	primary.Mock.ExpectBegin()
+	primary.Mock.ExpectExec("INSERT INTO `replica_test_users`").WillReturnResult(sqlmock.NewResult(1, 1))
+	primary.Mock.ExpectCommit()
+	primary.Mock.ExpectExec("UPDATE `replica_test_users`").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, primary.Gorm.Create(&replicaTestUser{Name: "john"}).Error)
+	assert.NoError(t, primary.Gorm.Exec("UPDATE `replica_test_users` SET name = ?", "doe").Error)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBUseReplicas_TransactionReadsGoToPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	primary.Mock.ExpectBegin()
+	primary.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+	primary.Mock.ExpectCommit()
+
+	err := primary.Gorm.Transaction(func(tx *gorm.DB) error {
+		users := make([]replicaTestUser, 0)
+		return tx.Find(&users).Error
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	primary.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+	primary.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+
+	users := make([]replicaTestUser, 0)
+	assert.NoError(t, DBPrimary(primary.Gorm).Find(&users).Error)
+	assert.NoError(t, primary.Gorm.Raw("SELECT * FROM `replica_test_users` FOR UPDATE").Scan(&users).Error)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBUseReplicas_IdempotencyStoreReadsPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	primary.Mock.ExpectQuery("SELECT \\* FROM `idempotency_keys`").
+		WillReturnRows(sqlmock.NewRows([]string{"idempotency_key", "record"}).AddRow("key", `{"status":201}`))
+
+	record, err := NewDBIdempotencyStore(primary.Gorm).Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 201, record.Status)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBUseReplicas_ReusedChainWritesGoToPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	replica1.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+	primary.Mock.ExpectBegin()
+	primary.Mock.ExpectExec("INSERT INTO `replica_test_users`").WillReturnResult(sqlmock.NewResult(2, 1))
+	primary.Mock.ExpectCommit()
+	replica2.Mock.ExpectQuery("SELECT \\* FROM `replica_test_users`").WillReturnRows(replicaTestRows())
+
+	db := primary.Gorm.Model(&replicaTestUser{})
+	users := make([]replicaTestUser, 0)
+	assert.NoError(t, db.Find(&users).Error)
+	assert.NoError(t, db.Create(&replicaTestUser{Name: "doe"}).Error)
+	assert.NoError(t, db.Find(&users).Error)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
+
+func TestDBUseReplicas_MigratorStatusReadsPrimary(t *testing.T) {
+	primary, replica1, replica2 := newReplicaTestDatabases(t)
+	expectDBMigrationTable(primary, true)
+	primary.Mock.ExpectQuery("SELECT \\* FROM `schema_migrations`").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name"}).AddRow("1", "create_users"))
+
+	migrator := NewDBMigrator(primary.Gorm, nil)
+	migrator.Add(&DBMigration{Version: "1", Name: "create_users", Up: func(tx *gorm.DB) error {
+		return nil
+	}})
+
+	statuses, err := migrator.Status()
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+
+	assert.NoError(t, primary.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica1.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica2.Mock.ExpectationsWereMet())
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -10,6 +11,7 @@ import (
 	"github.com/tidwall/gjson"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"reflect"
 )
 
@@ -21,15 +23,22 @@ type ELS struct {
 
 type els struct {
 	connection *elasticsearch.Client
+	ctx        context.Context
 }
 
 type IELS interface {
 	Client() *elasticsearch.Client
+	WithContext(ctx context.Context) IELS
 	CreateIndex(name string, body map[string]interface{}, options *ELSCreateIndexOptions) error
 	Create(dest interface{}, index string, id string, body interface{}, options *ELSCreateIndexOptions) (*esapi.Response, error)
 	CreateOrUpdate(dest interface{}, index string, id string, body interface{}, options *ELSUpdateOptions) (*esapi.Response, error)
 	Update(dest interface{}, index string, id string, body interface{}, options *ELSUpdateOptions) (*esapi.Response, error)
 	SearchPagination(dest interface{}, index string, body map[string]interface{}, pageOptions *PageOptions, opts *ELSCreateSearchOptions) (*PageResponse, error)
+	DeleteIndex(names ...string) error
+	Reindex(source string, dest string) error
+	AliasIndices(alias string) ([]string, error)
+	SwapAlias(alias string, index string) ([]string, error)
+	ReindexAlias(alias string, index string, body map[string]interface{}, options *ELSReindexAliasOptions) error
 }
 
 func (e ELS) Connect() (IELS, error) {
@@ -42,7 +51,7 @@ func (e ELS) Connect() (IELS, error) {
 		return nil, err
 	}
 
-	return &els{connection: client}, nil
+	return &els{connection: client, ctx: context.Background()}, nil
 }
 
 func NewELS(env *ENVConfig) *ELS {
@@ -57,17 +66,31 @@ func (e els) Client() *elasticsearch.Client {
 	return e.connection
 }
 
+// WithContext return a copy of the client that sends every request with ctx
+func (e els) WithContext(ctx context.Context) IELS {
+	e.ctx = ctx
+	return &e
+}
+
+func (e els) getContext() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+
+	return e.ctx
+}
+
 type ELSCreateIndexOptions struct {
 }
 
 func (e els) CreateIndex(name string, body map[string]interface{}, options *ELSCreateIndexOptions) error {
-	_, err := e.Client().Indices.Create(name)
+	_, err := e.Client().Indices.Create(name, e.Client().Indices.Create.WithContext(e.getContext()))
 	if err != nil {
 		return err
 	}
 
 	if body != nil {
-		res, err := e.Client().Indices.PutMapping(e.interfaceToReader(body), e.Client().Indices.PutMapping.WithIndex(name))
+		res, err := e.Client().Indices.PutMapping(e.interfaceToReader(body), e.Client().Indices.PutMapping.WithIndex(name), e.Client().Indices.PutMapping.WithContext(e.getContext()))
 		if err != nil {
 			return err
 		}
@@ -84,7 +107,7 @@ type ELSCreateCreateOptions struct {
 }
 
 func (e els) Create(dest interface{}, index string, id string, body interface{}, options *ELSCreateIndexOptions) (*esapi.Response, error) {
-	res, err := e.Client().Create(index, id, e.interfaceToReader(body))
+	res, err := e.Client().Create(index, id, e.interfaceToReader(body), e.Client().Create.WithContext(e.getContext()))
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +130,7 @@ func (e els) getFrom(pageOptions *PageOptions) int64 {
 func (e els) SearchPagination(dest interface{}, index string, body map[string]interface{}, pageOptions *PageOptions, opts *ELSCreateSearchOptions) (*PageResponse, error) {
 	body["from"] = e.getFrom(pageOptions)
 	body["size"] = pageOptions.Limit
-	res, err := e.Client().Search(e.Client().Search.WithBody(bytes.NewBufferString(utils.JSONToString(body))), e.Client().Search.WithIndex(index))
+	res, err := e.Client().Search(e.Client().Search.WithBody(bytes.NewBufferString(utils.JSONToString(body))), e.Client().Search.WithIndex(index), e.Client().Search.WithContext(e.getContext()))
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +161,7 @@ func (e els) CreateOrUpdate(dest interface{}, index string, id string, body inte
 		"doc":           body,
 		"doc_as_upsert": true,
 	}
-	res, err := e.Client().Update(index, id, e.interfaceToReader(newBody))
+	res, err := e.Client().Update(index, id, e.interfaceToReader(newBody), e.Client().Update.WithContext(e.getContext()))
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +176,7 @@ func (e els) CreateOrUpdate(dest interface{}, index string, id string, body inte
 }
 
 func (e els) Update(dest interface{}, index string, id string, body interface{}, options *ELSUpdateOptions) (*esapi.Response, error) {
-	res, err := e.Client().Update(index, id, e.interfaceToReader(body))
+	res, err := e.Client().Update(index, id, e.interfaceToReader(body), e.Client().Update.WithContext(e.getContext()))
 	if err != nil {
 		return nil, err
 	}
@@ -172,3 +195,159 @@ func (e els) interfaceToReader(body interface{}) io.Reader {
 	_ = json.NewEncoder(&buf).Encode(body)
 	return &buf
 }
+
+func (e els) DeleteIndex(names ...string) error {
+	res, err := e.Client().Indices.Delete(names, e.Client().Indices.Delete.WithContext(e.getContext()))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+
+	return nil
+}
+
+// Reindex copy the documents of source into dest and wait until they are searchable
+func (e els) Reindex(source string, dest string) error {
+	body := Map{
+		"source": Map{"index": source},
+		"dest":   Map{"index": dest},
+	}
+	res, err := e.Client().Reindex(e.interfaceToReader(body),
+		e.Client().Reindex.WithWaitForCompletion(true),
+		e.Client().Reindex.WithRefresh(true),
+		e.Client().Reindex.WithContext(e.getContext()))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+
+	resByte, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	failures := gjson.GetBytes(resByte, "failures")
+	if len(failures.Array()) > 0 {
+		return errors.New(failures.Raw)
+	}
+
+	return nil
+}
+
+// AliasIndices return the indices behind alias, it is empty when alias does not exist
+func (e els) AliasIndices(alias string) ([]string, error) {
+	res, err := e.Client().Indices.GetAlias(e.Client().Indices.GetAlias.WithName(alias), e.Client().Indices.GetAlias.WithContext(e.getContext()))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	indices := make(map[string]interface{})
+	err = json.NewDecoder(res.Body).Decode(&indices)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// SwapAlias point alias to index only, in a single atomic update, it returns the indices alias pointed to before
+func (e els) SwapAlias(alias string, index string) ([]string, error) {
+	previous, err := e.AliasIndices(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]Map, 0, len(previous)+1)
+	for _, name := range previous {
+		if name != index {
+			actions = append(actions, Map{"remove": Map{"index": name, "alias": alias}})
+		}
+	}
+	actions = append(actions, Map{"add": Map{"index": index, "alias": alias}})
+
+	res, err := e.Client().Indices.UpdateAliases(e.interfaceToReader(Map{"actions": actions}), e.Client().Indices.UpdateAliases.WithContext(e.getContext()))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	return previous, nil
+}
+
+type ELSReindexAliasOptions struct {
+	// DeleteOld delete the indices alias pointed to once it points to the new index
+	DeleteOld bool
+}
+
+// ReindexAlias change the settings or mappings of alias without downtime, it creates index with body, the settings and mappings
+// of a create index request, copies the documents of the indices behind alias into it then points alias to it.
+// The documents written to the old indices during the reindex are not copied
+func (e els) ReindexAlias(alias string, index string, body map[string]interface{}, options *ELSReindexAliasOptions) error {
+	if options == nil {
+		options = &ELSReindexAliasOptions{}
+	}
+
+	previous, err := e.AliasIndices(alias)
+	if err != nil {
+		return err
+	}
+
+	createOptions := []func(*esapi.IndicesCreateRequest){e.Client().Indices.Create.WithContext(e.getContext())}
+	if body != nil {
+		createOptions = append(createOptions, e.Client().Indices.Create.WithBody(e.interfaceToReader(body)))
+	}
+
+	res, err := e.Client().Indices.Create(index, createOptions...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+
+	for _, name := range previous {
+		err = e.Reindex(name, index)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = e.SwapAlias(alias, index)
+	if err != nil {
+		return err
+	}
+
+	if options.DeleteOld && len(previous) > 0 {
+		return e.DeleteIndex(previous...)
+	}
+
+	return nil
+}
@@ -1,6 +1,16 @@
 package core
 
-import "log"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/pskclub/mine-core/utils"
+	"net/http"
+	"time"
+)
+
+const DefaultELSMigrationIndex = "els_migrations"
 
 type ELSMigration struct {
 	ctx IContext
@@ -14,9 +24,279 @@ func NewELSMigration(options *ContextOptions) *ELSMigration {
 	return &ELSMigration{ctx: NewContext(options)}
 }
 
-func (e ELSMigration) Add(f func(ctx IContext) IELSMigration) {
+// Add run the migration right away, it runs on every start, see NewELSMigrator for the migrations applied once.
+// The error is logged and returned
+func (e ELSMigration) Add(f func(ctx IContext) IELSMigration) error {
 	err := f(e.ctx).Up()
 	if err != nil {
-		log.Fatal(err)
+		e.ctx.Log().Error(err)
+	}
+
+	return err
+}
+
+type ELSVersionedMigration struct {
+	// Version order the migrations, it is usually a timestamp like 20230401120000
+	Version string
+	Name    string
+	Up      func(els IELS) error
+	// Down revert Up, the migration cannot be rolled back when it is nil
+	Down func(els IELS) error
+}
+
+func (m *ELSVersionedMigration) version() string {
+	return m.Version
+}
+
+func (m *ELSVersionedMigration) name() string {
+	return m.Name
+}
+
+func (m *ELSVersionedMigration) hasUp() bool {
+	return m.Up != nil
+}
+
+func (m *ELSVersionedMigration) hasDown() bool {
+	return m.Down != nil
+}
+
+// ELSMigrationRecord is an applied migration in the bookkeeping index, its document id is the version
+type ELSMigrationRecord struct {
+	Version   string    `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (r ELSMigrationRecord) status() MigrationStatus {
+	return MigrationStatus{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: &r.AppliedAt}
+}
+
+type IELSMigrator interface {
+	Add(migrations ...*ELSVersionedMigration)
+	// Up apply the pending migrations in version order, it returns the applied migrations and stops at the first error
+	Up() ([]MigrationStatus, error)
+	// Down revert the last steps applied migrations, it returns the reverted migrations
+	Down(steps int) ([]MigrationStatus, error)
+	Status() ([]MigrationStatus, error)
+}
+
+type ELSMigratorOptions struct {
+	// Index is the bookkeeping index, defaults to DefaultELSMigrationIndex
+	Index string
+}
+
+type ELSMigrator struct {
+	els        IELS
+	options    ELSMigratorOptions
+	migrations []*ELSVersionedMigration
+}
+
+// NewELSMigrator create a migrator recording the applied versions in a bookkeeping index, so every migration is applied once.
+// The migrator does not lock, it must run from a single process like a release job
+func NewELSMigrator(els IELS, options *ELSMigratorOptions) IELSMigrator {
+	migratorOptions := ELSMigratorOptions{}
+	if options != nil {
+		migratorOptions = *options
+	}
+
+	if migratorOptions.Index == "" {
+		migratorOptions.Index = DefaultELSMigrationIndex
+	}
+
+	return &ELSMigrator{els: els, options: migratorOptions}
+}
+
+func (m *ELSMigrator) Add(migrations ...*ELSVersionedMigration) {
+	m.migrations = append(m.migrations, migrations...)
+}
+
+// ensureIndex create the bookkeeping index when it does not exist
+func (m *ELSMigrator) ensureIndex() error {
+	client := m.els.Client()
+	res, err := client.Indices.Exists([]string{m.options.Index})
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body := Map{
+		"mappings": Map{
+			"properties": Map{
+				"version":    Map{"type": "keyword"},
+				"name":       Map{"type": "keyword"},
+				"applied_at": Map{"type": "date"},
+			},
+		},
+	}
+	res, err = client.Indices.Create(m.options.Index, client.Indices.Create.WithBody(bytes.NewBufferString(utils.JSONToString(body))))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+
+	return nil
+}
+
+// applied return the records of the bookkeeping index by version, it is empty when the index does not exist
+func (m *ELSMigrator) applied() (map[string]ELSMigrationRecord, error) {
+	client := m.els.Client()
+	body := Map{"size": 10000, "query": Map{"match_all": Map{}}}
+	res, err := client.Search(client.Search.WithIndex(m.options.Index), client.Search.WithBody(bytes.NewBufferString(utils.JSONToString(body))))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	records := make(map[string]ELSMigrationRecord)
+	if res.StatusCode == http.StatusNotFound {
+		return records, nil
+	}
+
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	result := struct {
+		Hits struct {
+			Hits []struct {
+				Source ELSMigrationRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range result.Hits.Hits {
+		records[hit.Source.Version] = hit.Source
+	}
+
+	return records, nil
+}
+
+func (m *ELSMigrator) record(migration *ELSVersionedMigration) error {
+	client := m.els.Client()
+	record := ELSMigrationRecord{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}
+	res, err := client.Index(m.options.Index, bytes.NewBufferString(utils.JSONToString(record)),
+		client.Index.WithDocumentID(migration.Version), client.Index.WithRefresh("true"))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+
+	return nil
+}
+
+func (m *ELSMigrator) unrecord(migration *ELSVersionedMigration) error {
+	client := m.els.Client()
+	res, err := client.Delete(m.options.Index, migration.Version, client.Delete.WithRefresh("true"))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return errors.New(res.String())
+	}
+
+	return nil
+}
+
+func (m *ELSMigrator) Up() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.ensureIndex()
+	if err != nil {
+		return nil, err
 	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err = migration.Up(m.els)
+		if err != nil {
+			return statuses, fmt.Errorf("migration: %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		err = m.record(migration)
+		if err != nil {
+			return statuses, err
+		}
+
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: true})
+	}
+
+	return statuses, nil
+}
+
+func (m *ELSMigrator) Down(steps int) ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted, err := revertMigrations(migrations, applied, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0)
+	for _, migration := range reverted {
+		err = migration.Down(m.els)
+		if err != nil {
+			return statuses, fmt.Errorf("migration: %s_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		err = m.unrecord(migration)
+		if err != nil {
+			return statuses, err
+		}
+
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name})
+	}
+
+	return statuses, nil
+}
+
+func (m *ELSMigrator) Status() ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(migrations, applied), nil
 }
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// elsMigrationTestServer fake the bookkeeping index and the alias api of Elasticsearch
+type elsMigrationTestServer struct {
+	mutex    sync.Mutex
+	indices  map[string]bool
+	records  map[string]json.RawMessage
+	aliases  map[string][]string
+	requests []string
+}
+
+func newELSMigrationTestServer(t *testing.T) (*elsMigrationTestServer, IELS) {
+	server := &elsMigrationTestServer{indices: map[string]bool{}, records: map[string]json.RawMessage{}, aliases: map[string][]string{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{httpServer.URL}})
+	assert.NoError(t, err)
+	return server, &els{connection: client}
+}
+
+func (s *elsMigrationTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		_, _ = w.Write([]byte(`{"version":{"number":"7.17.7","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+	case r.Method == http.MethodHead && len(parts) == 1:
+		if !s.indices[parts[0]] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut && len(parts) == 1:
+		s.indices[parts[0]] = true
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && parts[len(parts)-1] == "_search":
+		hits := make([]string, 0)
+		for _, record := range s.records {
+			hits = append(hits, `{"_source":`+string(record)+`}`)
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` + strings.Join(hits, ",") + `]}}`))
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[1] == "_doc":
+		s.records[parts[2]] = body
+		_, _ = w.Write([]byte(`{"result":"created"}`))
+	case r.Method == http.MethodDelete && len(parts) == 3 && parts[1] == "_doc":
+		delete(s.records, parts[2])
+		_, _ = w.Write([]byte(`{"result":"deleted"}`))
+	case r.Method == http.MethodGet && parts[0] == "_alias":
+		indices, ok := s.aliases[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		result := map[string]interface{}{}
+		for _, index := range indices {
+			result[index] = map[string]interface{}{"aliases": map[string]interface{}{parts[1]: map[string]interface{}{}}}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPost && parts[0] == "_aliases":
+		request := struct {
+			Actions []map[string]map[string]string `json:"actions"`
+		}{}
+		_ = json.Unmarshal(body, &request)
+		for _, action := range request.Actions {
+			if add, ok := action["add"]; ok {
+				s.aliases[add["alias"]] = []string{add["index"]}
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && parts[0] == "_reindex":
+		_, _ = w.Write([]byte(`{"failures":[]}`))
+	case r.Method == http.MethodDelete && len(parts) == 1:
+		delete(s.indices, parts[0])
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"unexpected request"}`))
+	}
+}
+
+func TestELSMigrator_UpOnce(t *testing.T) {
+	server, client := newELSMigrationTestServer(t)
+	migrator := NewELSMigrator(client, nil)
+
+	runs := 0
+	migrator.Add(&ELSVersionedMigration{Version: "1", Name: "create_products", Up: func(els IELS) error {
+		runs++
+		return nil
+	}})
+
+	statuses, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.True(t, server.indices[DefaultELSMigrationIndex])
+
+	statuses, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 0)
+	assert.Equal(t, 1, runs)
+
+	statuses, err = migrator.Status()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Applied)
+}
+
+func TestELSMigrator_UpError(t *testing.T) {
+	_, client := newELSMigrationTestServer(t)
+	migrator := NewELSMigrator(client, nil)
+	migrator.Add(&ELSVersionedMigration{Version: "1", Name: "broken", Up: func(els IELS) error {
+		return errors.New("mapping conflict")
+	}}, &ELSVersionedMigration{Version: "2", Name: "next", Up: func(els IELS) error {
+		t.Fatal("the next migration must not run")
+		return nil
+	}})
+
+	_, err := migrator.Up()
+	assert.EqualError(t, err, "migration: 1_broken failed: mapping conflict")
+
+	statuses, err := migrator.Status()
+	assert.NoError(t, err)
+	assert.False(t, statuses[0].Applied)
+}
+
+func TestELSMigrator_Down(t *testing.T) {
+	server, client := newELSMigrationTestServer(t)
+	migrator := NewELSMigrator(client, nil)
+
+	reverted := false
+	migrator.Add(&ELSVersionedMigration{Version: "1", Name: "create_products", Up: func(els IELS) error {
+		return nil
+	}, Down: func(els IELS) error {
+		reverted = true
+		return nil
+	}})
+
+	_, err := migrator.Up()
+	assert.NoError(t, err)
+
+	statuses, err := migrator.Down(1)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.True(t, reverted)
+	assert.Len(t, server.records, 0)
+}
+
+func TestELS_ReindexAlias(t *testing.T) {
+	server, client := newELSMigrationTestServer(t)
+	server.indices["products_v1"] = true
+	server.aliases["products"] = []string{"products_v1"}
+
+	err := client.ReindexAlias("products", "products_v2", Map{"mappings": Map{}}, &ELSReindexAliasOptions{DeleteOld: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"products_v2"}, server.aliases["products"])
+	assert.False(t, server.indices["products_v1"])
+	assert.Contains(t, server.requests, "POST /_reindex")
+}
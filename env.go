@@ -5,6 +5,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"strings"
+	"time"
 )
 
 const EnvFileName = ".env"
@@ -26,12 +27,15 @@ type ENVConfig struct {
 	LogLevel logrus.Level
 	LogHost  string `mapstructure:"log_host"`
 
-	Host    string `mapstructure:"host"`
-	ENV     string `mapstructure:"env"`
-	Service string `mapstructure:"service"`
+	Host       string `mapstructure:"host"`
+	HealthHost string `mapstructure:"health_host"`
+	ENV        string `mapstructure:"env"`
+	Service    string `mapstructure:"service"`
 
 	SentryDSN string `mapstructure:"sentry_dsn"`
 
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
 	DBDriver   string `mapstructure:"db_driver"`
 	DBDsn      string `mapstructure:"db_dsn"`
 	DBHost     string `mapstructure:"db_host"`
@@ -39,6 +43,13 @@ type ENVConfig struct {
 	DBUser     string `mapstructure:"db_user"`
 	DBPassword string `mapstructure:"db_password"`
 	DBPort     string `mapstructure:"db_port"`
+	// DBReplicaHosts is a comma separated list of host or host:port of the read replicas, they share the name, user and password
+	DBReplicaHosts string `mapstructure:"db_replica_hosts"`
+	// DBReplicaDsns is a comma separated list of DSN of the read replicas, it takes precedence over DBReplicaHosts
+	DBReplicaDsns     string        `mapstructure:"db_replica_dsns"`
+	DBMaxOpenConns    int           `mapstructure:"db_max_open_conns"`
+	DBMaxIdleConns    int           `mapstructure:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `mapstructure:"db_conn_max_lifetime"`
 
 	DBMongoHost     string `mapstructure:"db_mongo_host"`
 	DBMongoName     string `mapstructure:"db_mongo_name"`
@@ -61,6 +72,21 @@ type ENVConfig struct {
 
 	CachePort string `mapstructure:"cache_port"`
 	CacheHost string `mapstructure:"cache_host"`
+	// CacheAddrs is a comma separated seed list of the cluster or sentinel nodes, it takes precedence over CacheHost and CachePort
+	CacheAddrs            string        `mapstructure:"cache_addrs"`
+	CacheUsername         string        `mapstructure:"cache_username"`
+	CachePassword         string        `mapstructure:"cache_password"`
+	CacheDB               int           `mapstructure:"cache_db"`
+	CacheMasterName       string        `mapstructure:"cache_master_name"`
+	CacheSentinelPassword string        `mapstructure:"cache_sentinel_password"`
+	CacheCluster          bool          `mapstructure:"cache_cluster"`
+	CacheTLS              bool          `mapstructure:"cache_tls"`
+	CacheTLSSkipVerify    bool          `mapstructure:"cache_tls_skip_verify"`
+	CachePoolSize         int           `mapstructure:"cache_pool_size"`
+	CacheMinIdleConns     int           `mapstructure:"cache_min_idle_conns"`
+	CacheDialTimeout      time.Duration `mapstructure:"cache_dial_timeout"`
+	CacheReadTimeout      time.Duration `mapstructure:"cache_read_timeout"`
+	CacheWriteTimeout     time.Duration `mapstructure:"cache_write_timeout"`
 
 	ELSAddress  string `mapstructure:"els_address"`
 	ELSUser     string `mapstructure:"els_user"`
@@ -75,6 +101,18 @@ func NewEnv() IENV {
 	return NewENVPath(".")
 }
 
+// envList split a comma separated env value, the empty items are skipped
+func envList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
 func NewENVPath(path string) IENV {
 	viper.SetConfigName(EnvFileName)
 
@@ -85,13 +123,17 @@ func NewENVPath(path string) IENV {
 	viper.ReadInConfig()
 	envKeys := []string{
 		"LOG_HOST",
-		"HOST", "ENV", "SERVICE",
-		"SENTRY_DSN", "DB_DRIVER", "DB_DSN", "DB_HOST", "DB_HOST",
-		"DB_NAME", "DB_USER", "DB_PASSWORD", "DB_PORT", "DB_MONGO_HOST",
+		"HOST", "HEALTH_HOST", "ENV", "SERVICE",
+		"SENTRY_DSN", "SHUTDOWN_TIMEOUT", "DB_DRIVER", "DB_DSN", "DB_HOST", "DB_HOST",
+		"DB_NAME", "DB_USER", "DB_PASSWORD", "DB_PORT", "DB_REPLICA_HOSTS", "DB_REPLICA_DSNS",
+		"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_MONGO_HOST",
 		"DB_MONGO_NAME", "DB_MONGO_USERNAME", "DB_MONGO_PASSWORD", "DB_MONGO_PORT",
 		"MQ_URI", "MQ_HOST", "MQ_USER", "MQ_PASSWORD", "MQ_PORT", "S3_ENDPOINT",
 		"S3_ACCESS_KEY", "S3_SECRET_KEY", "S3_BUCKET", "S3_HTTPS", "S3_REGION",
-		"CACHE_PORT", "CACHE_HOST", "ELS_ADDRESS", "ELS_USER", "ELS_PASSWORD",
+		"CACHE_PORT", "CACHE_HOST", "CACHE_ADDRS", "CACHE_USERNAME", "CACHE_PASSWORD", "CACHE_DB",
+		"CACHE_MASTER_NAME", "CACHE_SENTINEL_PASSWORD", "CACHE_CLUSTER", "CACHE_TLS", "CACHE_TLS_SKIP_VERIFY",
+		"CACHE_POOL_SIZE", "CACHE_MIN_IDLE_CONNS", "CACHE_DIAL_TIMEOUT", "CACHE_READ_TIMEOUT", "CACHE_WRITE_TIMEOUT",
+		"ELS_ADDRESS", "ELS_USER", "ELS_PASSWORD",
 	}
 
 	for _, key := range envKeys {
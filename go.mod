@@ -25,6 +25,7 @@ require (
 	github.com/tidwall/gjson v1.14.4
 	go.mongodb.org/mongo-driver v1.17.3
 	golang.org/x/crypto v0.26.0
+	golang.org/x/sync v0.8.0
 	gopkg.in/asaskevich/govalidator.v9 v9.0.0-20180315120708-ccb8e960c48f
 	gorm.io/driver/mysql v1.4.7
 	gorm.io/driver/postgres v1.5.0
@@ -110,7 +111,6 @@ require (
 	go.opentelemetry.io/otel/metric v0.31.0 // indirect
 	golang.org/x/image v0.6.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.23.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 	golang.org/x/time v0.3.0 // indirect
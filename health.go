@@ -0,0 +1,337 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/tidwall/gjson"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStatusOK    = "ok"
+	HealthStatusError = "error"
+
+	HealthPathLiveness  = "/healthz"
+	HealthPathReadiness = "/readyz"
+
+	DefaultHealthCheckTimeout = 3 * time.Second
+)
+
+type HealthCheckFunc func(ctx context.Context) error
+
+type HealthCheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+type IHealth interface {
+	// AddLiveness register a check used by /healthz
+	AddLiveness(name string, check HealthCheckFunc, timeout ...time.Duration)
+	// AddReadiness register a check used by /readyz
+	AddReadiness(name string, check HealthCheckFunc, timeout ...time.Duration)
+	Liveness(ctx context.Context) *HealthReport
+	Readiness(ctx context.Context) *HealthReport
+	Mount(e *echo.Echo)
+	Handler() http.Handler
+}
+
+type HealthOptions struct {
+	// ContextOptions register a readiness check for every configured connection
+	ContextOptions *ContextOptions
+	ELS            IELS
+	S3             IS3
+	Timeout        time.Duration
+}
+
+type healthCheck struct {
+	name    string
+	check   HealthCheckFunc
+	timeout time.Duration
+}
+
+type Health struct {
+	mutex     sync.RWMutex
+	timeout   time.Duration
+	liveness  []healthCheck
+	readiness []healthCheck
+}
+
+func NewHealth(options *HealthOptions) *Health {
+	if options == nil {
+		options = &HealthOptions{}
+	}
+
+	h := &Health{timeout: options.Timeout}
+	if h.timeout <= 0 {
+		h.timeout = DefaultHealthCheckTimeout
+	}
+
+	if ctxOptions := options.ContextOptions; ctxOptions != nil {
+		if ctxOptions.DB != nil {
+			h.AddReadiness("database", HealthCheckDB(ctxOptions.DB))
+		}
+
+		for name, db := range ctxOptions.DBS {
+			h.AddReadiness(fmt.Sprintf("database:%s", name), HealthCheckDB(db))
+		}
+
+		if ctxOptions.MongoDB != nil {
+			h.AddReadiness("mongodb", HealthCheckMongoDB(ctxOptions.MongoDB))
+		}
+
+		for name, db := range ctxOptions.MongoDBS {
+			h.AddReadiness(fmt.Sprintf("mongodb:%s", name), HealthCheckMongoDB(db))
+		}
+
+		if ctxOptions.Cache != nil {
+			h.AddReadiness("cache", HealthCheckCache(ctxOptions.Cache))
+		}
+
+		for name, cache := range ctxOptions.Caches {
+			h.AddReadiness(fmt.Sprintf("cache:%s", name), HealthCheckCache(cache))
+		}
+
+		if ctxOptions.MQ != nil {
+			h.AddReadiness("mq", HealthCheckMQ(ctxOptions.MQ))
+		}
+	}
+
+	if options.ELS != nil {
+		h.AddReadiness("els", HealthCheckELS(options.ELS))
+	}
+
+	if options.S3 != nil {
+		h.AddReadiness("s3", HealthCheckS3(options.S3))
+	}
+
+	return h
+}
+
+func (h *Health) newCheck(name string, check HealthCheckFunc, timeout []time.Duration) healthCheck {
+	c := healthCheck{name: name, check: check, timeout: h.timeout}
+	if len(timeout) > 0 && timeout[0] > 0 {
+		c.timeout = timeout[0]
+	}
+
+	return c
+}
+
+func (h *Health) AddLiveness(name string, check HealthCheckFunc, timeout ...time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.liveness = append(h.liveness, h.newCheck(name, check, timeout))
+}
+
+func (h *Health) AddReadiness(name string, check HealthCheckFunc, timeout ...time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.readiness = append(h.readiness, h.newCheck(name, check, timeout))
+}
+
+func (h *Health) Liveness(ctx context.Context) *HealthReport {
+	h.mutex.RLock()
+	checks := h.liveness
+	h.mutex.RUnlock()
+
+	return h.run(ctx, checks)
+}
+
+func (h *Health) Readiness(ctx context.Context) *HealthReport {
+	h.mutex.RLock()
+	checks := h.readiness
+	h.mutex.RUnlock()
+
+	return h.run(ctx, checks)
+}
+
+// run execute every check concurrently, each one bounded by its own timeout
+func (h *Health) run(ctx context.Context, checks []healthCheck) *HealthReport {
+	report := &HealthReport{
+		Status: HealthStatusOK,
+		Checks: make(map[string]HealthCheckResult, len(checks)),
+	}
+
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			result := h.runCheck(ctx, c)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[c.name] = result
+			if result.Status != HealthStatusOK {
+				report.Status = HealthStatusError
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (h *Health) runCheck(ctx context.Context, c healthCheck) (result HealthCheckResult) {
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("%v", r)
+			}
+		}()
+
+		errCh <- c.check(checkCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	}
+
+	result = HealthCheckResult{
+		Status:     HealthStatusOK,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = HealthStatusError
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (h *Health) reportStatusCode(report *HealthReport) int {
+	if report.Status != HealthStatusOK {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusOK
+}
+
+// Mount register /healthz and /readyz on the echo server
+func (h *Health) Mount(e *echo.Echo) {
+	e.GET(HealthPathLiveness, func(c echo.Context) error {
+		report := h.Liveness(c.Request().Context())
+		return c.JSON(h.reportStatusCode(report), report)
+	})
+	e.GET(HealthPathReadiness, func(c echo.Context) error {
+		report := h.Readiness(c.Request().Context())
+		return c.JSON(h.reportStatusCode(report), report)
+	})
+}
+
+// Handler return a plain http.Handler serving /healthz and /readyz, used by the side listener of MQ and cronjob services
+func (h *Health) Handler() http.Handler {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	h.Mount(e)
+	return e
+}
+
+// StartHealthServer serve the health endpoints on host in background, the listener is stopped by lc when it is given
+func StartHealthServer(host string, health IHealth, lc ILifecycle) *http.Server {
+	server := &http.Server{
+		Addr:    host,
+		Handler: health.Handler(),
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(fmt.Sprintf("Health Server: %v", err))
+		}
+	}()
+
+	if lc != nil {
+		lc.AddService("health", func(ctx context.Context) error {
+			return server.Shutdown(ctx)
+		})
+	}
+
+	fmt.Println(fmt.Sprintf("Health Server: %s", host))
+	return server
+}
+
+func HealthCheckDB(db *gorm.DB) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+func HealthCheckMongoDB(db IMongoDB) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return db.DB().Client().Ping(ctx, readpref.Primary())
+	}
+}
+
+func HealthCheckCache(cache ICache) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return cache.WithContext(ctx).Ping()
+	}
+}
+
+func HealthCheckMQ(mq IMQ) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if state := mq.State(); state != MQStateConnected {
+			return fmt.Errorf("mq connection is %s", state)
+		}
+
+		return nil
+	}
+}
+
+func HealthCheckELS(els IELS) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		res, err := els.Client().Cluster.Health(els.Client().Cluster.Health.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.IsError() {
+			return errors.New(res.String())
+		}
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+
+		if status := gjson.GetBytes(body, "status").String(); status == "red" {
+			return fmt.Errorf("els cluster status is %s", status)
+		}
+
+		return nil
+	}
+}
+
+func HealthCheckS3(s3 IS3) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return s3.WithContext(ctx).HeadBucket()
+	}
+}
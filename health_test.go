@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth_Readiness(t *testing.T) {
+	h := NewHealth(nil)
+	h.AddReadiness("ok", func(ctx context.Context) error {
+		return nil
+	})
+	h.AddReadiness("failed", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, HealthStatusError, report.Status)
+	assert.Equal(t, HealthStatusOK, report.Checks["ok"].Status)
+	assert.Equal(t, HealthStatusError, report.Checks["failed"].Status)
+	assert.Equal(t, "connection refused", report.Checks["failed"].Error)
+}
+
+func TestHealth_Timeout(t *testing.T) {
+	h := NewHealth(nil)
+	h.AddReadiness("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, HealthStatusError, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestHealth_Mount(t *testing.T) {
+	h := NewHealth(nil)
+	h.AddReadiness("failed", func(ctx context.Context) error {
+		return errors.New("down")
+	})
+
+	e := echo.New()
+	h.Mount(e)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HealthPathLiveness, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HealthPathReadiness, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"failed":{"status":"error","error":"down"`)
+}
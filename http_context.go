@@ -126,12 +126,16 @@ type HandlerFunc func(IHTTPContext) error
 
 type HTTPContextOptions struct {
 	ContextOptions *ContextOptions
+	// Health mount /healthz and /readyz on the server when it is set
+	Health IHealth
 }
 
 func NewHTTPContext(ctx echo.Context, options *HTTPContextOptions) IHTTPContext {
 	ctxOptions := options.ContextOptions
 	ctxOptions.contextType = consts.HTTP
-	return &HTTPContext{Context: ctx, logger: nil, IContext: NewContext(ctxOptions)}
+	coreCtx := NewContext(ctxOptions)
+	coreCtx.SetStdContext(ctx.Request().Context())
+	return &HTTPContext{Context: ctx, logger: nil, IContext: coreCtx}
 }
 
 func WithHTTPContext(h HandlerFunc) echo.HandlerFunc {
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotencyReplayed = "Idempotency-Replayed"
+)
+
+var IdempotencyError = Error{
+	Status:  http.StatusInternalServerError,
+	Code:    "IDEMPOTENCY_ERROR",
+	Message: "idempotency store internal error"}
+
+var IdempotencyInProgressError = Error{
+	Status:  http.StatusConflict,
+	Code:    "IDEMPOTENCY_IN_PROGRESS",
+	Message: "a request with this idempotency key is still processing"}
+
+var IdempotencyKeyMismatchError = Error{
+	Status:  http.StatusUnprocessableEntity,
+	Code:    "IDEMPOTENCY_KEY_MISMATCH",
+	Message: "the idempotency key was used with another request body"}
+
+// IdempotencySaveTimeout bound the store calls made once the handler returned, they run detached from the request
+// so a client which disconnects does not leave its key processing until the ttl expires
+const IdempotencySaveTimeout = 5 * time.Second
+
+// idempotencyHeaders are the response headers stored and replayed, the others like Set-Cookie are never replayed
+var idempotencyHeaders = []string{echo.HeaderContentType, echo.HeaderLocation}
+
+type idempotencyResponseWriter struct {
+	io.Writer
+	http.ResponseWriter
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+// idempotencyKey scope the client key to the user, the method and the path of the request
+func idempotencyKey(c IHTTPContext, key string) string {
+	userID := ""
+	if user := c.GetUser(); user != nil {
+		userID = user.ID
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s %s|%s", userID, c.Request().Method, c.Request().URL.Path, key)))
+	return "http:" + hex.EncodeToString(sum[:])
+}
+
+// HTTPWithIdempotency replay the stored response of a POST request whose Idempotency-Key was already processed.
+// The key is reserved before the handler runs, so a concurrent request with the same key gets 409 Conflict and a
+// request reusing the key with another body gets 422. The response is stored for ttl unless the handler fails or
+// replies a server error, the key is then released so the client can retry it
+func HTTPWithIdempotency(store IIdempotencyStore, ttl time.Duration) echo.MiddlewareFunc {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			clientKey := c.Request().Header.Get(HeaderIdempotencyKey)
+			if c.Request().Method != http.MethodPost || clientKey == "" {
+				return next(c)
+			}
+
+			cc := c.(IHTTPContext)
+			requestBody, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(requestBody))
+
+			sum := sha256.Sum256(requestBody)
+			requestHash := hex.EncodeToString(sum[:])
+			key := idempotencyKey(cc, clientKey)
+			s := store.WithContext(c.Request().Context())
+			reserved, err := s.Reserve(key, &IdempotencyRecord{Processing: true, RequestHash: requestHash}, ttl)
+			if err != nil {
+				ierr := cc.NewError(err, IdempotencyError)
+				return c.JSON(ierr.GetStatus(), ierr.JSON())
+			}
+
+			if !reserved {
+				record, err := s.Get(key)
+				if err != nil {
+					ierr := cc.NewError(err, IdempotencyError)
+					return c.JSON(ierr.GetStatus(), ierr.JSON())
+				}
+
+				if record == nil || record.Processing {
+					return c.JSON(IdempotencyInProgressError.GetStatus(), IdempotencyInProgressError.JSON())
+				}
+
+				if record.RequestHash != requestHash {
+					return c.JSON(IdempotencyKeyMismatchError.GetStatus(), IdempotencyKeyMismatchError.JSON())
+				}
+
+				for name, values := range record.Header {
+					for _, value := range values {
+						c.Response().Header().Add(name, value)
+					}
+				}
+
+				c.Response().Header().Set(HeaderIdempotencyReplayed, "true")
+				c.Response().WriteHeader(record.Status)
+				_, err = c.Response().Write(record.Body)
+				return err
+			}
+
+			body := new(bytes.Buffer)
+			writer := &idempotencyResponseWriter{Writer: io.MultiWriter(c.Response().Writer, body), ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+
+			err = next(c)
+
+			saveCtx, cancel := context.WithTimeout(context.Background(), IdempotencySaveTimeout)
+			defer cancel()
+			s = store.WithContext(saveCtx)
+			if err != nil || c.Response().Status >= http.StatusInternalServerError {
+				deleteErr := s.Delete(key)
+				if deleteErr != nil {
+					cc.NewError(deleteErr, IdempotencyError)
+				}
+
+				return err
+			}
+
+			record := &IdempotencyRecord{
+				RequestHash: requestHash,
+				Status:      c.Response().Status,
+				Header:      http.Header{},
+				Body:        body.Bytes(),
+			}
+			for _, header := range idempotencyHeaders {
+				if values := c.Response().Header().Values(header); len(values) > 0 {
+					record.Header[header] = values
+				}
+			}
+
+			err = s.Set(key, record, ttl)
+			if err != nil {
+				cc.NewError(err, IdempotencyError)
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.records[key], nil
+}
+
+func (s *memoryIdempotencyStore) Set(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Reserve(key string, record *IdempotencyRecord, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.records[key]; ok {
+		return false, nil
+	}
+
+	s.records[key] = record
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) WithContext(ctx context.Context) IIdempotencyStore {
+	return s
+}
+
+func TestHTTPWithIdempotency_Replay(t *testing.T) {
+	calls := 0
+	e := echo.New()
+	e.Use(Core(&HTTPContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil)}}))
+	e.POST("/orders", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]int{"calls": calls})
+	}, HTTPWithIdempotency(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, time.Minute))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req.Header.Set(HeaderIdempotencyKey, "key-2")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.JSONEq(t, `{"calls":2}`, rec.Body.String())
+	assert.Equal(t, "", rec.Header().Get(HeaderIdempotencyReplayed))
+}
+
+// contextIdempotencyStore fail like a real store once the context it is bound to is cancelled
+type contextIdempotencyStore struct {
+	*memoryIdempotencyStore
+	ctx context.Context
+}
+
+func (s *contextIdempotencyStore) Set(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+
+	return s.memoryIdempotencyStore.Set(key, record, ttl)
+}
+
+func (s *contextIdempotencyStore) Delete(key string) error {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+
+	return s.memoryIdempotencyStore.Delete(key)
+}
+
+func (s *contextIdempotencyStore) WithContext(ctx context.Context) IIdempotencyStore {
+	return &contextIdempotencyStore{memoryIdempotencyStore: s.memoryIdempotencyStore, ctx: ctx}
+}
+
+func newIdempotencyTestServer(store IIdempotencyStore, handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	e.Use(Core(&HTTPContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil)}}))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if userID := c.Request().Header.Get("X-User"); userID != "" {
+				c.(IHTTPContext).SetUser(&ContextUser{ID: userID})
+			}
+			return next(c)
+		}
+	})
+	e.POST("/orders/:id", handler, HTTPWithIdempotency(store, time.Minute))
+	return e
+}
+
+func serveIdempotencyTest(e *echo.Echo, path string, user string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(HeaderIdempotencyKey, "key-1")
+	req.Header.Set("X-User", user)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPWithIdempotency_ScopedByUserAndPath(t *testing.T) {
+	calls := 0
+	e := newIdempotencyTestServer(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]int{"calls": calls})
+	})
+
+	assert.JSONEq(t, `{"calls":1}`, serveIdempotencyTest(e, "/orders/1", "a", "{}").Body.String())
+	assert.JSONEq(t, `{"calls":2}`, serveIdempotencyTest(e, "/orders/1", "b", "{}").Body.String())
+	assert.JSONEq(t, `{"calls":3}`, serveIdempotencyTest(e, "/orders/2", "a", "{}").Body.String())
+
+	rec := serveIdempotencyTest(e, "/orders/1", "a", "{}")
+	assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotencyReplayed))
+}
+
+func TestHTTPWithIdempotency_BodyMismatch(t *testing.T) {
+	e := newIdempotencyTestServer(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	})
+
+	assert.Equal(t, http.StatusCreated, serveIdempotencyTest(e, "/orders/1", "a", `{"amount":1}`).Code)
+	rec := serveIdempotencyTest(e, "/orders/1", "a", `{"amount":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), IdempotencyKeyMismatchError.Code)
+}
+
+func TestHTTPWithIdempotency_InProgress(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	e := newIdempotencyTestServer(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, func(c echo.Context) error {
+		started <- true
+		<-release
+		return c.NoContent(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveIdempotencyTest(e, "/orders/1", "a", "{}")
+	}()
+	<-started
+
+	rec := serveIdempotencyTest(e, "/orders/1", "a", "{}")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), IdempotencyInProgressError.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestHTTPWithIdempotency_FailureReleasesKey(t *testing.T) {
+	calls := 0
+	e := newIdempotencyTestServer(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			return errors.New("boom")
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, serveIdempotencyTest(e, "/orders/1", "a", "{}").Code)
+	assert.Equal(t, http.StatusCreated, serveIdempotencyTest(e, "/orders/1", "a", "{}").Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestHTTPWithIdempotency_ReplayedHeaders(t *testing.T) {
+	e := newIdempotencyTestServer(&memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}, func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderLocation, "/orders/1")
+		c.SetCookie(&http.Cookie{Name: "session", Value: "secret"})
+		return c.NoContent(http.StatusCreated)
+	})
+
+	assert.NotEmpty(t, serveIdempotencyTest(e, "/orders/1", "a", "{}").Header().Get(echo.HeaderSetCookie))
+	rec := serveIdempotencyTest(e, "/orders/1", "a", "{}")
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotencyReplayed))
+	assert.Equal(t, "/orders/1", rec.Header().Get(echo.HeaderLocation))
+	assert.Empty(t, rec.Header().Get(echo.HeaderSetCookie))
+}
+
+func TestHTTPWithIdempotency_ClientDisconnected(t *testing.T) {
+	store := &contextIdempotencyStore{memoryIdempotencyStore: &memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}}
+	var disconnect context.CancelFunc
+	calls := 0
+	e := newIdempotencyTestServer(store, func(c echo.Context) error {
+		calls++
+		disconnect()
+		if c.Param("id") == "2" {
+			return errors.New("boom")
+		}
+
+		return c.NoContent(http.StatusCreated)
+	})
+
+	serve := func(path string) {
+		var ctx context.Context
+		ctx, disconnect = context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodPost, path, nil).WithContext(ctx)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the response is stored even though the request context is cancelled
+	serve("/orders/1")
+	disconnect = func() {}
+	rec := serveIdempotencyTest(e, "/orders/1", "", "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotencyReplayed))
+	assert.Equal(t, 1, calls)
+
+	// the key of a failure is released even though the request context is cancelled
+	serve("/orders/2")
+	disconnect = func() {}
+	assert.Equal(t, http.StatusInternalServerError, serveIdempotencyTest(e, "/orders/2", "", "").Code)
+	assert.Equal(t, 3, calls)
+}
@@ -1,12 +1,32 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strings"
+	"time"
 )
 
+const (
+	HeaderCacheStatus = "X-Cache"
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+
+	DefaultHTTPCacheTTL    = time.Minute
+	DefaultHTTPCachePrefix = "http-cache:"
+)
+
+var CacheError = Error{
+	Status:  http.StatusInternalServerError,
+	Code:    "CACHE_ERROR",
+	Message: "cache internal error"}
+
 func HTTPWithCache(key func(IHTTPContext) string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -28,3 +48,246 @@ func HTTPWithCache(key func(IHTTPContext) string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+type HTTPCacheOptions struct {
+	// Cache store the responses, defaults to ctx.Cache()
+	Cache ICache
+	// TTL defaults to DefaultHTTPCacheTTL
+	TTL time.Duration
+	// Prefix of every key, the tags use the same prefix, defaults to DefaultHTTPCachePrefix
+	Prefix string
+	// Key replace the default key, which is the method, the path and the sorted query
+	Key func(c IHTTPContext) string
+	// Shared serve the same cached response to every user, by default the key includes the id of ctx.GetUser(),
+	// or the Authorization header when there is no user, so an authenticated response is only served back to its user
+	Shared bool
+	// VaryHeaders add the values of these request headers to the key
+	VaryHeaders []string
+	// Headers are the response headers stored with the body, defaults to Content-Type
+	Headers []string
+	// StatusCodes are the cached response statuses, defaults to 200
+	StatusCodes []int
+	// Tags group the cached responses to purge them together with InvalidateHTTPCacheTags
+	Tags func(c IHTTPContext) []string
+}
+
+// HTTPCacheRecord is a cached response
+type HTTPCacheRecord struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"`
+	ETag   string      `json:"etag"`
+}
+
+// httpCacheResponseWriter hold the response until the handler returns, so the ETag can be set from the body
+type httpCacheResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (w *httpCacheResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *httpCacheResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *httpCacheResponseWriter) Flush() {}
+
+func httpCacheETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:]))
+}
+
+func httpCacheTagKey(prefix string, tag string) string {
+	return fmt.Sprintf("%stag:%s", prefix, tag)
+}
+
+func (o HTTPCacheOptions) key(c IHTTPContext) string {
+	var key string
+	if o.Key != nil {
+		key = o.Key(c)
+	} else {
+		key = fmt.Sprintf("%s %s?%s", c.Request().Method, c.Request().URL.Path, c.Request().URL.Query().Encode())
+	}
+
+	if !o.Shared {
+		identity := c.Request().Header.Get(echo.HeaderAuthorization)
+		if user := c.GetUser(); user != nil {
+			identity = "user:" + user.ID
+		}
+
+		if identity != "" {
+			key = fmt.Sprintf("%s|identity=%s", key, identity)
+		}
+	}
+
+	for _, header := range o.VaryHeaders {
+		key = fmt.Sprintf("%s|%s=%s", key, strings.ToLower(header), c.Request().Header.Get(header))
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return o.Prefix + hex.EncodeToString(sum[:])
+}
+
+func (o HTTPCacheOptions) cacheable(status int, header http.Header) bool {
+	cacheControl := strings.ToLower(header.Get(echo.HeaderCacheControl))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+
+	for _, code := range o.StatusCodes {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeHTTPCacheRecord reply record, or 304 Not Modified when the request If-None-Match matches its ETag
+func writeHTTPCacheRecord(c echo.Context, record *HTTPCacheRecord, cacheStatus string) error {
+	for name, values := range record.Header {
+		c.Response().Header()[name] = values
+	}
+
+	c.Response().Header().Set(HeaderETag, record.ETag)
+	c.Response().Header().Set(HeaderCacheStatus, cacheStatus)
+	if ifNoneMatch := c.Request().Header.Get(HeaderIfNoneMatch); ifNoneMatch != "" && strings.Contains(ifNoneMatch, record.ETag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	c.Response().WriteHeader(record.Status)
+	_, err := c.Response().Write(record.Body)
+	return err
+}
+
+// HTTPWithResponseCache reply the GET and HEAD requests from the cache, a miss stores the response of the handler for the ttl.
+// A request with Cache-Control no-cache skips the cached response and no-store also skips storing it, a response with
+// Cache-Control no-store or private is not stored. Every response has an ETag, a matching If-None-Match is replied 304
+func HTTPWithResponseCache(options *HTTPCacheOptions) echo.MiddlewareFunc {
+	cacheOptions := HTTPCacheOptions{}
+	if options != nil {
+		cacheOptions = *options
+	}
+
+	if cacheOptions.TTL <= 0 {
+		cacheOptions.TTL = DefaultHTTPCacheTTL
+	}
+
+	if cacheOptions.Prefix == "" {
+		cacheOptions.Prefix = DefaultHTTPCachePrefix
+	}
+
+	if len(cacheOptions.Headers) == 0 {
+		cacheOptions.Headers = []string{echo.HeaderContentType}
+	}
+
+	if len(cacheOptions.StatusCodes) == 0 {
+		cacheOptions.StatusCodes = []int{http.StatusOK}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method != http.MethodGet && c.Request().Method != http.MethodHead {
+				return next(c)
+			}
+
+			cc := c.(IHTTPContext)
+			cache := cacheOptions.Cache
+			if cache == nil {
+				cache = cc.Cache()
+			}
+			cache = cache.WithContext(c.Request().Context())
+
+			cacheControl := strings.ToLower(c.Request().Header.Get(echo.HeaderCacheControl))
+			noStore := strings.Contains(cacheControl, "no-store")
+			key := cacheOptions.key(cc)
+			if !noStore && !strings.Contains(cacheControl, "no-cache") {
+				record := &HTTPCacheRecord{}
+				err := cache.GetJSON(record, key)
+				if err == nil {
+					return writeHTTPCacheRecord(c, record, "HIT")
+				}
+
+				if !errors.Is(err, redis.Nil) {
+					cc.NewError(err, CacheError)
+				}
+			}
+
+			original := c.Response().Writer
+			writer := &httpCacheResponseWriter{ResponseWriter: original, status: http.StatusOK, body: new(bytes.Buffer)}
+			c.Response().Writer = writer
+			err := next(c)
+			c.Response().Writer = original
+			if err != nil && !c.Response().Committed {
+				return err
+			}
+
+			record := &HTTPCacheRecord{
+				Status: writer.status,
+				Header: http.Header{},
+				Body:   writer.body.Bytes(),
+				ETag:   httpCacheETag(writer.body.Bytes()),
+			}
+			for _, header := range cacheOptions.Headers {
+				if values := c.Response().Header().Values(header); len(values) > 0 {
+					record.Header[http.CanonicalHeaderKey(header)] = values
+				}
+			}
+
+			if !noStore && cacheOptions.cacheable(record.Status, c.Response().Header()) {
+				err = cache.SetJSON(key, record, cacheOptions.TTL)
+				if err != nil {
+					cc.NewError(err, CacheError)
+				}
+
+				if cacheOptions.Tags != nil {
+					for _, tag := range cacheOptions.Tags(cc) {
+						tagKey := httpCacheTagKey(cacheOptions.Prefix, tag)
+						_, err = cache.SAdd(tagKey, key)
+						if err == nil {
+							_, err = cache.Expire(tagKey, cacheOptions.TTL)
+						}
+
+						if err != nil {
+							cc.NewError(err, CacheError)
+						}
+					}
+				}
+			}
+
+			// the handler only wrote to the buffer, so the response is committed again on the original writer with its ETag
+			c.Response().Committed = false
+			c.Response().Size = 0
+			return writeHTTPCacheRecord(c, record, "MISS")
+		}
+	}
+}
+
+// InvalidateHTTPCacheTags delete the responses cached with one of the tags by HTTPWithResponseCache,
+// prefix must match HTTPCacheOptions.Prefix, an empty prefix is DefaultHTTPCachePrefix
+func InvalidateHTTPCacheTags(cache ICache, prefix string, tags ...string) error {
+	if prefix == "" {
+		prefix = DefaultHTTPCachePrefix
+	}
+
+	for _, tag := range tags {
+		tagKey := httpCacheTagKey(prefix, tag)
+		keys, err := cache.SMembers(tagKey)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range append(keys, tagKey) {
+			err = cache.Del(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package core
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPWithResponseCache(t *testing.T) {
+	var stored *HTTPCacheRecord
+	cache := NewMockCache()
+	cache.On("WithContext", mock.Anything).Return(cache)
+	cache.On("GetJSON", mock.Anything, mock.Anything).Return(redis.Nil).Once()
+	cache.On("GetJSON", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*HTTPCacheRecord) = *stored
+	})
+	cache.On("SetJSON", mock.Anything, mock.Anything, time.Minute).Return(nil).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*HTTPCacheRecord)
+	})
+
+	calls := 0
+	e := echo.New()
+	e.Use(Core(&HTTPContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil)}}))
+	e.GET("/products", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]int{"calls": calls})
+	}, HTTPWithResponseCache(&HTTPCacheOptions{Cache: cache}))
+
+	request := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products?b=2&a=1", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+	etag := rec.Header().Get(HeaderETag)
+	assert.NotEmpty(t, etag)
+
+	rec = request(nil)
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+
+	rec = request(map[string]string{HeaderIfNoneMatch: etag})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = request(map[string]string{echo.HeaderCacheControl: "no-cache"})
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":2}`, rec.Body.String())
+	assert.Equal(t, 2, calls)
+}
+
+func TestInvalidateHTTPCacheTags(t *testing.T) {
+	cache := NewMockCache()
+	cache.On("WithContext", mock.Anything).Return(cache)
+	cache.On("SMembers", "http-cache:tag:products").Return([]string{"http-cache:a", "http-cache:b"}, nil)
+	cache.On("Del", mock.Anything).Return(nil)
+
+	assert.NoError(t, InvalidateHTTPCacheTags(cache, "", "products"))
+	cache.AssertCalled(t, "Del", "http-cache:a")
+	cache.AssertCalled(t, "Del", "http-cache:b")
+	cache.AssertCalled(t, "Del", "http-cache:tag:products")
+}
+
+func newHTTPCacheTestServer(options *HTTPCacheOptions, calls *int) *echo.Echo {
+	e := echo.New()
+	e.Use(Core(&HTTPContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil)}}))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if userID := c.Request().Header.Get("X-User"); userID != "" {
+				c.(IHTTPContext).SetUser(&ContextUser{ID: userID})
+			}
+			return next(c)
+		}
+	})
+	e.GET("/products/:id", func(c echo.Context) error {
+		*calls++
+		return c.JSON(http.StatusOK, map[string]int{"calls": *calls})
+	}, HTTPWithResponseCache(options))
+	return e
+}
+
+func serveHTTPCacheTest(e *echo.Echo, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPWithResponseCache_VaryByUser(t *testing.T) {
+	calls := 0
+	e := newHTTPCacheTestServer(&HTTPCacheOptions{Cache: NewMemoryCache(nil)}, &calls)
+
+	assert.JSONEq(t, `{"calls":1}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"X-User": "a"}).Body.String())
+	assert.JSONEq(t, `{"calls":2}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"X-User": "b"}).Body.String())
+	assert.JSONEq(t, `{"calls":3}`, serveHTTPCacheTest(e, "/products/1", map[string]string{echo.HeaderAuthorization: "Bearer a"}).Body.String())
+	assert.JSONEq(t, `{"calls":4}`, serveHTTPCacheTest(e, "/products/1", nil).Body.String())
+
+	rec := serveHTTPCacheTest(e, "/products/1", map[string]string{"X-User": "a"})
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+
+	rec = serveHTTPCacheTest(e, "/products/1", map[string]string{echo.HeaderAuthorization: "Bearer a"})
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":3}`, rec.Body.String())
+
+	rec = serveHTTPCacheTest(e, "/products/1", nil)
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":4}`, rec.Body.String())
+}
+
+func TestHTTPWithResponseCache_Shared(t *testing.T) {
+	calls := 0
+	e := newHTTPCacheTestServer(&HTTPCacheOptions{Cache: NewMemoryCache(nil), Shared: true}, &calls)
+
+	assert.JSONEq(t, `{"calls":1}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"X-User": "a"}).Body.String())
+
+	rec := serveHTTPCacheTest(e, "/products/1", map[string]string{"X-User": "b"})
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderCacheStatus))
+	assert.JSONEq(t, `{"calls":1}`, rec.Body.String())
+}
+
+func TestHTTPWithResponseCache_VaryHeaders(t *testing.T) {
+	calls := 0
+	e := newHTTPCacheTestServer(&HTTPCacheOptions{Cache: NewMemoryCache(nil), VaryHeaders: []string{"Accept-Language"}}, &calls)
+
+	assert.JSONEq(t, `{"calls":1}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"Accept-Language": "th"}).Body.String())
+	assert.JSONEq(t, `{"calls":2}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"Accept-Language": "en"}).Body.String())
+	assert.JSONEq(t, `{"calls":1}`, serveHTTPCacheTest(e, "/products/1", map[string]string{"Accept-Language": "th"}).Body.String())
+}
+
+func TestHTTPWithResponseCache_Tags(t *testing.T) {
+	cache := NewMemoryCache(nil)
+	calls := 0
+	e := newHTTPCacheTestServer(&HTTPCacheOptions{Cache: cache, Tags: func(c IHTTPContext) []string {
+		return []string{"products", "product:" + c.Param("id")}
+	}}, &calls)
+
+	serveHTTPCacheTest(e, "/products/1", nil)
+	serveHTTPCacheTest(e, "/products/2", nil)
+
+	keys, err := cache.SMembers(httpCacheTagKey(DefaultHTTPCachePrefix, "products"))
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	ttl, err := cache.TTL(httpCacheTagKey(DefaultHTTPCachePrefix, "products"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= DefaultHTTPCacheTTL, ttl)
+
+	assert.NoError(t, InvalidateHTTPCacheTags(cache, "", "product:1"))
+	assert.Equal(t, "MISS", serveHTTPCacheTest(e, "/products/1", nil).Header().Get(HeaderCacheStatus))
+	assert.Equal(t, "HIT", serveHTTPCacheTest(e, "/products/2", nil).Header().Get(HeaderCacheStatus))
+	assert.Equal(t, 3, calls)
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	sentryecho "github.com/getsentry/sentry-go/echo"
@@ -8,6 +10,7 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/pskclub/mine-core/middlewares"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"time"
 )
 
@@ -47,6 +50,11 @@ func NewHTTPServer(options *HTTPContextOptions) *echo.Echo {
 	echo.NotFoundHandler = HandleNotFound
 	e.Use(middleware.Secure())
 	e.HideBanner = true
+
+	if options.Health != nil {
+		options.Health.Mount(e)
+	}
+
 	fmt.Println(fmt.Sprintf("HTTP Service: %s", options.ContextOptions.ENV.Config().Service))
 
 	return e
@@ -55,3 +63,20 @@ func NewHTTPServer(options *HTTPContextOptions) *echo.Echo {
 func StartHTTPServer(e *echo.Echo, env IENV) {
 	e.Logger.Fatal(e.Start(env.Config().Host))
 }
+
+// StartHTTPServerWithLifecycle start the server and block until lc shuts down,
+// the server stops accepting new requests and waits for in-flight requests before the connections are closed
+func StartHTTPServerWithLifecycle(e *echo.Echo, env IENV, lc ILifecycle) error {
+	lc.AddService("http", func(ctx context.Context) error {
+		return e.Shutdown(ctx)
+	})
+
+	go func() {
+		if err := e.Start(env.Config().Host); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Error(err)
+			lc.Shutdown()
+		}
+	}()
+
+	return lc.Wait()
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/pskclub/mine-core/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyRecord is what is remembered of a processed key, the response is only set by HTTPWithIdempotency
+type IdempotencyRecord struct {
+	// Processing tell the key is reserved by a request which is not finished yet
+	Processing  bool        `json:"processing,omitempty"`
+	RequestHash string      `json:"request_hash,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type IIdempotencyStore interface {
+	// Get return the record of key, or nil when key is not processed yet
+	Get(key string) (*IdempotencyRecord, error)
+	Set(key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Reserve set record only when key is not processed yet, it returns false when key already exists
+	Reserve(key string, record *IdempotencyRecord, ttl time.Duration) (bool, error)
+	Delete(key string) error
+	WithContext(ctx context.Context) IIdempotencyStore
+}
+
+type cacheIdempotencyStore struct {
+	cache  ICache
+	prefix string
+}
+
+// NewCacheIdempotencyStore remember the processed keys in cache, every key is prefixed by prefix
+func NewCacheIdempotencyStore(cache ICache, prefix string) IIdempotencyStore {
+	return &cacheIdempotencyStore{cache: cache, prefix: prefix}
+}
+
+func (s cacheIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	record := &IdempotencyRecord{}
+	err := s.cache.GetJSON(record, s.prefix+key)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (s cacheIdempotencyStore) Set(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	return s.cache.SetJSON(s.prefix+key, record, ttl)
+}
+
+func (s cacheIdempotencyStore) Reserve(key string, record *IdempotencyRecord, ttl time.Duration) (bool, error) {
+	return s.cache.SetNXJSON(s.prefix+key, record, ttl)
+}
+
+func (s cacheIdempotencyStore) Delete(key string) error {
+	return s.cache.Del(s.prefix + key)
+}
+
+func (s cacheIdempotencyStore) WithContext(ctx context.Context) IIdempotencyStore {
+	s.cache = s.cache.WithContext(ctx)
+	return &s
+}
+
+// IdempotencyKey is a row of the SQL idempotency store
+type IdempotencyKey struct {
+	Key       string    `gorm:"column:idempotency_key;primaryKey;size:255"`
+	Record    string    `gorm:"column:record;type:text"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+type dbIdempotencyStore struct {
+	db *gorm.DB
+}
+
+// NewDBIdempotencyStore remember the processed keys in the idempotency_keys table, expired rows are ignored and overwritten
+func NewDBIdempotencyStore(db *gorm.DB) IIdempotencyStore {
+	return &dbIdempotencyStore{db: db}
+}
+
+// MigrateIdempotencyStore create the table of NewDBIdempotencyStore
+func MigrateIdempotencyStore(db *gorm.DB) error {
+	return db.AutoMigrate(&IdempotencyKey{})
+}
+
+func (s dbIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	row := &IdempotencyKey{}
+	err := DBPrimary(s.db).Where("idempotency_key = ? AND expires_at > ?", key, time.Now()).First(row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &IdempotencyRecord{}
+	err = utils.JSONParse([]byte(row.Record), record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (s dbIdempotencyStore) Set(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&IdempotencyKey{
+		Key:       key,
+		Record:    utils.JSONToString(record),
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error
+}
+
+func (s dbIdempotencyStore) Reserve(key string, record *IdempotencyRecord, ttl time.Duration) (bool, error) {
+	err := s.db.Where("idempotency_key = ? AND expires_at <= ?", key, time.Now()).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return false, err
+	}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&IdempotencyKey{
+		Key:       key,
+		Record:    utils.JSONToString(record),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (s dbIdempotencyStore) Delete(key string) error {
+	return s.db.Where("idempotency_key = ?", key).Delete(&IdempotencyKey{}).Error
+}
+
+func (s dbIdempotencyStore) WithContext(ctx context.Context) IIdempotencyStore {
+	s.db = s.db.WithContext(ctx)
+	return &s
+}
@@ -0,0 +1,308 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/pskclub/mine-core/consts"
+	"github.com/pskclub/mine-core/utils"
+	"sync"
+	"time"
+)
+
+const DefaultJobPollInterval = time.Second
+
+// JobHandlerFunc process a job, a returned error retries the job until its MaxAttempts, see IJobQueue.Fail
+type JobHandlerFunc func(ctx IJobContext, job *Job) error
+
+type IJobContext interface {
+	IContext
+	JobQueue() IJobQueue
+	// Job return the job processed by a handler context, it is nil in the worker context
+	Job() *Job
+	// Handle process the jobs enqueued with name
+	Handle(name string, handler JobHandlerFunc)
+	Start()
+}
+
+type jobHandlers struct {
+	mutex    sync.RWMutex
+	handlers map[string]JobHandlerFunc
+}
+
+type JobContext struct {
+	IContext
+	queue        IJobQueue
+	job          *Job
+	handlers     *jobHandlers
+	concurrency  int
+	pollInterval time.Duration
+	lifecycle    ILifecycle
+	health       IHealth
+}
+
+// JobHandler decode the payload into T before calling handler, T is validated when it implements IValidateContext,
+// a payload that cannot be decoded or is invalid fails the job without retrying it
+func JobHandler[T any](handler func(ctx IJobContext, payload *T) error) JobHandlerFunc {
+	return func(ctx IJobContext, job *Job) error {
+		payload := new(T)
+		if err := utils.JSONParse(job.Payload, payload); err != nil {
+			return NewJobRejectError(err)
+		}
+
+		if v, ok := interface{}(payload).(IValidateContext); ok {
+			if ierr := v.Valid(ctx); ierr != nil {
+				return NewJobRejectError(ierr)
+			}
+		}
+
+		return handler(ctx, payload)
+	}
+}
+
+func (c *JobContext) JobQueue() IJobQueue {
+	return c.queue
+}
+
+func (c *JobContext) Job() *Job {
+	return c.job
+}
+
+func (c *JobContext) Handle(name string, handler JobHandlerFunc) {
+	c.handlers.mutex.Lock()
+	defer c.handlers.mutex.Unlock()
+
+	c.handlers.handlers[name] = handler
+}
+
+func (c *JobContext) Start() {
+	fmt.Println(fmt.Sprintf("Job Worker Service: %s", c.ENV().Config().Service))
+	if c.health != nil && c.ENV().Config().HealthHost != "" {
+		StartHealthServer(c.ENV().Config().HealthHost, c.health, c.lifecycle)
+	}
+
+	stdCtx, cancel := context.WithCancel(c.StdContext())
+	wg := &sync.WaitGroup{}
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(stdCtx)
+		}()
+	}
+
+	if c.lifecycle == nil {
+		wg.Wait()
+		cancel()
+		return
+	}
+
+	// the workers stop dequeuing and the running jobs are drained, a job still running after ctx is dequeued again once its lease is elapsed
+	c.lifecycle.AddService("job", func(ctx context.Context) error {
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	_ = c.lifecycle.Wait()
+}
+
+// work dequeue and process the jobs until ctx is done, it waits for the poll interval when no job is due
+func (c *JobContext) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := c.queue.Dequeue()
+		if err != nil {
+			c.NewError(err, JobError)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.pollInterval):
+			}
+			continue
+		}
+
+		c.process(job)
+	}
+}
+
+const (
+	JobContextDataID       = "job_id"
+	JobContextDataName     = "job_name"
+	JobContextDataAttempts = "job_attempts"
+)
+
+// jobContext return a child context for one job, it shares the connections but owns its data, user, request id and logger,
+// the job metadata is set in its data
+func (c *JobContext) jobContext(stdCtx context.Context, job *Job) *JobContext {
+	jobCtx := &JobContext{
+		IContext:     NewChildContext(c.IContext, stdCtx),
+		queue:        c.queue,
+		job:          job,
+		handlers:     c.handlers,
+		concurrency:  c.concurrency,
+		pollInterval: c.pollInterval,
+		lifecycle:    c.lifecycle,
+		health:       c.health,
+	}
+	jobCtx.SetData(echo.HeaderXRequestID, utils.GetUUID())
+	jobCtx.SetData(JobContextDataID, job.ID)
+	jobCtx.SetData(JobContextDataName, job.Name)
+	jobCtx.SetData(JobContextDataAttempts, job.Attempts)
+	return jobCtx
+}
+
+// process run the handler of job while its lease is extended, then complete or fail it
+func (c *JobContext) process(job *Job) {
+	stdCtx, cancel := context.WithCancel(c.StdContext())
+	defer cancel()
+
+	jobCtx := c.jobContext(stdCtx, job)
+	err := c.handle(jobCtx, job, cancel)
+	if errors.Is(err, ErrJobLeaseLost) {
+		// the job belongs to the worker which reclaimed it, completing or failing it here would overwrite its state
+		jobCtx.NewError(err, JobError, fmt.Sprintf("Job '%s' %s lost its lease", job.Name, job.ID))
+		return
+	}
+
+	if err != nil {
+		jobCtx.NewError(err, JobError, fmt.Sprintf("Job '%s' %s failed, attempt %d of %d", job.Name, job.ID, job.Attempts, job.MaxAttempts))
+		err = c.queue.Fail(job, err)
+	} else {
+		err = c.queue.Complete(job)
+	}
+
+	if err != nil {
+		jobCtx.NewError(err, JobError)
+	}
+}
+
+func (c *JobContext) handle(jobCtx *JobContext, job *Job, cancel context.CancelFunc) (err error) {
+	// the previous worker died during the last attempt
+	if job.Attempts > job.MaxAttempts {
+		return NewJobRejectError(errors.New("job lease is elapsed"))
+	}
+
+	c.handlers.mutex.RLock()
+	handler, ok := c.handlers.handlers[job.Name]
+	c.handlers.mutex.RUnlock()
+	if !ok {
+		return NewJobRejectError(fmt.Errorf("job '%s' has no handler", job.Name))
+	}
+
+	stopExtend := c.extendLease(jobCtx, job, cancel)
+	defer func() {
+		if leaseErr := stopExtend(); leaseErr != nil {
+			err = leaseErr
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			var isErr bool
+			err, isErr = r.(error)
+			if !isErr {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	return handler(jobCtx, job)
+}
+
+// extendLease renew the lease of job while it runs, the job context is cancelled when the lease cannot be renewed.
+// The returned func stops renewing and returns ErrJobLeaseLost when the lease was lost meanwhile
+func (c *JobContext) extendLease(jobCtx IJobContext, job *Job, cancel context.CancelFunc) func() error {
+	interval := DefaultJobLease / 3
+	if job.LeaseUntil != nil {
+		interval = time.Until(*job.LeaseUntil) / 3
+	}
+
+	if interval <= 0 {
+		return func() error {
+			return nil
+		}
+	}
+
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				result <- nil
+				return
+			case <-ticker.C:
+				err := c.queue.Extend(job)
+				if errors.Is(err, ErrJobLeaseLost) {
+					cancel()
+					result <- err
+					return
+				}
+
+				if err != nil {
+					jobCtx.NewError(err, JobError, fmt.Sprintf("Job '%s' %s cannot extend its lease", job.Name, job.ID))
+					cancel()
+					result <- nil
+					return
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		return <-result
+	}
+}
+
+type JobContextOptions struct {
+	ContextOptions *ContextOptions
+	Queue          IJobQueue
+	// Concurrency is the number of jobs processed at the same time, defaults to 1
+	Concurrency int
+	// PollInterval is the wait before dequeuing again when no job is due, defaults to DefaultJobPollInterval
+	PollInterval time.Duration
+	Lifecycle    ILifecycle
+	// Health is served on ENVConfig.HealthHost by a side listener when both are set
+	Health IHealth
+}
+
+func NewJobContext(options *JobContextOptions) IJobContext {
+	ctxOptions := options.ContextOptions
+	ctxOptions.contextType = consts.JOB
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	pollInterval := options.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultJobPollInterval
+	}
+
+	return &JobContext{
+		IContext:     NewContext(ctxOptions),
+		queue:        options.Queue,
+		handlers:     &jobHandlers{handlers: make(map[string]JobHandlerFunc)},
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+		lifecycle:    options.Lifecycle,
+		health:       options.Health,
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func newJobTestContext(queue IJobQueue) *JobContext {
+	return NewJobContext(&JobContextOptions{
+		ContextOptions: &ContextOptions{ENV: newTestENV(&ENVConfig{Service: "mail"})},
+		Queue:          queue,
+	}).(*JobContext)
+}
+
+type jobTestPayload struct {
+	To string `json:"to"`
+}
+
+func TestJobContext_Process(t *testing.T) {
+	queue := NewMockJobQueue()
+	c := newJobTestContext(queue)
+
+	var received *jobTestPayload
+	var jobID interface{}
+	c.Handle("send", JobHandler(func(ctx IJobContext, payload *jobTestPayload) error {
+		received = payload
+		jobID = ctx.GetData(JobContextDataID)
+		return nil
+	}))
+
+	job := &Job{ID: "1", Name: "send", Payload: []byte(`{"to":"a@b.c"}`), Attempts: 1, MaxAttempts: 3}
+	queue.On("Complete", job).Return(nil).Once()
+	c.process(job)
+	queue.AssertExpectations(t)
+	assert.Equal(t, "a@b.c", received.To)
+	assert.Equal(t, "1", jobID)
+	assert.Nil(t, c.GetData(JobContextDataID))
+}
+
+func TestJobContext_ProcessFail(t *testing.T) {
+	queue := NewMockJobQueue()
+	c := newJobTestContext(queue)
+	c.Handle("send", func(ctx IJobContext, job *Job) error {
+		return errors.New("unavailable")
+	})
+	c.Handle("panic", func(ctx IJobContext, job *Job) error {
+		panic("boom")
+	})
+
+	job := &Job{ID: "1", Name: "send", Attempts: 1, MaxAttempts: 3}
+	queue.On("Fail", job, mock.MatchedBy(func(err error) bool {
+		return err.Error() == "unavailable"
+	})).Return(nil).Once()
+	c.process(job)
+
+	panicked := &Job{ID: "2", Name: "panic", Attempts: 1, MaxAttempts: 3}
+	queue.On("Fail", panicked, mock.MatchedBy(func(err error) bool {
+		return err.Error() == "boom"
+	})).Return(nil).Once()
+	c.process(panicked)
+
+	unknown := &Job{ID: "3", Name: "unknown", Attempts: 1, MaxAttempts: 3}
+	queue.On("Fail", unknown, mock.MatchedBy(func(err error) bool {
+		rejectErr := &JobRejectError{}
+		return errors.As(err, &rejectErr)
+	})).Return(nil).Once()
+	c.process(unknown)
+
+	queue.AssertExpectations(t)
+}
+
+func TestJobContext_ProcessLeaseLost(t *testing.T) {
+	queue := NewMockJobQueue()
+	c := newJobTestContext(queue)
+	c.Handle("send", func(ctx IJobContext, job *Job) error {
+		<-ctx.StdContext().Done()
+		return ctx.StdContext().Err()
+	})
+
+	leaseUntil := time.Now().Add(30 * time.Millisecond)
+	job := &Job{ID: "1", Name: "send", Attempts: 1, MaxAttempts: 3, LeaseUntil: &leaseUntil}
+	queue.On("Extend", job).Return(ErrJobLeaseLost).Once()
+
+	done := make(chan struct{})
+	go func() {
+		c.process(job)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the job is not stopped when its lease is lost")
+	}
+
+	// the job is neither completed nor failed, it belongs to the worker which reclaimed it
+	queue.AssertExpectations(t)
+	queue.AssertNotCalled(t, "Complete", mock.Anything)
+	queue.AssertNotCalled(t, "Fail", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,387 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/pskclub/mine-core/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusRetrying  = "retrying"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+const (
+	DefaultJobQueueName     = "default"
+	DefaultJobMaxAttempts   = 3
+	DefaultJobLease         = 5 * time.Minute
+	DefaultJobRetryDelay    = 5 * time.Second
+	DefaultJobMaxRetryDelay = time.Hour
+	DefaultJobRetention     = 24 * time.Hour
+)
+
+// jobPriorityWeight spread the priorities in the ready set, a higher priority is always dequeued before a lower one
+const jobPriorityWeight = 1e13
+
+// ErrJobLeaseLost is returned by Extend when the lease elapsed and the job was reclaimed, another worker may run it
+var ErrJobLeaseLost = errors.New("job: the lease is lost")
+
+var JobError = Error{
+	Status:  http.StatusInternalServerError,
+	Code:    "JOB_ERROR",
+	Message: "job internal error"}
+
+// JobRejectError fail a job without retrying it
+type JobRejectError struct {
+	Err error
+}
+
+func NewJobRejectError(err error) error {
+	return &JobRejectError{Err: err}
+}
+
+func (e *JobRejectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *JobRejectError) Unwrap() error {
+	return e.Err
+}
+
+// Job is an enqueued job and its status, it is kept for JobQueueOptions.Retention once it is completed or failed
+type Job struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Name        string          `json:"name"`
+	Payload     json.RawMessage `json:"payload"`
+	Priority    int             `json:"priority"`
+	MaxAttempts int             `json:"max_attempts"`
+	Attempts    int             `json:"attempts"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	LeaseUntil  *time.Time      `json:"lease_until,omitempty"`
+}
+
+type JobEnqueueOptions struct {
+	// Delay run the job once it is elapsed
+	Delay time.Duration
+	// RunAt run the job at this time, it takes precedence over Delay
+	RunAt time.Time
+	// Priority is the order of the due jobs, the highest first
+	Priority int
+	// MaxAttempts is the number of runs before the job is failed, defaults to DefaultJobMaxAttempts
+	MaxAttempts int
+	// UniqueKey prevent enqueueing another job with the same key until this one is completed or failed
+	UniqueKey string
+}
+
+type IJobQueue interface {
+	// Enqueue add a job handled by the handler name, a job whose UniqueKey is already pending is not enqueued and the pending job is returned
+	Enqueue(name string, payload interface{}, options *JobEnqueueOptions) (*Job, error)
+	// Get return the job id, or nil when it does not exist or its retention is elapsed
+	Get(id string) (*Job, error)
+	// Dequeue reserve the next due job until its LeaseUntil, it returns nil when no job is due.
+	// A job whose lease is elapsed is dequeued again, its worker is considered dead
+	Dequeue() (*Job, error)
+	// Extend renew the lease of a running job, it returns ErrJobLeaseLost when the lease is not held by job anymore
+	Extend(job *Job) error
+	Complete(job *Job) error
+	// Fail retry the job with a backoff, or fail it when its attempts are exhausted or err is a JobRejectError
+	Fail(job *Job, err error) error
+	WithContext(ctx context.Context) IJobQueue
+}
+
+type JobQueueOptions struct {
+	// Name is the queue, the workers of a queue must handle every job name enqueued in it, defaults to DefaultJobQueueName
+	Name          string
+	Lease         time.Duration
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Retention keep the completed and failed jobs for Get
+	Retention time.Duration
+}
+
+const (
+	jobEnqueueScript = `if KEYS[4] then
+	local existing = redis.call("get", KEYS[4])
+	if existing then return existing end
+	redis.call("set", KEYS[4], ARGV[1])
+end
+redis.call("set", KEYS[1], ARGV[2])
+redis.call("hset", KEYS[3], ARGV[1], ARGV[4])
+redis.call("zadd", KEYS[2], ARGV[3], ARGV[1])
+return ARGV[1]`
+	jobDequeueScript = `local now = tonumber(ARGV[1])
+local function ready(set)
+	local ids = redis.call("zrangebyscore", set, "-inf", now, "LIMIT", 0, 100)
+	for _, id in ipairs(ids) do
+		redis.call("zrem", set, id)
+		local priority = tonumber(redis.call("hget", KEYS[4], id) or "0")
+		redis.call("zadd", KEYS[1], -priority * tonumber(ARGV[3]) + now, id)
+	end
+end
+ready(KEYS[2])
+ready(KEYS[3])
+local popped = redis.call("zpopmin", KEYS[1])
+if #popped == 0 then return false end
+redis.call("zadd", KEYS[3], ARGV[2], popped[1])
+return popped[1]`
+	jobDropScript = `redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+return 1`
+	jobExtendScript = `local score = redis.call("zscore", KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[3]) then return 0 end
+redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+return 1`
+	jobFinishScript = `redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1])
+redis.call("set", KEYS[2], ARGV[2], "PX", ARGV[3])
+if KEYS[4] then redis.call("del", KEYS[4]) end
+return 1`
+	jobRetryScript = `redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("set", KEYS[2], ARGV[2])
+redis.call("zadd", KEYS[3], ARGV[3], ARGV[1])
+return 1`
+)
+
+type jobQueue struct {
+	cache   ICache
+	options JobQueueOptions
+}
+
+// NewJobQueue create a job queue on Redis, the due jobs are in a sorted set by priority, the delayed and retried jobs
+// in a sorted set by run time and the running jobs in a sorted set by lease, every key shares the {jobs:<name>} hash tag
+func NewJobQueue(cache ICache, options *JobQueueOptions) IJobQueue {
+	queueOptions := JobQueueOptions{}
+	if options != nil {
+		queueOptions = *options
+	}
+
+	if queueOptions.Name == "" {
+		queueOptions.Name = DefaultJobQueueName
+	}
+
+	if queueOptions.Lease <= 0 {
+		queueOptions.Lease = DefaultJobLease
+	}
+
+	if queueOptions.RetryDelay <= 0 {
+		queueOptions.RetryDelay = DefaultJobRetryDelay
+	}
+
+	if queueOptions.MaxRetryDelay <= 0 {
+		queueOptions.MaxRetryDelay = DefaultJobMaxRetryDelay
+	}
+
+	if queueOptions.Retention <= 0 {
+		queueOptions.Retention = DefaultJobRetention
+	}
+
+	return &jobQueue{cache: cache, options: queueOptions}
+}
+
+func (q jobQueue) key(name string) string {
+	return fmt.Sprintf("jobs:{%s}:%s", q.options.Name, name)
+}
+
+func (q jobQueue) jobKey(id string) string {
+	return q.key("job:" + id)
+}
+
+// finishKeys return the keys of the finish script, the unique key is only set when the job has one
+func (q jobQueue) finishKeys(job *Job) []string {
+	keys := []string{q.key("active"), q.jobKey(job.ID), q.key("priorities")}
+	if job.UniqueKey != "" {
+		keys = append(keys, q.key("unique:"+job.UniqueKey))
+	}
+
+	return keys
+}
+
+func jobScore(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func (q jobQueue) Enqueue(name string, payload interface{}, options *JobEnqueueOptions) (*Job, error) {
+	if options == nil {
+		options = &JobEnqueueOptions{}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          utils.GetUUID(),
+		Queue:       q.options.Name,
+		Name:        name,
+		Payload:     body,
+		Priority:    options.Priority,
+		MaxAttempts: options.MaxAttempts,
+		Status:      JobStatusPending,
+		UniqueKey:   options.UniqueKey,
+		RunAt:       options.RunAt,
+		CreatedAt:   now,
+	}
+
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
+
+	if job.RunAt.IsZero() {
+		job.RunAt = now.Add(options.Delay)
+	}
+
+	// a due job goes straight to the ready set, the others wait in the delayed set until Dequeue moves them
+	set := q.key("delayed")
+	score := jobScore(job.RunAt)
+	if !job.RunAt.After(now) {
+		set = q.key("ready")
+		score = strconv.FormatFloat(-float64(job.Priority)*jobPriorityWeight+float64(now.UnixMilli()), 'f', 0, 64)
+	}
+
+	keys := []string{q.jobKey(job.ID), set, q.key("priorities")}
+	if job.UniqueKey != "" {
+		keys = append(keys, q.key("unique:"+job.UniqueKey))
+	}
+
+	id, err := q.cache.Eval(jobEnqueueScript, keys, job.ID, utils.JSONToString(job), score, job.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	if id != job.ID {
+		return q.Get(fmt.Sprintf("%v", id))
+	}
+
+	return job, nil
+}
+
+func (q jobQueue) Get(id string) (*Job, error) {
+	job := &Job{}
+	err := q.cache.GetJSON(job, q.jobKey(id))
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q jobQueue) Dequeue() (*Job, error) {
+	now := time.Now()
+	leaseUntil := now.Add(q.options.Lease)
+	keys := []string{q.key("ready"), q.key("delayed"), q.key("active"), q.key("priorities")}
+	job := &Job{}
+	for {
+		// the script only touches its declared keys and returns the leased id, the job is read afterwards
+		id, err := q.cache.Eval(jobDequeueScript, keys, now.UnixMilli(), leaseUntil.UnixMilli(), jobPriorityWeight)
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = q.cache.GetJSON(job, q.jobKey(fmt.Sprintf("%v", id)))
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		// an id whose job is missing is dropped so it is not leased forever
+		_, err = q.cache.Eval(jobDropScript, []string{q.key("active"), q.key("priorities")}, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	job.Status = JobStatusRunning
+	job.Attempts++
+	job.StartedAt = &now
+	job.LeaseUntil = &leaseUntil
+	err := q.cache.SetJSON(q.jobKey(job.ID), job, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q jobQueue) Extend(job *Job) error {
+	if job.LeaseUntil == nil {
+		return ErrJobLeaseLost
+	}
+
+	// the lease is only renewed while its score is still the one of job, a reclaimed job was leased again or moved away
+	leaseUntil := time.Now().Add(q.options.Lease)
+	extended, err := q.cache.Eval(jobExtendScript, []string{q.key("active")}, job.ID, leaseUntil.UnixMilli(), job.LeaseUntil.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	if extended == int64(0) {
+		return ErrJobLeaseLost
+	}
+
+	job.LeaseUntil = &leaseUntil
+	return nil
+}
+
+func (q jobQueue) Complete(job *Job) error {
+	now := time.Now()
+	job.Status = JobStatusCompleted
+	job.Error = ""
+	job.FinishedAt = &now
+	job.LeaseUntil = nil
+	_, err := q.cache.Eval(jobFinishScript, q.finishKeys(job), job.ID, utils.JSONToString(job), q.options.Retention.Milliseconds())
+	return err
+}
+
+func (q jobQueue) Fail(job *Job, err error) error {
+	job.Error = err.Error()
+	job.LeaseUntil = nil
+
+	rejectErr := &JobRejectError{}
+	if job.Attempts >= job.MaxAttempts || errors.As(err, &rejectErr) {
+		now := time.Now()
+		job.Status = JobStatusFailed
+		job.FinishedAt = &now
+		_, err = q.cache.Eval(jobFinishScript, q.finishKeys(job), job.ID, utils.JSONToString(job), q.options.Retention.Milliseconds())
+		return err
+	}
+
+	job.Status = JobStatusRetrying
+	job.RunAt = time.Now().Add(mqRetryDelay(job.Attempts-1, q.options.RetryDelay, q.options.MaxRetryDelay))
+	keys := []string{q.key("active"), q.jobKey(job.ID), q.key("delayed")}
+	_, err = q.cache.Eval(jobRetryScript, keys, job.ID, utils.JSONToString(job), jobScore(job.RunAt))
+	return err
+}
+
+func (q jobQueue) WithContext(ctx context.Context) IJobQueue {
+	q.cache = q.cache.WithContext(ctx)
+	return &q
+}
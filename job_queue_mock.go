@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockJobQueue struct {
+	mock.Mock
+}
+
+func NewMockJobQueue() *MockJobQueue {
+	return &MockJobQueue{}
+}
+
+func (m *MockJobQueue) Enqueue(name string, payload interface{}, options *JobEnqueueOptions) (*Job, error) {
+	args := m.Called(name, payload, options)
+	job, _ := args.Get(0).(*Job)
+	return job, args.Error(1)
+}
+
+func (m *MockJobQueue) Get(id string) (*Job, error) {
+	args := m.Called(id)
+	job, _ := args.Get(0).(*Job)
+	return job, args.Error(1)
+}
+
+func (m *MockJobQueue) Dequeue() (*Job, error) {
+	args := m.Called()
+	job, _ := args.Get(0).(*Job)
+	return job, args.Error(1)
+}
+
+func (m *MockJobQueue) Extend(job *Job) error {
+	args := m.Called(job)
+	return args.Error(0)
+}
+
+func (m *MockJobQueue) Complete(job *Job) error {
+	args := m.Called(job)
+	return args.Error(0)
+}
+
+func (m *MockJobQueue) Fail(job *Job, err error) error {
+	args := m.Called(job, err)
+	return args.Error(0)
+}
+
+func (m *MockJobQueue) WithContext(ctx context.Context) IJobQueue {
+	return m
+}
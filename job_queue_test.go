@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/pskclub/mine-core/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+type jobTestCache struct {
+	*MockCache
+	scripts []string
+	keys    [][]string
+	eval    func(keys []string, args ...interface{}) interface{}
+}
+
+func (c *jobTestCache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	c.scripts = append(c.scripts, script)
+	c.keys = append(c.keys, keys)
+	result := c.eval(keys, args...)
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func TestJobQueue_Enqueue(t *testing.T) {
+	cache := &jobTestCache{MockCache: NewMockCache(), eval: func(keys []string, args ...interface{}) interface{} {
+		return args[0]
+	}}
+	queue := NewJobQueue(cache, &JobQueueOptions{Name: "mail"})
+
+	job, err := queue.Enqueue("send", map[string]string{"to": "a@b.c"}, &JobEnqueueOptions{Priority: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "send", job.Name)
+	assert.Equal(t, JobStatusPending, job.Status)
+	assert.Equal(t, DefaultJobMaxAttempts, job.MaxAttempts)
+	assert.JSONEq(t, `{"to":"a@b.c"}`, string(job.Payload))
+	assert.Equal(t, []string{"jobs:{mail}:job:" + job.ID, "jobs:{mail}:ready", "jobs:{mail}:priorities"}, cache.keys[0])
+
+	_, err = queue.Enqueue("send", nil, &JobEnqueueOptions{Delay: time.Minute, UniqueKey: "user:1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "jobs:{mail}:delayed", cache.keys[1][1])
+	assert.Equal(t, "jobs:{mail}:unique:user:1", cache.keys[1][3])
+}
+
+func TestJobQueue_EnqueueDuplicated(t *testing.T) {
+	cache := &jobTestCache{MockCache: NewMockCache(), eval: func(keys []string, args ...interface{}) interface{} {
+		return "pending-id"
+	}}
+	cache.On("GetJSON", mock.Anything, "jobs:{default}:job:pending-id").Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*Job).ID = "pending-id"
+	})
+	queue := NewJobQueue(cache, nil)
+
+	job, err := queue.Enqueue("send", nil, &JobEnqueueOptions{UniqueKey: "user:1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "pending-id", job.ID)
+}
+
+func TestJobQueue_Fail(t *testing.T) {
+	cache := &jobTestCache{MockCache: NewMockCache(), eval: func(keys []string, args ...interface{}) interface{} {
+		return int64(1)
+	}}
+	queue := NewJobQueue(cache, nil)
+
+	job := &Job{ID: "1", Attempts: 1, MaxAttempts: 3}
+	assert.NoError(t, queue.Fail(job, errors.New("unavailable")))
+	assert.Equal(t, JobStatusRetrying, job.Status)
+	assert.Equal(t, jobRetryScript, cache.scripts[0])
+	assert.WithinDuration(t, time.Now().Add(DefaultJobRetryDelay), job.RunAt, time.Second)
+
+	assert.NoError(t, queue.Fail(job, NewJobRejectError(errors.New("invalid"))))
+	assert.Equal(t, JobStatusFailed, job.Status)
+	assert.Equal(t, jobFinishScript, cache.scripts[1])
+	assert.Equal(t, "invalid", job.Error)
+}
+
+func TestJobQueue_Dequeue(t *testing.T) {
+	cache := &jobTestCache{MockCache: NewMockCache(), eval: func(keys []string, args ...interface{}) interface{} {
+		return "1"
+	}}
+	cache.On("GetJSON", mock.Anything, "jobs:{mail}:job:1").Return(nil).Run(func(args mock.Arguments) {
+		_ = utils.JSONParse([]byte(`{"id":"1","queue":"mail","name":"send","payload":{"to":"a@b.c"},"max_attempts":3,"status":"pending"}`), args.Get(0))
+	})
+	cache.On("SetJSON", "jobs:{mail}:job:1", mock.Anything, time.Duration(0)).Return(nil)
+	queue := NewJobQueue(cache, &JobQueueOptions{Name: "mail"})
+
+	job, err := queue.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", job.ID)
+	assert.Equal(t, JobStatusRunning, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.JSONEq(t, `{"to":"a@b.c"}`, string(job.Payload))
+	assert.WithinDuration(t, time.Now().Add(DefaultJobLease), *job.LeaseUntil, time.Second)
+	assert.Equal(t, jobDequeueScript, cache.scripts[0])
+	assert.Equal(t, []string{"jobs:{mail}:ready", "jobs:{mail}:delayed", "jobs:{mail}:active", "jobs:{mail}:priorities"}, cache.keys[0])
+	cache.AssertCalled(t, "SetJSON", "jobs:{mail}:job:1", job, time.Duration(0))
+}
+
+func TestJobQueue_DequeueMissingJob(t *testing.T) {
+	ids := []interface{}{"1", redis.Nil}
+	cache := &jobTestCache{MockCache: NewMockCache()}
+	cache.eval = func(keys []string, args ...interface{}) interface{} {
+		if cache.scripts[len(cache.scripts)-1] == jobDropScript {
+			return int64(1)
+		}
+
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	cache.On("GetJSON", mock.Anything, "jobs:{mail}:job:1").Return(redis.Nil)
+	queue := NewJobQueue(cache, &JobQueueOptions{Name: "mail"})
+
+	// the id whose job expired is dropped from the active set and the next id is dequeued
+	job, err := queue.Dequeue()
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+	assert.Equal(t, []string{jobDequeueScript, jobDropScript, jobDequeueScript}, cache.scripts)
+	assert.Equal(t, []string{"jobs:{mail}:active", "jobs:{mail}:priorities"}, cache.keys[1])
+	cache.AssertNotCalled(t, "SetJSON", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestJobQueue_Extend(t *testing.T) {
+	extended := int64(1)
+	cache := &jobTestCache{MockCache: NewMockCache(), eval: func(keys []string, args ...interface{}) interface{} {
+		return extended
+	}}
+	queue := NewJobQueue(cache, &JobQueueOptions{Name: "mail"})
+	leaseUntil := time.Now().Add(time.Second)
+	job := &Job{ID: "1", LeaseUntil: &leaseUntil}
+
+	assert.NoError(t, queue.Extend(job))
+	assert.WithinDuration(t, time.Now().Add(DefaultJobLease), *job.LeaseUntil, time.Second)
+	assert.Equal(t, []string{"jobs:{mail}:active"}, cache.keys[0])
+
+	// the lease was reclaimed by another worker
+	extended = 0
+	current := *job.LeaseUntil
+	assert.ErrorIs(t, queue.Extend(job), ErrJobLeaseLost)
+	assert.Equal(t, current, *job.LeaseUntil)
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const DefaultShutdownTimeout = 30 * time.Second
+
+type LifecycleHook func(ctx context.Context) error
+
+type ILifecycle interface {
+	// StdContext return the root context, it is cancelled once every service is drained
+	StdContext() context.Context
+	// AddService register a hook that stops accepting new work and waits for in-flight work
+	AddService(name string, stop LifecycleHook)
+	// AddCloser register a hook that closes a connection, closers run in reverse order after every service is stopped
+	AddCloser(name string, close LifecycleHook)
+	// Shutdown trigger the shutdown without waiting for a signal
+	Shutdown()
+	// Wait block until a signal is received or Shutdown is called, then run the shutdown sequence
+	Wait() error
+}
+
+type LifecycleOptions struct {
+	ContextOptions  *ContextOptions
+	ShutdownTimeout time.Duration
+	Signals         []os.Signal
+}
+
+type lifecycleHook struct {
+	name string
+	hook LifecycleHook
+}
+
+type Lifecycle struct {
+	ctx             context.Context
+	cancel          context.CancelFunc
+	shutdownTimeout time.Duration
+	signals         []os.Signal
+	mutex           sync.Mutex
+	services        []lifecycleHook
+	closers         []lifecycleHook
+	done            chan struct{}
+	doneOnce        sync.Once
+	waitOnce        sync.Once
+	waitErr         error
+}
+
+// NewLifecycle create the lifecycle manager and register a closer for every resource in options.ContextOptions
+func NewLifecycle(options *LifecycleOptions) *Lifecycle {
+	if options == nil {
+		options = &LifecycleOptions{}
+	}
+
+	parent := context.Background()
+	if options.ContextOptions != nil && options.ContextOptions.StdContext != nil {
+		parent = options.ContextOptions.StdContext
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	lc := &Lifecycle{
+		ctx:             ctx,
+		cancel:          cancel,
+		shutdownTimeout: options.ShutdownTimeout,
+		signals:         options.Signals,
+		done:            make(chan struct{}),
+	}
+
+	if lc.shutdownTimeout <= 0 {
+		lc.shutdownTimeout = DefaultShutdownTimeout
+		if options.ContextOptions != nil && options.ContextOptions.ENV != nil && options.ContextOptions.ENV.Config().ShutdownTimeout > 0 {
+			lc.shutdownTimeout = options.ContextOptions.ENV.Config().ShutdownTimeout
+		}
+	}
+
+	if len(lc.signals) == 0 {
+		lc.signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	lc.AddCloser("sentry", func(ctx context.Context) error {
+		sentry.Flush(2 * time.Second)
+		return nil
+	})
+
+	if options.ContextOptions != nil {
+		lc.addContextOptionsClosers(options.ContextOptions)
+		options.ContextOptions.StdContext = ctx
+	}
+
+	return lc
+}
+
+func (lc *Lifecycle) addContextOptionsClosers(options *ContextOptions) {
+	if options.DB != nil {
+		db := options.DB
+		lc.AddCloser("database", func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+
+			return sqlDB.Close()
+		})
+	}
+
+	for name, db := range options.DBS {
+		db := db
+		lc.AddCloser(fmt.Sprintf("database:%s", name), func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+
+			return sqlDB.Close()
+		})
+	}
+
+	if options.MongoDB != nil {
+		lc.AddCloser("mongodb", lc.closeFunc(options.MongoDB.Close))
+	}
+
+	for name, db := range options.MongoDBS {
+		lc.AddCloser(fmt.Sprintf("mongodb:%s", name), lc.closeFunc(db.Close))
+	}
+
+	if options.Cache != nil {
+		lc.AddCloser("cache", lc.closeFunc(options.Cache.Close))
+	}
+
+	for name, cache := range options.Caches {
+		lc.AddCloser(fmt.Sprintf("cache:%s", name), lc.closeFunc(cache.Close))
+	}
+
+	if options.MQ != nil {
+		lc.AddCloser("mq", lc.closeFunc(options.MQ.Close))
+	}
+}
+
+// closeFunc wrap a Close function that panics on failure into a LifecycleHook
+func (lc *Lifecycle) closeFunc(closeFn func()) LifecycleHook {
+	return func(ctx context.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		closeFn()
+		return nil
+	}
+}
+
+func (lc *Lifecycle) StdContext() context.Context {
+	return lc.ctx
+}
+
+func (lc *Lifecycle) AddService(name string, stop LifecycleHook) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	lc.services = append(lc.services, lifecycleHook{name: name, hook: stop})
+}
+
+func (lc *Lifecycle) AddCloser(name string, close LifecycleHook) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	lc.closers = append(lc.closers, lifecycleHook{name: name, hook: close})
+}
+
+func (lc *Lifecycle) Shutdown() {
+	lc.doneOnce.Do(func() {
+		close(lc.done)
+	})
+}
+
+func (lc *Lifecycle) Wait() error {
+	lc.waitOnce.Do(func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, lc.signals...)
+		defer signal.Stop(quit)
+
+		select {
+		case sig := <-quit:
+			fmt.Println(fmt.Sprintf("Received %s, shutting down", sig))
+		case <-lc.done:
+			fmt.Println("Shutting down")
+		}
+
+		lc.waitErr = lc.shutdown()
+	})
+
+	return lc.waitErr
+}
+
+// shutdown stop every service in parallel, then close every connection in reverse order of registration
+func (lc *Lifecycle) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lc.shutdownTimeout)
+	defer cancel()
+
+	lc.mutex.Lock()
+	services := lc.services
+	closers := lc.closers
+	lc.mutex.Unlock()
+
+	errs := make([]error, 0)
+	errsMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, service := range services {
+		wg.Add(1)
+		go func(service lifecycleHook) {
+			defer wg.Done()
+			if err := service.hook(ctx); err != nil {
+				errsMutex.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", service.name, err))
+				errsMutex.Unlock()
+			}
+		}(service)
+	}
+	wg.Wait()
+
+	lc.cancel()
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), lc.shutdownTimeout)
+	defer closeCancel()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].hook(closeCtx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", closers[i].name, err))
+		}
+	}
+
+	for _, err := range errs {
+		fmt.Println(fmt.Sprintf("Shutdown error: %v", err))
+	}
+
+	return errors.Join(errs...)
+}
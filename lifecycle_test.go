@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLifecycle_ShutdownOrder(t *testing.T) {
+	lc := NewLifecycle(&LifecycleOptions{ShutdownTimeout: time.Second})
+	calls := make([]string, 0)
+
+	lc.AddCloser("first", func(ctx context.Context) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	lc.AddCloser("second", func(ctx context.Context) error {
+		calls = append(calls, "second")
+		return nil
+	})
+	lc.AddService("service", func(ctx context.Context) error {
+		assert.NoError(t, lc.StdContext().Err())
+		calls = append(calls, "service")
+		return nil
+	})
+
+	lc.Shutdown()
+	err := lc.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"service", "second", "first"}, calls)
+	assert.Equal(t, context.Canceled, lc.StdContext().Err())
+}
+
+func TestLifecycle_ShutdownError(t *testing.T) {
+	lc := NewLifecycle(&LifecycleOptions{ShutdownTimeout: time.Second})
+	lc.AddCloser("cache", lc.closeFunc(func() {
+		panic("close failed")
+	}))
+	lc.AddService("service", func(ctx context.Context) error {
+		return errors.New("drain failed")
+	})
+
+	lc.Shutdown()
+	err := lc.Wait()
+	assert.ErrorContains(t, err, "service: drain failed")
+	assert.ErrorContains(t, err, "cache: close failed")
+}
+
+func TestLifecycle_ServiceDeadline(t *testing.T) {
+	lc := NewLifecycle(&LifecycleOptions{ShutdownTimeout: 10 * time.Millisecond})
+	lc.AddService("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	lc.Shutdown()
+	err := lc.Wait()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
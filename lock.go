@@ -0,0 +1,189 @@
+package core
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pskclub/mine-core/utils"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"time"
+)
+
+// ErrLockNotHeld is returned when a lock is refreshed or released after it expired or was taken by another instance
+var ErrLockNotHeld = errors.New("lock is not held")
+
+type ILocker interface {
+	// TryLock acquire key for ttl without waiting, it returns a nil ILock when another instance holds key
+	TryLock(ctx context.Context, key string, ttl time.Duration) (ILock, error)
+}
+
+type ILock interface {
+	// Refresh extend the lock for ttl
+	Refresh(ctx context.Context, ttl time.Duration) error
+	Unlock(ctx context.Context) error
+}
+
+const (
+	cacheLockRefreshScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	cacheLockUnlockScript  = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+type cacheLocker struct {
+	cache ICache
+}
+
+// NewCacheLocker create a locker on Redis, a lock is a key holding a random token that expires after its ttl
+func NewCacheLocker(cache ICache) ILocker {
+	return &cacheLocker{cache: cache}
+}
+
+func (l cacheLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (ILock, error) {
+	token := utils.GetUUID()
+	ok, err := l.cache.WithContext(ctx).SetNX(key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &cacheLock{cache: l.cache, key: key, token: token}, nil
+}
+
+type cacheLock struct {
+	cache ICache
+	key   string
+	token string
+}
+
+func (l cacheLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	result, err := l.cache.WithContext(ctx).Eval(cacheLockRefreshScript, []string{l.key}, l.token, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	if result == int64(0) {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+func (l cacheLock) Unlock(ctx context.Context) error {
+	result, err := l.cache.WithContext(ctx).Eval(cacheLockUnlockScript, []string{l.key}, l.token)
+	if err != nil {
+		return err
+	}
+
+	if result == int64(0) {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+type dbLocker struct {
+	db *gorm.DB
+}
+
+// NewDBLocker create a locker on the session level advisory locks of postgres, mysql or mssql,
+// a lock keeps a connection of the pool until it is released, so it never expires and ttl is ignored
+func NewDBLocker(db *gorm.DB) ILocker {
+	return &dbLocker{db: db}
+}
+
+func (l dbLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (ILock, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &dbLock{conn: conn, dialect: l.db.Dialector.Name(), key: key}
+	ok, err := lock.tryLock(ctx)
+	if err != nil || !ok {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+type dbLock struct {
+	conn    *sql.Conn
+	dialect string
+	key     string
+}
+
+// name return the key, hashed when it is longer than the lock names of the dialect, 64 characters for mysql and
+// 255 for mssql
+func (l dbLock) name() string {
+	limit := 255
+	if l.dialect == DatabaseDriverMYSQL {
+		limit = 64
+	}
+
+	if len(l.key) <= limit {
+		return l.key
+	}
+
+	sum := sha1.Sum([]byte(l.key))
+	return hex.EncodeToString(sum[:])
+}
+
+// advisoryKey hash the key to the bigint expected by the postgres advisory locks
+func (l dbLock) advisoryKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.key))
+	return int64(h.Sum64())
+}
+
+func (l dbLock) tryLock(ctx context.Context) (bool, error) {
+	var ok bool
+	switch l.dialect {
+	case DatabaseDriverPOSTGRES:
+		err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.advisoryKey()).Scan(&ok)
+		return ok, err
+	case DatabaseDriverMYSQL:
+		var result sql.NullInt64
+		err := l.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", l.name()).Scan(&result)
+		return result.Valid && result.Int64 == 1, err
+	case "sqlserver":
+		var result int
+		err := l.conn.QueryRowContext(ctx, `DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+SELECT @result`, l.name()).Scan(&result)
+		return result >= 0, err
+	}
+
+	return false, fmt.Errorf("advisory lock is not supported by %s", l.dialect)
+}
+
+func (l dbLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	return l.conn.PingContext(ctx)
+}
+
+func (l dbLock) Unlock(ctx context.Context) error {
+	defer l.conn.Close()
+
+	var err error
+	switch l.dialect {
+	case DatabaseDriverPOSTGRES:
+		_, err = l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.advisoryKey())
+	case DatabaseDriverMYSQL:
+		_, err = l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name())
+	case "sqlserver":
+		_, err = l.conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", l.name())
+	}
+
+	return err
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestCacheLocker_TryLock(t *testing.T) {
+	cache := NewMockCache()
+	cache.On("WithContext", mock.Anything).Return(cache)
+	cache.On("SetNX", "job", mock.Anything, time.Minute).Return(true, nil).Once()
+	cache.On("SetNX", "job", mock.Anything, time.Minute).Return(false, nil).Once()
+
+	locker := NewCacheLocker(cache)
+	lock, err := locker.TryLock(context.Background(), "job", time.Minute)
+	assert.NoError(t, err)
+	assert.NotNil(t, lock)
+
+	lock2, err := locker.TryLock(context.Background(), "job", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, lock2)
+
+	cache.On("Eval", cacheLockUnlockScript, []string{"job"}, mock.Anything).Return(int64(0), nil)
+	assert.ErrorIs(t, lock.Unlock(context.Background()), ErrLockNotHeld)
+}
+
+type cronjobTestLocker struct {
+	lock ILock
+}
+
+func (l cronjobTestLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (ILock, error) {
+	return l.lock, nil
+}
+
+type cronjobTestLock struct {
+	unlocked bool
+}
+
+func (l *cronjobTestLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	return nil
+}
+
+func (l *cronjobTestLock) Unlock(ctx context.Context) error {
+	l.unlocked = true
+	return nil
+}
+
+func TestCronjobContext_RunWithLock(t *testing.T) {
+	history := &memoryCronjobHistory{}
+	c := newCronjobTestContext(history)
+
+	calls := 0
+	handler := func(ctx ICronjobContext) error {
+		calls++
+		return nil
+	}
+
+	lock := &cronjobTestLock{}
+	c.run(&cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Locker: cronjobTestLocker{lock: lock}, LockTTL: time.Minute}})
+	assert.Equal(t, 1, calls)
+	assert.True(t, lock.unlocked)
+
+	run := c.run(&cronjobJob{handler: handler, options: &CronjobJobOptions{Name: "sync", Locker: cronjobTestLocker{}, LockTTL: time.Minute}})
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, CronjobRunStatusSkipped, run.Status)
+
+	assert.Len(t, history.runs, 2)
+	assert.Equal(t, CronjobRunStatusSkipped, history.runs[0].Status)
+	assert.Equal(t, CronjobRunStatusSuccess, history.runs[1].Status)
+}
+
+func TestDBLock_Name(t *testing.T) {
+	key := "cronjob:orders:github.com/acme/orders/services/cronjobs.NewSyncOrders.func1"
+	assert.Equal(t, "short", dbLock{dialect: DatabaseDriverMYSQL, key: "short"}.name())
+	assert.Len(t, dbLock{dialect: DatabaseDriverMYSQL, key: key}.name(), 40)
+	assert.Equal(t, dbLock{dialect: DatabaseDriverMYSQL, key: key}.name(), dbLock{dialect: DatabaseDriverMYSQL, key: key}.name())
+	assert.Equal(t, key, dbLock{dialect: "sqlserver", key: key}.name())
+}
+
+func TestCronjobContext_LockHold(t *testing.T) {
+	c := NewCronjobContext(&CronjobContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(&ENVConfig{Service: "orders"})}}).(*CronjobContext)
+	c.AddJob(c.Job().Every(30*time.Second), func(ctx ICronjobContext) error {
+		return nil
+	}, &CronjobJobOptions{Name: "sync", Locker: cronjobTestLocker{}})
+	c.cron.StartAsync()
+	defer c.cron.Stop()
+
+	job := c.findJob("sync")
+	hold := c.lockHold(job, time.Now())
+	assert.True(t, hold > 25*time.Second && hold <= 30*time.Second-DefaultCronjobLockMargin, hold)
+
+	job.options.LockTTL = 10 * time.Second
+	assert.Equal(t, 10*time.Second-DefaultCronjobLockMargin, c.lockHold(job, time.Now()))
+
+	job.options.LockMinHold = -1
+	assert.True(t, c.lockHold(job, time.Now()) < 0)
+}
+
+func TestCronjobContext_AddJobLockerWithoutName(t *testing.T) {
+	c := NewCronjobContext(&CronjobContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(&ENVConfig{Service: "orders"})}})
+	c.AddJob(c.Job().Every(time.Minute), func(ctx ICronjobContext) error {
+		return nil
+	}, &CronjobJobOptions{Locker: cronjobTestLocker{}})
+
+	assert.Empty(t, c.Jobs())
+}
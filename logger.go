@@ -123,6 +123,8 @@ func (logger *Logger) getLogFields(fn string, function string, line int, shortMe
 		fields["_source_ip"] = ctx.RealIP()
 		fields["_http_method"] = ctx.Request().Method
 		fields["_endpoint"] = ctx.Request().URL.RequestURI()
+	} else if requestID, ok := logger.ctx.GetData(echo.HeaderXRequestID).(string); ok {
+		fields["_request_id"] = requestID
 	}
 
 	return fields
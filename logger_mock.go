@@ -27,3 +27,11 @@ func (m *MockLogger) Debug(args ...interface{}) {
 func (m *MockLogger) Error(message error, args ...interface{}) {
 	m.Called(message, args)
 }
+
+func (m *MockLogger) DebugWithSkip(skip int, args ...interface{}) {
+	m.Called(skip, args)
+}
+
+func (m *MockLogger) ErrorWithSkip(skip int, message error, args ...interface{}) {
+	m.Called(skip, message, args)
+}
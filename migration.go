@@ -0,0 +1,147 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MigrationStatus struct {
+	Version   string     `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Missing is an applied version which is not added to the migrator anymore
+	Missing bool `json:"missing,omitempty"`
+	// Running is a version whose migration is not finished, by another process or by a process which died
+	Running bool `json:"running,omitempty"`
+}
+
+// versionedMigration is a migration of DBMigrator, ELSMigrator or MongoMigrator
+type versionedMigration interface {
+	version() string
+	name() string
+	hasUp() bool
+	hasDown() bool
+}
+
+// migrationRecord is a version recorded by a migrator
+type migrationRecord interface {
+	status() MigrationStatus
+}
+
+// lessMigrationVersion order the versions made of digits by their number, so 2 comes before 10 and 20230401120000
+// before 20230402000000, the other versions are compared as strings
+func lessMigrationVersion(a string, b string) bool {
+	if !isMigrationNumber(a) || !isMigrationNumber(b) {
+		return a < b
+	}
+
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+func isMigrationNumber(version string) bool {
+	if version == "" {
+		return false
+	}
+
+	for _, c := range version {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortMigrations return migrations in version order, every migration must have a unique version and an up function
+func sortMigrations[T versionedMigration](migrations []T) ([]T, error) {
+	sorted := append([]T{}, migrations...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return lessMigrationVersion(sorted[i].version(), sorted[j].version())
+	})
+
+	for i, migration := range sorted {
+		if migration.version() == "" || !migration.hasUp() {
+			return nil, fmt.Errorf("migration: %s_%s must have a version and an up function", migration.version(), migration.name())
+		}
+
+		if i > 0 && sorted[i-1].version() == migration.version() {
+			return nil, fmt.Errorf("migration: version %s is used by %s and %s", migration.version(), sorted[i-1].name(), migration.name())
+		}
+	}
+
+	return sorted, nil
+}
+
+// migrationStatuses return the status of the sorted migrations and of the recorded versions which are not added
+// to the migrator anymore, in version order
+func migrationStatuses[T versionedMigration, R migrationRecord](sorted []T, records map[string]R) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(sorted))
+	found := make(map[string]bool, len(sorted))
+	for _, migration := range sorted {
+		status := MigrationStatus{Version: migration.version(), Name: migration.name()}
+		if record, ok := records[migration.version()]; ok {
+			status = record.status()
+			status.Name = migration.name()
+		}
+
+		found[migration.version()] = true
+		statuses = append(statuses, status)
+	}
+
+	for version, record := range records {
+		if found[version] {
+			continue
+		}
+
+		status := record.status()
+		status.Missing = true
+		statuses = append(statuses, status)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return lessMigrationVersion(statuses[i].Version, statuses[j].Version)
+	})
+	return statuses
+}
+
+// revertMigrations return the migrations of the last steps recorded versions, newest first. Every version must be
+// added to the migrator and have a down function
+func revertMigrations[T versionedMigration, R migrationRecord](sorted []T, records map[string]R, steps int) ([]T, error) {
+	byVersion := make(map[string]T, len(sorted))
+	for _, migration := range sorted {
+		byVersion[migration.version()] = migration
+	}
+
+	versions := make([]string, 0, len(records))
+	for version := range records {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return lessMigrationVersion(versions[j], versions[i])
+	})
+
+	reverted := make([]T, 0, steps)
+	for i := 0; i < steps && i < len(versions); i++ {
+		migration, ok := byVersion[versions[i]]
+		if !ok {
+			return nil, fmt.Errorf("migration: %s_%s is applied but not added to the migrator", versions[i], records[versions[i]].status().Name)
+		}
+
+		if !migration.hasDown() {
+			return nil, fmt.Errorf("migration: %s_%s has no down migration", migration.version(), migration.name())
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSortMigrations(t *testing.T) {
+	migrations, err := sortMigrations([]*DBMigration{
+		{Version: "10", Name: "tenth", Up: dbMigrationSQL("SELECT 10")},
+		{Version: "2", Name: "second", Up: dbMigrationSQL("SELECT 2")},
+		{Version: "1", Name: "first", Up: dbMigrationSQL("SELECT 1")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", migrations[0].Version)
+	assert.Equal(t, "2", migrations[1].Version)
+	assert.Equal(t, "10", migrations[2].Version)
+
+	assert.True(t, lessMigrationVersion("9", "010"))
+	assert.True(t, lessMigrationVersion("20230401120000", "20230402000000"))
+	assert.True(t, lessMigrationVersion("v10", "v2"))
+}
+
+func TestRevertMigrations(t *testing.T) {
+	migrations := []*DBMigration{
+		{Version: "2", Name: "second", Up: dbMigrationSQL("SELECT 2"), Down: dbMigrationSQL("SELECT 2")},
+		{Version: "10", Name: "tenth", Up: dbMigrationSQL("SELECT 10"), Down: dbMigrationSQL("SELECT 10")},
+	}
+	records := map[string]DBMigrationRecord{
+		"2":  {Version: "2", Name: "second", AppliedAt: time.Now()},
+		"10": {Version: "10", Name: "tenth", AppliedAt: time.Now()},
+	}
+
+	reverted, err := revertMigrations(migrations, records, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, "10", reverted[0].Version)
+
+	statuses := migrationStatuses(migrations, records)
+	assert.Equal(t, "2", statuses[0].Version)
+	assert.Equal(t, "10", statuses[1].Version)
+}
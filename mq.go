@@ -1,12 +1,15 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/pskclub/mine-core/utils"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"time"
 
-	"github.com/go-errors/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -15,6 +18,17 @@ var MQError = Error{
 	Code:    "MQ_ERROR",
 	Message: "mq internal error"}
 
+type MQConnectionState string
+
+const (
+	MQStateConnected    MQConnectionState = "connected"
+	MQStateReconnecting MQConnectionState = "reconnecting"
+	MQStateClosed       MQConnectionState = "closed"
+
+	DefaultMQReconnectDelay    = time.Second
+	DefaultMQMaxReconnectDelay = 30 * time.Second
+)
+
 type MQ struct {
 	URI      string
 	Host     string
@@ -24,153 +38,145 @@ type MQ struct {
 	LogLevel logrus.Level
 }
 
-type MQPublishOptions struct {
-	Exchange     string
-	MessageID    string
-	Durable      bool
-	AutoDelete   bool
-	Exclusive    bool
-	Mandatory    bool
-	Immediate    bool
-	NoWait       bool
-	DeliveryMode uint8
-	Args         amqp.Table
-}
-
 type IMQ interface {
 	Close()
 	PublishJSON(name string, data interface{}, options *MQPublishOptions) error
 	Consume(ctx IMQContext, name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions)
+	Subscribe(ctx IMQContext, name string, handler MQHandlerFunc, options *MQConsumeOptions) error
+	Call(name string, payload interface{}, timeout time.Duration) (json.RawMessage, IError)
+	Reply(message amqp.Delivery, result interface{}, ierr IError) error
 	Conn() *amqp.Connection
 	ReConnect()
+	// State return the state of the connection supervised by the mq
+	State() MQConnectionState
+	// OnReconnect register a hook called every time the connection is re-established after it was lost
+	OnReconnect(hook func())
+	Shutdown(ctx context.Context) error
+	WithContext(ctx context.Context) IMQ
 }
 
 type mq struct {
-	connection *amqp.Connection
-	mq         *MQ
+	connection     *amqp.Connection
+	connMutex      sync.RWMutex
+	dialMutex      sync.Mutex
+	state          MQConnectionState
+	reconnectHooks []func()
+	isClosed       bool
+	mq             *MQ
+	mutex          sync.Mutex
+	consumers      map[string]*mqConsumer
+	isClosing      bool
+	publishers     chan *mqPublisher
+	rpc            *mqRPCClient
 }
 
-func (m mq) ReConnect() {
-	if m.connection.IsClosed() {
-		m.connection, _ = m.mq.ReConnect()
+// ReConnect dial a new connection when the current one is closed, the error is logged since publishers and consumers report their own
+func (m *mq) ReConnect() {
+	if err := m.redial(); err != nil {
+		fmt.Println(fmt.Sprintf("MQ: reconnect failed: %v", err))
 	}
 }
 
-func (m mq) PublishJSON(name string, data interface{}, options *MQPublishOptions) error {
-	m.ReConnect()
-	ch, err := m.Conn().Channel()
-	if err != nil {
-		return err
+// redial replace the closed connection, it is a no-op when the connection is open or another goroutine already reconnected.
+// The dial does not hold connMutex, so State, Conn and the health checks do not wait for it
+func (m *mq) redial() error {
+	m.dialMutex.Lock()
+	defer m.dialMutex.Unlock()
+
+	m.connMutex.RLock()
+	isClosed, current := m.isClosed, m.connection
+	m.connMutex.RUnlock()
+	if isClosed {
+		return amqp.ErrClosed
 	}
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		name,               // name
-		options.Durable,    // durable
-		options.AutoDelete, // delete when unused
-		options.Exclusive,  // exclusive
-		options.NoWait,     // no-wait
-		options.Args,       // arguments
-	)
-	if err != nil {
-		return err
+
+	if current != nil && !current.IsClosed() {
+		return nil
 	}
 
-	err = ch.Publish(
-		options.Exchange,  // exchange
-		q.Name,            // routing key
-		options.Mandatory, // mandatory
-		options.Immediate, // immediate
-		amqp.Publishing{
-			MessageId:    options.MessageID,
-			DeliveryMode: options.DeliveryMode,
-			ContentType:  "text/plain",
-			Body:         []byte(utils.JSONToString(data)),
-		})
+	conn, err := m.mq.ReConnect()
 	if err != nil {
 		return err
 	}
 
-	if m.mq.LogLevel == logrus.DebugLevel {
-		fmt.Printf("Publish a message at '%s' channel\n", name)
+	m.connMutex.Lock()
+	defer m.connMutex.Unlock()
+
+	// closed while dialing
+	if m.isClosed {
+		_ = conn.Close()
+		return amqp.ErrClosed
 	}
 
+	m.connection = conn
+	m.state = MQStateConnected
+	m.watch(conn)
 	return nil
 }
 
-type MQConsumeOptions struct {
-	Durable    bool
-	AutoDelete bool
-	Exclusive  bool
-	NoWait     bool
-	Args       amqp.Table
-	AutoAck    bool
-	NoLocal    bool
-	Consumer   string
-}
-
-func (m mq) Consume(ctx IMQContext, name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions) {
-	m.ReConnect()
-	ch, err := m.Conn().Channel()
-	if err != nil {
-		ctx.NewError(err, MQError)
-	}
-
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		name,               // name
-		options.Durable,    // durable
-		options.AutoDelete, // delete when unused
-		options.Exclusive,  // exclusive
-		options.NoWait,     // no-wait
-		options.Args,       // arguments
-	)
-	if err != nil {
-		ctx.NewError(err, MQError)
-	}
+// watch start the supervisor of conn, it reconnects with backoff when the connection is lost and then runs the reconnect hooks
+func (m *mq) watch(conn *amqp.Connection) {
+	notify := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		err, ok := <-notify
+		if !ok || err == nil {
+			// closed by Close
+			return
+		}
 
-	err = ch.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-	if err != nil {
-		ctx.NewError(err, MQError)
-	}
+		fmt.Println(fmt.Sprintf("MQ: connection lost: %v", err))
+		m.setState(MQStateReconnecting)
 
-	msgs, err := ch.Consume(
-		q.Name,            // queue
-		options.Consumer,  // consumer
-		options.AutoAck,   // auto-ack
-		options.Exclusive, // exclusive
-		options.NoLocal,   // no-local
-		options.NoWait,    // no-wait
-		options.Args,      // args
-	)
-	if err != nil {
-		ctx.NewError(err, MQError)
-	}
+		delay := DefaultMQReconnectDelay
+		for {
+			err := m.redial()
+			if errors.Is(err, amqp.ErrClosed) {
+				return
+			}
 
-	var forever chan struct{}
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				errmsg := errors.New(fmt.Sprintf("%v", err))
-				fmt.Println(errmsg)
-				ctx.NewError(errmsg, MQError)
+			if err == nil {
+				break
 			}
-		}()
 
-		for d := range msgs {
-			if m.mq.LogLevel == logrus.DebugLevel {
-				fmt.Println(fmt.Sprintf("Received a message at '%s' channel", name))
+			fmt.Println(fmt.Sprintf("MQ: reconnect failed, retry in %s: %v", delay, err))
+			time.Sleep(delay)
+			delay *= 2
+			if delay > DefaultMQMaxReconnectDelay {
+				delay = DefaultMQMaxReconnectDelay
 			}
+		}
 
-			onConsume(d)
+		fmt.Println("MQ: reconnected")
+		m.connMutex.RLock()
+		hooks := m.reconnectHooks
+		m.connMutex.RUnlock()
+		for _, hook := range hooks {
+			hook()
 		}
 	}()
-	<-forever
+}
+
+func (m *mq) setState(state MQConnectionState) {
+	m.connMutex.Lock()
+	defer m.connMutex.Unlock()
+
+	if !m.isClosed {
+		m.state = state
+	}
+}
+
+func (m *mq) State() MQConnectionState {
+	m.connMutex.RLock()
+	defer m.connMutex.RUnlock()
+
+	return m.state
+}
+
+func (m *mq) OnReconnect(hook func()) {
+	m.connMutex.Lock()
+	defer m.connMutex.Unlock()
+
+	m.reconnectHooks = append(m.reconnectHooks, hook)
 }
 
 func NewMQ(env *ENVConfig) *MQ {
@@ -199,7 +205,10 @@ func (m *MQ) Connect() (IMQ, error) {
 		return nil, err
 	}
 
-	return &mq{connection: conn, mq: m}, nil
+	client := &mq{connection: conn, state: MQStateConnected, mq: m}
+	client.watch(conn)
+
+	return client, nil
 }
 
 // ConnectDB to connect Database
@@ -221,13 +230,25 @@ func (m *MQ) ReConnect() (*amqp.Connection, error) {
 	return conn, nil
 }
 
-func (m mq) Close() {
+func (m *mq) Close() {
+	m.connMutex.Lock()
+	defer m.connMutex.Unlock()
+
+	m.isClosed = true
+	m.state = MQStateClosed
+	if m.connection.IsClosed() {
+		return
+	}
+
 	err := m.connection.Close()
 	if err != nil {
 		panic(err)
 	}
 }
 
-func (m mq) Conn() *amqp.Connection {
+func (m *mq) Conn() *amqp.Connection {
+	m.connMutex.RLock()
+	defer m.connMutex.RUnlock()
+
 	return m.connection
 }
@@ -0,0 +1,581 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pskclub/mine-core/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// MQHeaderRetryCount is the number of times the message has been retried by Subscribe
+	MQHeaderRetryCount = "x-retry-count"
+	// MQHeaderError is the last handler error of a dead-lettered message
+	MQHeaderError = "x-error"
+
+	DefaultMQMaxRetries    = 3
+	DefaultMQRetryDelay    = time.Second
+	DefaultMQMaxRetryDelay = 5 * time.Minute
+)
+
+// MQRejectError make Subscribe route the message to the rejection queue instead of retrying it
+type MQRejectError struct {
+	Err error
+}
+
+func (e *MQRejectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MQRejectError) Unwrap() error {
+	return e.Err
+}
+
+// NewMQRejectError wrap err so the message is rejected without retry, e.g. an invalid payload
+func NewMQRejectError(err error) error {
+	return &MQRejectError{Err: err}
+}
+
+// MQHandlerFunc handle a delivery of Subscribe with a context of its own, the delivery is acked when it returns nil and retried when it returns an error
+type MQHandlerFunc func(ctx IMQContext, message amqp.Delivery) error
+
+type MQConsumeOptions struct {
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	NoWait     bool
+	Args       amqp.Table
+	AutoAck    bool
+	NoLocal    bool
+	Consumer   string
+	// PrefetchCount is the number of unacknowledged deliveries, defaults to Concurrency
+	PrefetchCount int
+	// Concurrency is the number of workers handling deliveries, defaults to 1
+	Concurrency int
+	// MaxRetries is the number of retries before the message is dead-lettered by Subscribe, defaults to DefaultMQMaxRetries, a negative value disables retries
+	MaxRetries int
+	// RetryDelay is the delay of the first retry, it doubles on every attempt up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// DeadLetterQueue receive the messages that exhausted their retries, defaults to "<name>.dead"
+	DeadLetterQueue string
+	// RejectionQueue receive the messages whose handler returned a MQRejectError, defaults to "<name>.rejected"
+	RejectionQueue string
+	// IdempotencyStore skip and ack the deliveries whose MessageId was already processed by this queue, the MessageId
+	// is reserved while the handler runs so a delivery handled by another worker meanwhile is requeued after RetryDelay
+	IdempotencyStore IIdempotencyStore
+	// IdempotencyTTL is how long a processed MessageId is remembered, defaults to DefaultIdempotencyTTL
+	IdempotencyTTL time.Duration
+}
+
+// mqConsumerChannel is the part of *amqp.Channel used by a consumer after it started consuming
+type mqConsumerChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Cancel(consumer string, noWait bool) error
+}
+
+type mqConsumer struct {
+	tag       string
+	queue     string
+	channel   mqConsumerChannel
+	options   *MQConsumeOptions
+	handler   MQHandlerFunc
+	manualAck bool
+	ctx       IMQContext
+	logLevel  logrus.Level
+	done      chan struct{}
+	mutex     sync.Mutex
+	declared  map[string]bool
+}
+
+func (m *mq) Consume(ctx IMQContext, name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions) {
+	err := m.consume(ctx, name, func(ctx IMQContext, message amqp.Delivery) error {
+		onConsume(message)
+		return nil
+	}, options, false)
+	if err != nil {
+		ctx.NewError(err, MQError)
+	}
+}
+
+// Subscribe consume the queue until the consumer is cancelled, every delivery is acked when handler succeeds,
+// republished to a delay queue with exponential backoff when it fails and routed to the dead letter queue after MaxRetries
+func (m *mq) Subscribe(ctx IMQContext, name string, handler MQHandlerFunc, options *MQConsumeOptions) error {
+	return m.consume(ctx, name, handler, options, true)
+}
+
+func (m *mq) consume(ctx IMQContext, name string, handler MQHandlerFunc, options *MQConsumeOptions, manualAck bool) error {
+	if options == nil {
+		options = &MQConsumeOptions{}
+	}
+
+	m.ReConnect()
+	ch, err := m.Conn().Channel()
+	if err != nil {
+		return err
+	}
+
+	defer ch.Close()
+
+	q, err := ch.QueueDeclare(
+		name,               // name
+		options.Durable,    // durable
+		options.AutoDelete, // delete when unused
+		options.Exclusive,  // exclusive
+		options.NoWait,     // no-wait
+		options.Args,       // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	prefetchCount := options.PrefetchCount
+	if prefetchCount <= 0 {
+		prefetchCount = concurrency
+	}
+
+	err = ch.Qos(
+		prefetchCount, // prefetch count
+		0,             // prefetch size
+		false,         // global
+	)
+	if err != nil {
+		return err
+	}
+
+	consumer := &mqConsumer{
+		tag:       options.Consumer,
+		queue:     q.Name,
+		channel:   ch,
+		options:   options,
+		handler:   handler,
+		manualAck: manualAck && !options.AutoAck,
+		ctx:       ctx,
+		logLevel:  m.mq.LogLevel,
+		done:      make(chan struct{}),
+		declared:  make(map[string]bool),
+	}
+	if consumer.tag == "" {
+		consumer.tag = fmt.Sprintf("%s-%s", name, utils.GetUUID())
+	}
+
+	if !m.addConsumer(consumer) {
+		return nil
+	}
+	defer m.removeConsumer(consumer)
+
+	msgs, err := ch.Consume(
+		q.Name,            // queue
+		consumer.tag,      // consumer
+		options.AutoAck,   // auto-ack
+		options.Exclusive, // exclusive
+		options.NoLocal,   // no-local
+		options.NoWait,    // no-wait
+		options.Args,      // args
+	)
+	if err != nil {
+		close(consumer.done)
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range msgs {
+				consumer.handle(d)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(consumer.done)
+	}()
+	<-consumer.done
+
+	return nil
+}
+
+// addConsumer register the consumer so Shutdown can cancel it, it returns false once the mq is shutting down
+func (m *mq) addConsumer(consumer *mqConsumer) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isClosing {
+		return false
+	}
+
+	if m.consumers == nil {
+		m.consumers = make(map[string]*mqConsumer)
+	}
+
+	m.consumers[consumer.tag] = consumer
+	return true
+}
+
+func (m *mq) removeConsumer(consumer *mqConsumer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// a consumer re-subscribed after a reconnect may already use the same tag
+	if m.consumers[consumer.tag] == consumer {
+		delete(m.consumers, consumer.tag)
+	}
+}
+
+// Shutdown stop every consumer from receiving new deliveries and wait until the in-flight deliveries are handled
+func (m *mq) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	m.isClosing = true
+	consumers := make([]*mqConsumer, 0, len(m.consumers))
+	for _, consumer := range m.consumers {
+		consumers = append(consumers, consumer)
+	}
+	m.mutex.Unlock()
+
+	for _, consumer := range consumers {
+		// the channel of a consumer is already closed when the connection was lost
+		if err := consumer.channel.Cancel(consumer.tag, false); err != nil && !errors.Is(err, amqp.ErrClosed) {
+			return err
+		}
+	}
+
+	for _, consumer := range consumers {
+		select {
+		case <-consumer.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// handle run the handler for one delivery, a panic is recovered and treated as a handler error so the worker keeps consuming
+func (c *mqConsumer) handle(d amqp.Delivery) {
+	ctx := newMQMessageContext(c.ctx, d)
+	if c.logLevel == logrus.DebugLevel {
+		fmt.Println(fmt.Sprintf("Received a message at '%s' channel", c.queue))
+	}
+
+	switch c.reserve(ctx, d) {
+	case mqReserveProcessed:
+		if c.logLevel == logrus.DebugLevel {
+			fmt.Println(fmt.Sprintf("Skip the duplicated message '%s' at '%s' channel", d.MessageId, c.queue))
+		}
+
+		if !c.options.AutoAck {
+			_ = d.Ack(false)
+		}
+
+		return
+	case mqReserveProcessing:
+		// another worker is handling the same message, it is redelivered once that worker is done or released it
+		if !c.options.AutoAck {
+			c.requeue(d)
+		}
+
+		return
+	}
+
+	err := c.run(ctx, d)
+	if err != nil {
+		ctx.Log().Error(err, fmt.Sprintf("mq consumer '%s' failed", c.queue))
+		c.release(ctx, d)
+	} else {
+		c.markProcessed(ctx, d)
+	}
+
+	if c.options.AutoAck {
+		return
+	}
+
+	if !c.manualAck {
+		// Consume leaves the acknowledgement to the handler, only a panicking delivery is dead-lettered
+		if err != nil {
+			c.settle(ctx, d, c.deadLetter(ctx, d, err))
+		}
+
+		return
+	}
+
+	if err == nil {
+		if ackErr := d.Ack(false); ackErr != nil {
+			ctx.Log().Error(ackErr)
+		}
+
+		return
+	}
+
+	// a message that cannot be retried is dead-lettered rather than redelivered at once
+	retryErr := c.retry(ctx, d, err)
+	if retryErr != nil {
+		ctx.Log().Error(retryErr, fmt.Sprintf("mq consumer '%s' cannot retry the message", c.queue))
+		retryErr = c.deadLetter(ctx, d, err)
+	}
+
+	c.settle(ctx, d, retryErr)
+}
+
+// settle ack the delivery once it was republished, when publishErr is not nil the delivery is requeued after
+// the retry delay so a broken channel does not redeliver it in a hot loop
+func (c *mqConsumer) settle(ctx IMQContext, d amqp.Delivery, publishErr error) {
+	if publishErr == nil {
+		if ackErr := d.Ack(false); ackErr != nil {
+			ctx.Log().Error(ackErr)
+		}
+
+		return
+	}
+
+	ctx.Log().Error(publishErr, fmt.Sprintf("mq consumer '%s' cannot dead-letter the message, it is requeued", c.queue))
+	c.requeue(d)
+}
+
+// requeue nack the delivery back to its queue after the retry delay, or at once when the consumer is stopping
+func (c *mqConsumer) requeue(d amqp.Delivery) {
+	timer := time.NewTimer(mqRetryDelay(0, c.options.RetryDelay, c.options.MaxRetryDelay))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.ctx.StdContext().Done():
+	}
+
+	_ = d.Nack(false, true)
+}
+
+func (c *mqConsumer) run(ctx IMQContext, d amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return c.handler(ctx, d)
+}
+
+func (c *mqConsumer) idempotencyKey(d amqp.Delivery) string {
+	return fmt.Sprintf("mq:%s:%s", c.queue, d.MessageId)
+}
+
+const (
+	mqReserveReserved = iota
+	mqReserveProcessed
+	mqReserveProcessing
+)
+
+// reserve atomically reserve the MessageId of d for this worker, it reports whether the message was already processed
+// or is being processed by another worker. A store failure lets the delivery through
+func (c *mqConsumer) reserve(ctx IMQContext, d amqp.Delivery) int {
+	if c.options.IdempotencyStore == nil || d.MessageId == "" {
+		return mqReserveReserved
+	}
+
+	store := c.options.IdempotencyStore.WithContext(ctx.StdContext())
+	reserved, err := store.Reserve(c.idempotencyKey(d), &IdempotencyRecord{Processing: true}, c.idempotencyTTL())
+	if err != nil {
+		ctx.Log().Error(err, fmt.Sprintf("mq consumer '%s' cannot write the idempotency store", c.queue))
+		return mqReserveReserved
+	}
+
+	if reserved {
+		return mqReserveReserved
+	}
+
+	record, err := store.Get(c.idempotencyKey(d))
+	if err != nil {
+		ctx.Log().Error(err, fmt.Sprintf("mq consumer '%s' cannot read the idempotency store", c.queue))
+		return mqReserveProcessing
+	}
+
+	if record != nil && !record.Processing {
+		return mqReserveProcessed
+	}
+
+	return mqReserveProcessing
+}
+
+// release delete the reservation of a failed delivery, so its retry is processed
+func (c *mqConsumer) release(ctx IMQContext, d amqp.Delivery) {
+	if c.options.IdempotencyStore == nil || d.MessageId == "" {
+		return
+	}
+
+	err := c.options.IdempotencyStore.WithContext(ctx.StdContext()).Delete(c.idempotencyKey(d))
+	if err != nil {
+		ctx.Log().Error(err, fmt.Sprintf("mq consumer '%s' cannot write the idempotency store", c.queue))
+	}
+}
+
+func (c *mqConsumer) idempotencyTTL() time.Duration {
+	if c.options.IdempotencyTTL <= 0 {
+		return DefaultIdempotencyTTL
+	}
+
+	return c.options.IdempotencyTTL
+}
+
+func (c *mqConsumer) markProcessed(ctx IMQContext, d amqp.Delivery) {
+	if c.options.IdempotencyStore == nil || d.MessageId == "" {
+		return
+	}
+
+	err := c.options.IdempotencyStore.WithContext(ctx.StdContext()).Set(c.idempotencyKey(d), &IdempotencyRecord{}, c.idempotencyTTL())
+	if err != nil {
+		ctx.Log().Error(err, fmt.Sprintf("mq consumer '%s' cannot write the idempotency store", c.queue))
+	}
+}
+
+// retry republish the delivery to its delay queue, or to the dead letter queue once MaxRetries is reached,
+// a rejected delivery goes straight to the rejection queue
+func (c *mqConsumer) retry(ctx IMQContext, d amqp.Delivery, handlerErr error) error {
+	attempt := mqRetryCount(d.Headers)
+	maxRetries := c.options.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMQMaxRetries
+	}
+
+	headers := amqp.Table{}
+	for key, value := range d.Headers {
+		headers[key] = value
+	}
+
+	rejectErr := &MQRejectError{}
+	if errors.As(handlerErr, &rejectErr) {
+		queue := c.options.RejectionQueue
+		if queue == "" {
+			queue = fmt.Sprintf("%s.rejected", c.queue)
+		}
+
+		err := c.declare(queue, nil)
+		if err != nil {
+			return err
+		}
+
+		headers[MQHeaderError] = handlerErr.Error()
+		return c.publish(ctx, queue, d, headers)
+	}
+
+	if attempt >= maxRetries {
+		return c.deadLetter(ctx, d, handlerErr)
+	}
+
+	delay := mqRetryDelay(attempt, c.options.RetryDelay, c.options.MaxRetryDelay)
+	queue := fmt.Sprintf("%s.retry.%d", c.queue, delay.Milliseconds())
+	err := c.declare(queue, amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": c.queue,
+	})
+	if err != nil {
+		return err
+	}
+
+	headers[MQHeaderRetryCount] = int32(attempt + 1)
+	return c.publish(ctx, queue, d, headers)
+}
+
+// deadLetter republish the delivery to the dead letter queue with the handler error
+func (c *mqConsumer) deadLetter(ctx IMQContext, d amqp.Delivery, handlerErr error) error {
+	queue := c.options.DeadLetterQueue
+	if queue == "" {
+		queue = fmt.Sprintf("%s.dead", c.queue)
+	}
+
+	err := c.declare(queue, nil)
+	if err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	for key, value := range d.Headers {
+		headers[key] = value
+	}
+
+	headers[MQHeaderError] = handlerErr.Error()
+	return c.publish(ctx, queue, d, headers)
+}
+
+func (c *mqConsumer) declare(queue string, args amqp.Table) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.declared[queue] {
+		return nil
+	}
+
+	_, err := c.channel.QueueDeclare(queue, c.options.Durable, false, false, false, args)
+	if err != nil {
+		return err
+	}
+
+	c.declared[queue] = true
+	return nil
+}
+
+func (c *mqConsumer) publish(ctx IMQContext, queue string, d amqp.Delivery, headers amqp.Table) error {
+	return c.channel.PublishWithContext(ctx.StdContext(), "", queue, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	})
+}
+
+// mqRetryCount read MQHeaderRetryCount from the headers, it returns 0 for the first delivery
+func mqRetryCount(headers amqp.Table) int {
+	switch value := headers[MQHeaderRetryCount].(type) {
+	case int:
+		return value
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	}
+
+	return 0
+}
+
+// mqRetryDelay return the exponential backoff delay of the given attempt
+func mqRetryDelay(attempt int, base time.Duration, max time.Duration) time.Duration {
+	if base <= 0 {
+		base = DefaultMQRetryDelay
+	}
+
+	if max <= 0 {
+		max = DefaultMQMaxRetryDelay
+	}
+
+	delay := base
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMQRetryCount(t *testing.T) {
+	assert.Equal(t, 0, mqRetryCount(nil))
+	assert.Equal(t, 0, mqRetryCount(amqp.Table{}))
+	assert.Equal(t, 2, mqRetryCount(amqp.Table{MQHeaderRetryCount: int32(2)}))
+	assert.Equal(t, 3, mqRetryCount(amqp.Table{MQHeaderRetryCount: int64(3)}))
+}
+
+func TestMQRetryDelay(t *testing.T) {
+	assert.Equal(t, DefaultMQRetryDelay, mqRetryDelay(0, 0, 0))
+	assert.Equal(t, 100*time.Millisecond, mqRetryDelay(0, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 400*time.Millisecond, mqRetryDelay(2, 100*time.Millisecond, time.Second))
+	assert.Equal(t, time.Second, mqRetryDelay(10, 100*time.Millisecond, time.Second))
+}
+
+type mqTestChannel struct {
+	mutex      sync.Mutex
+	declared   []string
+	published  map[string][]amqp.Publishing
+	publishErr error
+}
+
+func (ch *mqTestChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	ch.declared = append(ch.declared, name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *mqTestChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	if ch.publishErr != nil {
+		return ch.publishErr
+	}
+
+	if ch.published == nil {
+		ch.published = make(map[string][]amqp.Publishing)
+	}
+
+	ch.published[key] = append(ch.published[key], msg)
+	return nil
+}
+
+func (ch *mqTestChannel) Cancel(consumer string, noWait bool) error {
+	return nil
+}
+
+type mqTestAcknowledger struct {
+	acked   int
+	nacked  int
+	requeue bool
+}
+
+func (a *mqTestAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked++
+	return nil
+}
+
+func (a *mqTestAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked++
+	a.requeue = requeue
+	return nil
+}
+
+func (a *mqTestAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func newMQTestConsumer(handler MQHandlerFunc, options *MQConsumeOptions, manualAck bool) (*mqConsumer, *mqTestChannel) {
+	ch := &mqTestChannel{}
+	if options == nil {
+		options = &MQConsumeOptions{}
+	}
+
+	return &mqConsumer{
+		queue:     "orders",
+		channel:   ch,
+		options:   options,
+		handler:   handler,
+		manualAck: manualAck,
+		ctx:       NewMQContext(&MQContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil)}}),
+		declared:  make(map[string]bool),
+	}, ch
+}
+
+func newMQTestDelivery(headers amqp.Table) (amqp.Delivery, *mqTestAcknowledger) {
+	acknowledger := &mqTestAcknowledger{}
+	return amqp.Delivery{Acknowledger: acknowledger, Headers: headers, Body: []byte("order")}, acknowledger
+}
+
+func TestMQConsumer_HandleAck(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return nil
+	}, nil, true)
+	d, acknowledger := newMQTestDelivery(nil)
+
+	consumer.handle(d)
+
+	assert.Equal(t, 1, acknowledger.acked)
+	assert.Equal(t, 0, acknowledger.nacked)
+	assert.Empty(t, ch.published)
+}
+
+func TestMQConsumer_HandleRetry(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return errors.New("failed")
+	}, &MQConsumeOptions{RetryDelay: 100 * time.Millisecond}, true)
+	d, acknowledger := newMQTestDelivery(amqp.Table{MQHeaderRetryCount: int32(1)})
+
+	consumer.handle(d)
+
+	assert.Equal(t, 1, acknowledger.acked)
+	assert.Equal(t, []string{"orders.retry.200"}, ch.declared)
+	if assert.Len(t, ch.published["orders.retry.200"], 1) {
+		assert.Equal(t, int32(2), ch.published["orders.retry.200"][0].Headers[MQHeaderRetryCount])
+		assert.Equal(t, []byte("order"), ch.published["orders.retry.200"][0].Body)
+	}
+}
+
+func TestMQConsumer_HandleDeadLetter(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return errors.New("failed")
+	}, &MQConsumeOptions{MaxRetries: 2}, true)
+	d, acknowledger := newMQTestDelivery(amqp.Table{MQHeaderRetryCount: int32(2)})
+
+	consumer.handle(d)
+
+	assert.Equal(t, 1, acknowledger.acked)
+	if assert.Len(t, ch.published["orders.dead"], 1) {
+		assert.Equal(t, "failed", ch.published["orders.dead"][0].Headers[MQHeaderError])
+	}
+}
+
+func TestMQConsumer_HandleReject(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return NewMQRejectError(errors.New("invalid payload"))
+	}, nil, true)
+	d, acknowledger := newMQTestDelivery(nil)
+
+	consumer.handle(d)
+
+	assert.Equal(t, 1, acknowledger.acked)
+	if assert.Len(t, ch.published["orders.rejected"], 1) {
+		assert.Equal(t, "invalid payload", ch.published["orders.rejected"][0].Headers[MQHeaderError])
+	}
+}
+
+func TestMQConsumer_HandlePanic(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		panic("boom")
+	}, nil, true)
+	d, acknowledger := newMQTestDelivery(nil)
+
+	assert.NotPanics(t, func() {
+		consumer.handle(d)
+	})
+	assert.Equal(t, 1, acknowledger.acked)
+	assert.Len(t, ch.published["orders.retry.1000"], 1)
+}
+
+func TestMQConsumer_HandleConsumePanic(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		panic("boom")
+	}, nil, false)
+	d, acknowledger := newMQTestDelivery(nil)
+
+	consumer.handle(d)
+
+	assert.Equal(t, 1, acknowledger.acked)
+	assert.Equal(t, 0, acknowledger.nacked)
+	if assert.Len(t, ch.published["orders.dead"], 1) {
+		assert.Equal(t, "boom", ch.published["orders.dead"][0].Headers[MQHeaderError])
+	}
+}
+
+func TestMQConsumer_HandleConsumeLeavesAck(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return nil
+	}, nil, false)
+	d, acknowledger := newMQTestDelivery(nil)
+
+	consumer.handle(d)
+
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 0, acknowledger.nacked)
+	assert.Empty(t, ch.published)
+}
+
+func TestMQConsumer_HandlePublishFailure(t *testing.T) {
+	consumer, ch := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		return errors.New("failed")
+	}, &MQConsumeOptions{RetryDelay: 50 * time.Millisecond}, true)
+	ch.publishErr = amqp.ErrClosed
+	d, acknowledger := newMQTestDelivery(nil)
+
+	start := time.Now()
+	consumer.handle(d)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 1, acknowledger.nacked)
+	assert.True(t, acknowledger.requeue)
+	assert.Contains(t, ch.declared, "orders.dead")
+}
+
+func TestMQConsumer_HandleIdempotency(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}
+	calls := 0
+	failed := true
+	consumer, _ := newMQTestConsumer(func(ctx IMQContext, message amqp.Delivery) error {
+		calls++
+		if failed {
+			return errors.New("failed")
+		}
+		return nil
+	}, &MQConsumeOptions{IdempotencyStore: store, RetryDelay: 10 * time.Millisecond}, true)
+	key := consumer.idempotencyKey(amqp.Delivery{MessageId: "1"})
+
+	// a failure releases the reservation so the retry is processed
+	d, _ := newMQTestDelivery(nil)
+	d.MessageId = "1"
+	consumer.handle(d)
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, store.records[key])
+
+	failed = false
+	d, acknowledger := newMQTestDelivery(nil)
+	d.MessageId = "1"
+	consumer.handle(d)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, acknowledger.acked)
+	assert.Equal(t, &IdempotencyRecord{}, store.records[key])
+
+	// a processed message is acked without running the handler
+	d, acknowledger = newMQTestDelivery(nil)
+	d.MessageId = "1"
+	consumer.handle(d)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, acknowledger.acked)
+
+	// a message being processed by another worker is requeued
+	store.records[key] = &IdempotencyRecord{Processing: true}
+	d, acknowledger = newMQTestDelivery(nil)
+	d.MessageId = "1"
+	consumer.handle(d)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 1, acknowledger.nacked)
+	assert.True(t, acknowledger.requeue)
+}
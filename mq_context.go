@@ -1,41 +1,152 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"github.com/labstack/echo/v4"
 	"github.com/pskclub/mine-core/consts"
+	"github.com/pskclub/mine-core/utils"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"sync"
 )
 
 type IMQContext interface {
 	IContext
 	AddConsumer(handlerFunc func(ctx IMQContext))
 	Consume(name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions)
+	// Subscribe consume the queue in background, see IMQ.Subscribe for the ack, retry and dead-letter semantics
+	Subscribe(name string, handler MQHandlerFunc, options *MQConsumeOptions)
+	// ConsumeRPC serve the requests sent by IMQ.Call to the queue, the handler result is replied as a MQRPCReply
+	ConsumeRPC(name string, handler MQRPCHandlerFunc, options *MQConsumeOptions)
 	Start()
 }
 
 type MQContext struct {
 	IContext
+	lifecycle ILifecycle
+	health    IHealth
+	mutex     sync.Mutex
+	consumers []func(ctx IMQContext)
 }
 
 func (c *MQContext) Start() {
 	fmt.Println(fmt.Sprintf("MQ Consumer Service: %s", c.ENV().Config().Service))
-	select {}
+	if c.health != nil && c.ENV().Config().HealthHost != "" {
+		StartHealthServer(c.ENV().Config().HealthHost, c.health, c.lifecycle)
+	}
+
+	if c.lifecycle == nil {
+		select {}
+	}
+
+	c.lifecycle.AddService("mq", func(ctx context.Context) error {
+		return c.MQ().Shutdown(ctx)
+	})
+	_ = c.lifecycle.Wait()
+}
+
+func (c *MQContext) ConsumeRPC(name string, handler MQRPCHandlerFunc, options *MQConsumeOptions) {
+	c.Subscribe(name, rpcHandler(handler), options)
 }
 
+// AddConsumer run handlerFunc to register its consumers, it is run again every time the mq reconnects
 func (c *MQContext) AddConsumer(handlerFunc func(ctx IMQContext)) {
+	c.mutex.Lock()
+	c.consumers = append(c.consumers, handlerFunc)
+	c.mutex.Unlock()
+
 	handlerFunc(c)
 }
 
+// resubscribe register again every consumer added by AddConsumer, their channels are closed together with the lost connection
+func (c *MQContext) resubscribe() {
+	c.mutex.Lock()
+	consumers := c.consumers
+	c.mutex.Unlock()
+
+	fmt.Println(fmt.Sprintf("MQ Consumer Service: resubscribe %d consumers", len(consumers)))
+	for _, handlerFunc := range consumers {
+		handlerFunc(c)
+	}
+}
+
 func (c *MQContext) Consume(name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions) {
 	go c.MQ().Consume(c, name, onConsume, options)
 }
 
+func (c *MQContext) Subscribe(name string, handler MQHandlerFunc, options *MQConsumeOptions) {
+	go func() {
+		if err := c.MQ().Subscribe(c, name, handler, options); err != nil {
+			c.NewError(err, MQError)
+		}
+	}()
+}
+
+const (
+	MQContextDataHeaders         = "mq_headers"
+	MQContextDataMessageID       = "mq_message_id"
+	MQContextDataRedelivered     = "mq_redelivered"
+	MQContextDataRedeliveryCount = "mq_redelivery_count"
+)
+
+// messageContext return a child context for one delivery, it shares the connections but owns its data, user, request id and logger,
+// the message metadata is set in its data
+func (c *MQContext) messageContext(message amqp.Delivery) IMQContext {
+	msgCtx := &MQContext{IContext: NewChildContext(c.IContext, c.StdContext()), lifecycle: c.lifecycle, health: c.health}
+	msgCtx.SetData(echo.HeaderXRequestID, utils.GetUUID())
+	msgCtx.SetData(MQContextDataHeaders, message.Headers)
+	msgCtx.SetData(MQContextDataMessageID, message.MessageId)
+	msgCtx.SetData(MQContextDataRedelivered, message.Redelivered)
+	msgCtx.SetData(MQContextDataRedeliveryCount, mqRetryCount(message.Headers))
+	return msgCtx
+}
+
+// newMQMessageContext return the context of one delivery, a context that is not a *MQContext is shared by every delivery
+func newMQMessageContext(ctx IMQContext, message amqp.Delivery) IMQContext {
+	if c, ok := ctx.(*MQContext); ok {
+		return c.messageContext(message)
+	}
+
+	return ctx
+}
+
+// ConsumeJSON subscribe the queue with a handler receiving the body decoded into T, T is validated when it implements IValidateContext,
+// a payload that cannot be decoded or is invalid is routed to the rejection queue
+func ConsumeJSON[T any](ctx IMQContext, name string, handler func(ctx IMQContext, payload *T) IError, options *MQConsumeOptions) {
+	ctx.Subscribe(name, func(msgCtx IMQContext, message amqp.Delivery) error {
+		payload := new(T)
+		if err := utils.JSONParse(message.Body, payload); err != nil {
+			return NewMQRejectError(err)
+		}
+
+		if v, ok := interface{}(payload).(IValidateContext); ok {
+			if ierr := v.Valid(msgCtx); ierr != nil {
+				return NewMQRejectError(ierr)
+			}
+		}
+
+		if ierr := handler(msgCtx, payload); ierr != nil {
+			return ierr
+		}
+
+		return nil
+	}, options)
+}
+
 type MQContextOptions struct {
 	ContextOptions *ContextOptions
+	Lifecycle      ILifecycle
+	// Health is served on ENVConfig.HealthHost by a side listener when both are set
+	Health IHealth
 }
 
 func NewMQContext(options *MQContextOptions) IMQContext {
 	ctxOptions := options.ContextOptions
 	ctxOptions.contextType = consts.MQ
-	return &MQContext{IContext: NewContext(ctxOptions)}
+	ctx := &MQContext{IContext: NewContext(ctxOptions), lifecycle: options.Lifecycle, health: options.Health}
+	if ctxOptions.MQ != nil {
+		ctxOptions.MQ.OnReconnect(ctx.resubscribe)
+	}
+
+	return ctx
 }
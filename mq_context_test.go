@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+type mqContextTestPayload struct {
+	Name string `json:"name"`
+}
+
+func (p *mqContextTestPayload) Valid(ctx IContext) IError {
+	if p.Name == "" {
+		return Error{Status: http.StatusBadRequest, Code: "INVALID_PARAMS", Message: "name is required"}
+	}
+
+	return nil
+}
+
+func newMQContextTestHandler(t *testing.T, handler func(ctx IMQContext, payload *mqContextTestPayload) IError) func(message amqp.Delivery) error {
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := &MQContext{IContext: newTestContext(&ContextOptions{MQ: mq})}
+
+	subscribed := make(chan MQHandlerFunc, 1)
+	mq.On("Subscribe", ctx, "users", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		subscribed <- args.Get(2).(MQHandlerFunc)
+	}).Return(nil)
+
+	ConsumeJSON(ctx, "users", handler, nil)
+	subscribeHandler := <-subscribed
+	return func(message amqp.Delivery) error {
+		return subscribeHandler(newMQMessageContext(ctx, message), message)
+	}
+}
+
+func TestConsumeJSON_Valid(t *testing.T) {
+	handler := newMQContextTestHandler(t, func(ctx IMQContext, payload *mqContextTestPayload) IError {
+		assert.Equal(t, "mine", payload.Name)
+		assert.Equal(t, "message-1", ctx.GetData(MQContextDataMessageID))
+		assert.Equal(t, 2, ctx.GetData(MQContextDataRedeliveryCount))
+		return nil
+	})
+
+	err := handler(amqp.Delivery{
+		MessageId: "message-1",
+		Headers:   amqp.Table{MQHeaderRetryCount: int32(2)},
+		Body:      []byte(`{"name":"mine"}`),
+	})
+	assert.NoError(t, err)
+}
+
+func TestConsumeJSON_Reject(t *testing.T) {
+	handler := newMQContextTestHandler(t, func(ctx IMQContext, payload *mqContextTestPayload) IError {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+
+	rejectErr := &MQRejectError{}
+	err := handler(amqp.Delivery{Body: []byte(`{"name":""}`)})
+	assert.True(t, errors.As(err, &rejectErr))
+
+	err = handler(amqp.Delivery{Body: []byte(`not json`)})
+	assert.True(t, errors.As(err, &rejectErr))
+}
@@ -1,8 +1,11 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type MockMQ struct {
@@ -18,8 +21,23 @@ func (m *MockMQ) PublishJSON(name string, data interface{}, options *MQPublishOp
 	return args.Error(0)
 }
 
-func (m *MockMQ) Consume(name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions) error {
-	args := m.Called(name, onConsume, options)
+func (m *MockMQ) Consume(ctx IMQContext, name string, onConsume func(message amqp.Delivery), options *MQConsumeOptions) {
+	m.Called(ctx, name, onConsume, options)
+}
+
+func (m *MockMQ) Subscribe(ctx IMQContext, name string, handler MQHandlerFunc, options *MQConsumeOptions) error {
+	args := m.Called(ctx, name, handler, options)
+	return args.Error(0)
+}
+
+func (m *MockMQ) Call(name string, payload interface{}, timeout time.Duration) (json.RawMessage, IError) {
+	args := m.Called(name, payload, timeout)
+	result, _ := args.Get(0).(json.RawMessage)
+	return result, MockIError(args, 1)
+}
+
+func (m *MockMQ) Reply(message amqp.Delivery, result interface{}, ierr IError) error {
+	args := m.Called(message, result, ierr)
 	return args.Error(0)
 }
 
@@ -31,3 +49,27 @@ func (m *MockMQ) Conn() *amqp.Connection {
 	args := m.Called()
 	return args.Get(0).(*amqp.Connection)
 }
+
+func (m *MockMQ) ReConnect() {
+	m.Called()
+}
+
+func (m *MockMQ) State() MQConnectionState {
+	args := m.Called()
+	return args.Get(0).(MQConnectionState)
+}
+
+func (m *MockMQ) OnReconnect(hook func()) {
+	m.Called(hook)
+}
+
+func (m *MockMQ) Shutdown(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockMQ) WithContext(ctx context.Context) IMQ {
+	args := m.Called(ctx)
+	mq, _ := args.Get(0).(IMQ)
+	return mq
+}
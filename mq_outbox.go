@@ -0,0 +1,279 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pskclub/mine-core/utils"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+const (
+	MQOutboxStatusPending = "pending"
+	MQOutboxStatusSent    = "sent"
+	// MQOutboxStatusFailed is a message out of attempts, it blocks the next messages of its aggregate key until its
+	// status is set back to pending
+	MQOutboxStatusFailed = "failed"
+
+	DefaultMQOutboxBatchSize   = 100
+	DefaultMQOutboxMaxAttempts = 10
+	DefaultMQOutboxRetryDelay  = 5 * time.Second
+	DefaultMQOutboxInterval    = time.Second
+)
+
+// ErrMQOutboxUnsupportedDriver is returned by Relay on a database which cannot skip the rows locked by another relay
+var ErrMQOutboxUnsupportedDriver = errors.New("mq outbox: the relay needs MySQL 8, PostgreSQL or SQL Server")
+
+// MQOutboxMessage is a message waiting in the outbox table to be published by the relay
+type MQOutboxMessage struct {
+	ID            uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	MessageID     string     `gorm:"column:message_id;size:64;uniqueIndex" json:"message_id"`
+	AggregateKey  string     `gorm:"column:aggregate_key;size:255;index" json:"aggregate_key"`
+	Name          string     `gorm:"column:name;size:255" json:"name"`
+	Payload       string     `gorm:"column:payload;type:text" json:"payload"`
+	Options       string     `gorm:"column:options;type:text" json:"options"`
+	Status        string     `gorm:"column:status;size:16;index" json:"status"`
+	Attempts      int        `gorm:"column:attempts" json:"attempts"`
+	LastError     string     `gorm:"column:last_error;type:text" json:"last_error"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+	SentAt        *time.Time `gorm:"column:sent_at" json:"sent_at"`
+}
+
+func (MQOutboxMessage) TableName() string {
+	return "mq_outbox_messages"
+}
+
+type MQOutboxPublishOptions struct {
+	MQPublishOptions
+	// AggregateKey order the messages, a message is published only after the previous messages of the same key are sent
+	AggregateKey string
+}
+
+type IMQOutbox interface {
+	// Migrate create the outbox table
+	Migrate(db *gorm.DB) error
+	// PublishInTx insert the message in tx, it is published by the relay once tx is committed
+	PublishInTx(tx *gorm.DB, name string, data interface{}, options *MQOutboxPublishOptions) error
+	// Relay publish the due pending messages through ctx.MQ()
+	Relay(ctx IContext) error
+	// RelayJob is Relay as a CronjobContext.AddJob handler
+	RelayJob(ctx ICronjobContext) error
+	// Run call Relay every interval until ctx.StdContext() is done
+	Run(ctx IContext)
+}
+
+type MQOutboxOptions struct {
+	BatchSize   int
+	MaxAttempts int
+	// RetryDelay is the delay of the first retry, it doubles on every attempt
+	RetryDelay time.Duration
+	// Interval is the delay between two batches of Run
+	Interval time.Duration
+}
+
+type MQOutbox struct {
+	options *MQOutboxOptions
+}
+
+// NewMQOutbox create the transactional outbox, the relay publishes at least once in the order of each aggregate key
+// and can run on several instances
+func NewMQOutbox(options *MQOutboxOptions) *MQOutbox {
+	if options == nil {
+		options = &MQOutboxOptions{}
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultMQOutboxBatchSize
+	}
+
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMQOutboxMaxAttempts
+	}
+
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DefaultMQOutboxRetryDelay
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = DefaultMQOutboxInterval
+	}
+
+	return &MQOutbox{options: options}
+}
+
+func (o *MQOutbox) Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&MQOutboxMessage{})
+}
+
+func (o *MQOutbox) PublishInTx(tx *gorm.DB, name string, data interface{}, options *MQOutboxPublishOptions) error {
+	if options == nil {
+		options = &MQOutboxPublishOptions{}
+	}
+
+	publishOptions := options.MQPublishOptions
+	if publishOptions.MessageID == "" {
+		publishOptions.MessageID = utils.GetUUID()
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return tx.Create(&MQOutboxMessage{
+		MessageID:     publishOptions.MessageID,
+		AggregateKey:  options.AggregateKey,
+		Name:          name,
+		Payload:       string(payload),
+		Options:       utils.JSONToString(publishOptions),
+		Status:        MQOutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}).Error
+}
+
+// Relay publish the due head of every aggregate key, the messages without aggregate key are all heads. The batches
+// repeat until one sends nothing, so a key is drained in a single call
+func (o *MQOutbox) Relay(ctx IContext) error {
+	for ctx.StdContext().Err() == nil {
+		sent, err := o.relayBatch(ctx)
+		if err != nil || sent == 0 {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mqOutboxLockHeads lock the selected heads and skip the heads locked by another relay, with FOR UPDATE SKIP LOCKED
+// on MySQL 8 and PostgreSQL or the UPDLOCK and READPAST table hints on SQL Server
+func mqOutboxLockHeads(db *gorm.DB) (*gorm.DB, error) {
+	switch db.Dialector.Name() {
+	case "mysql":
+		// MySQL 5 has no SKIP LOCKED, MariaDB reports its own version after the 5.5.5- prefix
+		if dialector, ok := db.Dialector.(*mysql.Dialector); ok &&
+			strings.HasPrefix(dialector.ServerVersion, "5.") && !strings.Contains(dialector.ServerVersion, "MariaDB") {
+			return nil, ErrMQOutboxUnsupportedDriver
+		}
+
+		return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}), nil
+	case "postgres":
+		return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}), nil
+	case "sqlserver":
+		return db.Table(MQOutboxMessage{}.TableName() + " WITH (UPDLOCK, READPAST)"), nil
+	}
+
+	return nil, ErrMQOutboxUnsupportedDriver
+}
+
+// relayBatch lock the due heads with mqOutboxLockHeads, so relays running on several instances never publish the
+// same message. A head which is not due or failed blocks the next messages of its key, which are not selected and
+// cannot fill the batch
+func (o *MQOutbox) relayBatch(ctx IContext) (int, error) {
+	sent := 0
+	err := DBPrimary(ctx.DB()).Transaction(func(tx *gorm.DB) error {
+		messages := make([]MQOutboxMessage, 0)
+		heads, err := mqOutboxLockHeads(tx)
+		if err != nil {
+			return err
+		}
+
+		err = heads.
+			Where("status = ? AND next_attempt_at <= ?", MQOutboxStatusPending, time.Now()).
+			Where("aggregate_key = '' OR NOT EXISTS (SELECT 1 FROM mq_outbox_messages previous "+
+				"WHERE previous.aggregate_key = mq_outbox_messages.aggregate_key AND previous.id < mq_outbox_messages.id "+
+				"AND previous.status IN ?)", []string{MQOutboxStatusPending, MQOutboxStatusFailed}).
+			Order("id").
+			Limit(o.options.BatchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+
+		sent, err = o.relay(ctx, tx, messages)
+		return err
+	})
+
+	return sent, err
+}
+
+// relay publish the messages and update them in tx, it returns the number of sent messages
+func (o *MQOutbox) relay(ctx IContext, tx *gorm.DB, messages []MQOutboxMessage) (int, error) {
+	sent := 0
+	for _, message := range messages {
+		publishErr := o.publish(ctx, message)
+		if publishErr == nil {
+			sentAt := time.Now()
+			err := tx.Model(&MQOutboxMessage{}).Where("id = ?", message.ID).Updates(map[string]interface{}{
+				"status":   MQOutboxStatusSent,
+				"attempts": message.Attempts + 1,
+				"sent_at":  &sentAt,
+			}).Error
+			if err != nil {
+				return sent, err
+			}
+
+			sent++
+			continue
+		}
+
+		ctx.Log().Error(publishErr, fmt.Sprintf("mq outbox cannot publish message '%s'", message.MessageID))
+
+		status := MQOutboxStatusPending
+		if message.Attempts+1 >= o.options.MaxAttempts {
+			status = MQOutboxStatusFailed
+		}
+
+		err := tx.Model(&MQOutboxMessage{}).Where("id = ?", message.ID).Updates(map[string]interface{}{
+			"status":          status,
+			"attempts":        message.Attempts + 1,
+			"last_error":      publishErr.Error(),
+			"next_attempt_at": time.Now().Add(mqRetryDelay(message.Attempts, o.options.RetryDelay, DefaultMQMaxRetryDelay)),
+		}).Error
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+func (o *MQOutbox) publish(ctx IContext, message MQOutboxMessage) error {
+	options := &MQPublishOptions{}
+	if message.Options != "" {
+		err := json.Unmarshal([]byte(message.Options), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.MQ().PublishJSON(message.Name, json.RawMessage(message.Payload), options)
+}
+
+func (o *MQOutbox) RelayJob(ctx ICronjobContext) error {
+	return o.Relay(ctx)
+}
+
+func (o *MQOutbox) Run(ctx IContext) {
+	ticker := time.NewTicker(o.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.StdContext().Done():
+			return
+		case <-ticker.C:
+			err := o.Relay(ctx)
+			if err != nil && ctx.StdContext().Err() != context.Canceled {
+				ctx.Log().Error(err, "mq outbox relay failed")
+			}
+		}
+	}
+}
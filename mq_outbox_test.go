@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// newMQOutboxTestDatabase mock a MySQL 8 database, the relay needs SKIP LOCKED
+func newMQOutboxTestDatabase() *MockDatabase {
+	conn, mock, _ := sqlmock.New()
+	mock.ExpectQuery("SELECT VERSION()").
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.33"))
+	db, _ := gorm.Open(mysql.New(mysql.Config{Conn: conn}), nil)
+
+	return &MockDatabase{Gorm: db, Mock: mock}
+}
+
+func TestMQOutbox_Relay(t *testing.T) {
+	db := newMQOutboxTestDatabase()
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := newTestContext(&ContextOptions{DB: db.Gorm, MQ: mq})
+
+	columns := []string{"id", "aggregate_key", "name", "payload", "status", "attempts"}
+	heads := "SELECT \\* FROM `mq_outbox_messages` WHERE \\(status = \\? AND next_attempt_at <= \\?\\) " +
+		"AND \\(aggregate_key = '' OR NOT EXISTS \\(SELECT 1 FROM mq_outbox_messages previous .*" +
+		"AND previous.status IN \\(\\?,\\?\\)\\)\\) ORDER BY id LIMIT 100 FOR UPDATE SKIP LOCKED"
+
+	mq.On("PublishJSON", "order.created", json.RawMessage(`{"id":1}`), mock.Anything).Return(nil)
+	mq.On("PublishJSON", "order.created", json.RawMessage(`{"id":2}`), mock.Anything).Return(errors.New("broker down"))
+	mq.On("PublishJSON", "order.paid", json.RawMessage(`{"id":1}`), mock.Anything).Return(nil)
+
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectQuery(heads).
+		WithArgs(MQOutboxStatusPending, sqlmock.AnyArg(), MQOutboxStatusPending, MQOutboxStatusFailed).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "order:1", "order.created", `{"id":1}`, MQOutboxStatusPending, 0).
+			AddRow(4, "order:2", "order.created", `{"id":2}`, MQOutboxStatusPending, 9))
+	db.Mock.ExpectExec("UPDATE `mq_outbox_messages` SET `attempts`=\\?,`sent_at`=\\?,`status`=\\? WHERE id = \\?").
+		WithArgs(1, sqlmock.AnyArg(), MQOutboxStatusSent, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectExec("UPDATE `mq_outbox_messages` SET `attempts`=\\?,`last_error`=\\?,`next_attempt_at`=\\?,`status`=\\? WHERE id = \\?").
+		WithArgs(10, "broker down", sqlmock.AnyArg(), MQOutboxStatusFailed, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectCommit()
+
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectQuery(heads).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "order:1", "order.paid", `{"id":1}`, MQOutboxStatusPending, 0))
+	db.Mock.ExpectExec("UPDATE `mq_outbox_messages`").
+		WithArgs(1, sqlmock.AnyArg(), MQOutboxStatusSent, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectCommit()
+
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectQuery(heads).WillReturnRows(sqlmock.NewRows(columns))
+	db.Mock.ExpectCommit()
+
+	err := NewMQOutbox(nil).Relay(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+	mq.AssertNumberOfCalls(t, "PublishJSON", 3)
+}
+
+func TestMQOutbox_RelayWithReplica(t *testing.T) {
+	db := newMQOutboxTestDatabase()
+	replica := NewMockDatabase()
+	assert.NoError(t, DBUseReplicas(db.Gorm, replica.Gorm))
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := newTestContext(&ContextOptions{DB: db.Gorm, MQ: mq})
+
+	mq.On("PublishJSON", "order.created", json.RawMessage(`{"id":1}`), mock.Anything).Return(nil)
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectQuery("SELECT \\* FROM `mq_outbox_messages`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "aggregate_key", "name", "payload", "status"}).
+			AddRow(1, "order:1", "order.created", `{"id":1}`, MQOutboxStatusPending))
+	db.Mock.ExpectExec("UPDATE `mq_outbox_messages`").WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectCommit()
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectQuery("SELECT \\* FROM `mq_outbox_messages`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	db.Mock.ExpectCommit()
+
+	err := NewMQOutbox(nil).Relay(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+	assert.NoError(t, replica.Mock.ExpectationsWereMet())
+	mq.AssertNumberOfCalls(t, "PublishJSON", 1)
+}
+
+func TestMQOutbox_RelaySQLServer(t *testing.T) {
+	conn, dbMock, _ := sqlmock.New()
+	db, _ := gorm.Open(sqlserver.New(sqlserver.Config{Conn: conn}), nil)
+	ctx := newTestContext(&ContextOptions{DB: db, MQ: NewMockMQ()})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT \\* FROM mq_outbox_messages WITH \\(UPDLOCK, READPAST\\) WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbMock.ExpectCommit()
+
+	err := NewMQOutbox(nil).Relay(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestMQOutbox_RelayUnsupportedDriver(t *testing.T) {
+	// NewMockDatabase is MySQL 5.7, which has no SKIP LOCKED
+	db := NewMockDatabase()
+	ctx := newTestContext(&ContextOptions{DB: db.Gorm, MQ: NewMockMQ()})
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectRollback()
+
+	err := NewMQOutbox(nil).Relay(ctx)
+	assert.ErrorIs(t, err, ErrMQOutboxUnsupportedDriver)
+	assert.NoError(t, db.Mock.ExpectationsWereMet())
+}
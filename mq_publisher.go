@@ -0,0 +1,284 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pskclub/mine-core/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	MQExchangeDirect  = amqp.ExchangeDirect
+	MQExchangeTopic   = amqp.ExchangeTopic
+	MQExchangeFanout  = amqp.ExchangeFanout
+	MQExchangeHeaders = amqp.ExchangeHeaders
+
+	DefaultMQPublisherPoolSize = 8
+	DefaultMQConfirmTimeout    = 10 * time.Second
+)
+
+var (
+	// ErrMQPublishNacked is returned by PublishJSON when the broker nacks the message
+	ErrMQPublishNacked = errors.New("mq message was nacked by the broker")
+	// ErrMQPublishReturned is returned by PublishJSON when a Mandatory message cannot be routed to any queue
+	ErrMQPublishReturned = errors.New("mq message was returned as unroutable")
+)
+
+type MQPublishOptions struct {
+	Exchange string
+	// ExchangeType declare Exchange before publishing, one of MQExchangeDirect, MQExchangeTopic, MQExchangeFanout or MQExchangeHeaders
+	ExchangeType  string
+	MessageID     string
+	CorrelationID string
+	ReplyTo       string
+	Headers       amqp.Table
+	Durable       bool
+	AutoDelete    bool
+	Exclusive     bool
+	// Mandatory make PublishJSON return ErrMQPublishReturned when the message is not routed to any queue
+	Mandatory    bool
+	Immediate    bool
+	NoWait       bool
+	DeliveryMode uint8
+	Args         amqp.Table
+	// ConfirmTimeout bound the wait for the broker confirm, defaults to DefaultMQConfirmTimeout
+	ConfirmTimeout time.Duration
+}
+
+// mqConfirmation is the broker confirm of a published message
+type mqConfirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// mqPublisherChannel is the part of a channel in confirm mode used by a publisher
+type mqPublisherChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	PublishWithConfirm(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (mqConfirmation, error)
+	IsClosed() bool
+	Close() error
+}
+
+type mqConfirmChannel struct {
+	*amqp.Channel
+}
+
+func (ch mqConfirmChannel) PublishWithConfirm(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (mqConfirmation, error) {
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return confirm, nil
+}
+
+// mqPublisher is a pooled channel in confirm mode, it is used by one publish at a time
+type mqPublisher struct {
+	channel mqPublisherChannel
+	returns chan amqp.Return
+}
+
+// mqWithContext is the mq bound to a context, it shares the connection, the consumers and the publishers of the mq
+type mqWithContext struct {
+	*mq
+	ctx context.Context
+}
+
+// WithContext return the mq bound to ctx, PublishJSON and Reply give up waiting for the broker confirm and Call gives up
+// waiting for the reply when ctx is done
+func (m *mq) WithContext(ctx context.Context) IMQ {
+	return &mqWithContext{mq: m, ctx: ctx}
+}
+
+func (m *mqWithContext) WithContext(ctx context.Context) IMQ {
+	return m.mq.WithContext(ctx)
+}
+
+func (m *mqWithContext) PublishJSON(name string, data interface{}, options *MQPublishOptions) error {
+	return m.publishJSON(m.ctx, name, data, options)
+}
+
+func (m *mqWithContext) Call(name string, payload interface{}, timeout time.Duration) (json.RawMessage, IError) {
+	return m.call(m.ctx, name, payload, timeout)
+}
+
+func (m *mqWithContext) Reply(message amqp.Delivery, result interface{}, ierr IError) error {
+	return m.reply(m.ctx, message, result, ierr)
+}
+
+// PublishJSON publish data as JSON and wait for the broker confirm.
+// With the default exchange a queue called name is declared and name is the routing key,
+// otherwise name is only the routing key of Exchange, which is declared when ExchangeType is set
+func (m *mq) PublishJSON(name string, data interface{}, options *MQPublishOptions) error {
+	return m.publishJSON(context.Background(), name, data, options)
+}
+
+func (m *mq) publishJSON(ctx context.Context, name string, data interface{}, options *MQPublishOptions) error {
+	if options == nil {
+		options = &MQPublishOptions{}
+	}
+
+	m.ReConnect()
+	publisher, err := m.acquirePublisher()
+	if err != nil {
+		return err
+	}
+
+	err = m.publish(ctx, publisher, name, data, options)
+	m.releasePublisher(publisher, err)
+	if err != nil {
+		return err
+	}
+
+	if m.mq.LogLevel == logrus.DebugLevel {
+		fmt.Printf("Publish a message at '%s' channel\n", name)
+	}
+
+	return nil
+}
+
+func (m *mq) publish(ctx context.Context, publisher *mqPublisher, name string, data interface{}, options *MQPublishOptions) error {
+	ch := publisher.channel
+	routingKey := name
+	if options.Exchange == "" {
+		q, err := ch.QueueDeclare(
+			name,               // name
+			options.Durable,    // durable
+			options.AutoDelete, // delete when unused
+			options.Exclusive,  // exclusive
+			options.NoWait,     // no-wait
+			options.Args,       // arguments
+		)
+		if err != nil {
+			return err
+		}
+
+		routingKey = q.Name
+	} else if options.ExchangeType != "" {
+		err := ch.ExchangeDeclare(
+			options.Exchange,     // name
+			options.ExchangeType, // type
+			options.Durable,      // durable
+			options.AutoDelete,   // delete when unused
+			false,                // internal
+			options.NoWait,       // no-wait
+			options.Args,         // arguments
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.publishConfirm(ctx, publisher, options.Exchange, routingKey, options.Mandatory, options.Immediate, amqp.Publishing{
+		Headers:       options.Headers,
+		MessageId:     options.MessageID,
+		CorrelationId: options.CorrelationID,
+		ReplyTo:       options.ReplyTo,
+		DeliveryMode:  options.DeliveryMode,
+		Timestamp:     time.Now(),
+		ContentType:   "application/json",
+		Body:          []byte(utils.JSONToString(data)),
+	}, options.ConfirmTimeout)
+}
+
+// publishRaw publish msg as is through a pooled channel and wait for the broker confirm
+func (m *mq) publishRaw(ctx context.Context, exchange string, routingKey string, msg amqp.Publishing) error {
+	m.ReConnect()
+	publisher, err := m.acquirePublisher()
+	if err != nil {
+		return err
+	}
+
+	err = m.publishConfirm(ctx, publisher, exchange, routingKey, false, false, msg, 0)
+	m.releasePublisher(publisher, err)
+	return err
+}
+
+// publishConfirm wait for the broker confirm until the timeout or until ctx is done
+func (m *mq) publishConfirm(ctx context.Context, publisher *mqPublisher, exchange string, routingKey string, mandatory bool, immediate bool, msg amqp.Publishing, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultMQConfirmTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	confirm, err := publisher.channel.PublishWithConfirm(ctx, exchange, routingKey, mandatory, immediate, msg)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the broker sends basic.return before the confirm, so a return of this message is already buffered
+	select {
+	case ret := <-publisher.returns:
+		return fmt.Errorf("%w: %d %s", ErrMQPublishReturned, ret.ReplyCode, ret.ReplyText)
+	default:
+	}
+
+	if !acked {
+		return ErrMQPublishNacked
+	}
+
+	return nil
+}
+
+// acquirePublisher take an open channel from the pool, or open a new one in confirm mode
+func (m *mq) acquirePublisher() (*mqPublisher, error) {
+	m.mutex.Lock()
+	if m.publishers == nil {
+		m.publishers = make(chan *mqPublisher, DefaultMQPublisherPoolSize)
+	}
+	publishers := m.publishers
+	m.mutex.Unlock()
+
+	for {
+		select {
+		case publisher := <-publishers:
+			if !publisher.channel.IsClosed() {
+				return publisher, nil
+			}
+		default:
+			return m.newPublisher()
+		}
+	}
+}
+
+func (m *mq) newPublisher() (*mqPublisher, error) {
+	ch, err := m.Conn().Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ch.Confirm(false)
+	if err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	return &mqPublisher{
+		channel: mqConfirmChannel{Channel: ch},
+		returns: ch.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
+
+// releasePublisher give the channel back to the pool, a channel that failed or does not fit in the pool is closed
+func (m *mq) releasePublisher(publisher *mqPublisher, err error) {
+	if err == nil && !publisher.channel.IsClosed() {
+		select {
+		case m.publishers <- publisher:
+			return
+		default:
+		}
+	}
+
+	_ = publisher.channel.Close()
+}
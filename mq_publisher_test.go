@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mqTestConfirmation struct {
+	acked bool
+	// pending confirmation never arrives
+	pending bool
+}
+
+func (c mqTestConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	if c.pending {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+
+	return c.acked, nil
+}
+
+type mqTestPublisherChannel struct {
+	confirm   mqTestConfirmation
+	declared  []string
+	published []string
+	closed    bool
+}
+
+func (ch *mqTestPublisherChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ch.declared = append(ch.declared, name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *mqTestPublisherChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	ch.declared = append(ch.declared, name)
+	return nil
+}
+
+func (ch *mqTestPublisherChannel) PublishWithConfirm(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (mqConfirmation, error) {
+	ch.published = append(ch.published, key)
+	return ch.confirm, nil
+}
+
+func (ch *mqTestPublisherChannel) IsClosed() bool {
+	return ch.closed
+}
+
+func (ch *mqTestPublisherChannel) Close() error {
+	ch.closed = true
+	return nil
+}
+
+func newMQTestPublisher(confirm mqTestConfirmation) (*mqPublisher, *mqTestPublisherChannel) {
+	ch := &mqTestPublisherChannel{confirm: confirm}
+	return &mqPublisher{channel: ch, returns: make(chan amqp.Return, 1)}, ch
+}
+
+func TestMQ_PublishConfirm(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	publisher, ch := newMQTestPublisher(mqTestConfirmation{acked: true})
+
+	err := m.publish(context.Background(), publisher, "orders", map[string]string{"id": "1"}, &MQPublishOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, ch.declared)
+	assert.Equal(t, []string{"orders"}, ch.published)
+
+	err = m.publish(context.Background(), publisher, "orders.created", nil, &MQPublishOptions{Exchange: "orders", ExchangeType: MQExchangeTopic})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders", "orders"}, ch.declared)
+	assert.Equal(t, []string{"orders", "orders.created"}, ch.published)
+}
+
+func TestMQ_PublishConfirmNacked(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	publisher, _ := newMQTestPublisher(mqTestConfirmation{acked: false})
+
+	err := m.publishConfirm(context.Background(), publisher, "", "orders", false, false, amqp.Publishing{}, 0)
+	assert.ErrorIs(t, err, ErrMQPublishNacked)
+}
+
+func TestMQ_PublishConfirmReturned(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	publisher, _ := newMQTestPublisher(mqTestConfirmation{acked: true})
+	publisher.returns <- amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+
+	err := m.publishConfirm(context.Background(), publisher, "orders", "created", true, false, amqp.Publishing{}, 0)
+	assert.ErrorIs(t, err, ErrMQPublishReturned)
+}
+
+func TestMQ_PublishConfirmTimeout(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	publisher, _ := newMQTestPublisher(mqTestConfirmation{pending: true})
+
+	start := time.Now()
+	err := m.publishConfirm(context.Background(), publisher, "", "orders", false, false, amqp.Publishing{}, 20*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMQ_PublishConfirmCallerContext(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	publisher, _ := newMQTestPublisher(mqTestConfirmation{pending: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.publishConfirm(ctx, publisher, "", "orders", false, false, amqp.Publishing{}, time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMQ_PublisherPool(t *testing.T) {
+	m := &mq{mq: &MQ{}, publishers: make(chan *mqPublisher, 2)}
+	closed, closedCh := newMQTestPublisher(mqTestConfirmation{})
+	closedCh.closed = true
+	open, _ := newMQTestPublisher(mqTestConfirmation{})
+	m.publishers <- closed
+	m.publishers <- open
+
+	// a channel closed while it was pooled is skipped
+	publisher, err := m.acquirePublisher()
+	assert.NoError(t, err)
+	assert.Same(t, open, publisher)
+	assert.Len(t, m.publishers, 0)
+
+	// a channel goes back to the pool after a successful publish and is closed when the pool is full
+	other, otherCh := newMQTestPublisher(mqTestConfirmation{})
+	full, fullCh := newMQTestPublisher(mqTestConfirmation{})
+	m.releasePublisher(publisher, nil)
+	m.releasePublisher(other, nil)
+	m.releasePublisher(full, nil)
+	assert.Len(t, m.publishers, 2)
+	assert.False(t, otherCh.closed)
+	assert.True(t, fullCh.closed)
+
+	// a channel is closed after a failed publish
+	publisher, err = m.acquirePublisher()
+	assert.NoError(t, err)
+	m.releasePublisher(publisher, ErrMQPublishNacked)
+	assert.Len(t, m.publishers, 1)
+	assert.True(t, publisher.channel.IsClosed())
+}
+
+func TestMQ_WithContext(t *testing.T) {
+	m := &mq{mq: &MQ{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bound := m.WithContext(ctx).(*mqWithContext)
+	assert.Equal(t, ctx, bound.ctx)
+	assert.Same(t, m, bound.mq)
+	assert.Same(t, m, bound.WithContext(context.Background()).(*mqWithContext).mq)
+}
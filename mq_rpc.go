@@ -0,0 +1,265 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pskclub/mine-core/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MQDirectReplyTo is the RabbitMQ pseudo queue used by Call to receive the replies without declaring a callback queue
+const MQDirectReplyTo = "amq.rabbitmq.reply-to"
+
+var MQRPCTimeoutError = Error{
+	Status:  http.StatusGatewayTimeout,
+	Code:    "MQ_RPC_TIMEOUT",
+	Message: "mq rpc timeout"}
+
+var MQRPCInvalidRequestError = Error{
+	Status:  http.StatusBadRequest,
+	Code:    "INVALID_JSON",
+	Message: "Must be json format"}
+
+// MQRPCHandlerFunc handle a request of ConsumeRPC, the result or the error is replied to the caller
+type MQRPCHandlerFunc func(ctx IMQContext, message amqp.Delivery) (interface{}, IError)
+
+// MQRPCReply is the JSON envelope replied by ConsumeRPC
+type MQRPCReply struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *MQRPCError     `json:"error,omitempty"`
+}
+
+type MQRPCError struct {
+	Status  int         `json:"status"`
+	Code    string      `json:"code"`
+	Message interface{} `json:"message"`
+	Fields  interface{} `json:"fields,omitempty"`
+}
+
+// MQRPCHandler decode the request body into T before calling handler, an invalid body is replied as MQRPCInvalidRequestError
+func MQRPCHandler[T any](handler func(ctx IMQContext, request *T) (interface{}, IError)) MQRPCHandlerFunc {
+	return func(ctx IMQContext, message amqp.Delivery) (interface{}, IError) {
+		request := new(T)
+		if err := json.Unmarshal(message.Body, request); err != nil {
+			return nil, MQRPCInvalidRequestError
+		}
+
+		return handler(ctx, request)
+	}
+}
+
+// mqRPCChannel is the part of *amqp.Channel used by Call once the reply-to queue is consumed
+type mqRPCChannel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	IsClosed() bool
+}
+
+type mqRPCClient struct {
+	channel mqRPCChannel
+	mutex   sync.Mutex
+	pending map[string]chan amqp.Delivery
+}
+
+// rpcClient return the channel consuming the direct reply-to queue, it is opened again when the previous one is closed
+func (m *mq) rpcClient() (*mqRPCClient, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.rpc != nil && !m.rpc.channel.IsClosed() {
+		return m.rpc, nil
+	}
+
+	ch, err := m.Conn().Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := ch.Consume(MQDirectReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	client := &mqRPCClient{channel: ch, pending: make(map[string]chan amqp.Delivery)}
+	go func() {
+		for d := range replies {
+			client.mutex.Lock()
+			reply, ok := client.pending[d.CorrelationId]
+			delete(client.pending, d.CorrelationId)
+			client.mutex.Unlock()
+
+			if ok {
+				reply <- d
+			}
+		}
+
+		// the channel is closed, every pending call fails instead of waiting for its timeout
+		client.mutex.Lock()
+		for correlationID, reply := range client.pending {
+			close(reply)
+			delete(client.pending, correlationID)
+		}
+		client.mutex.Unlock()
+	}()
+
+	m.rpc = client
+	return client, nil
+}
+
+func (c *mqRPCClient) register(correlationID string) chan amqp.Delivery {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	reply := make(chan amqp.Delivery, 1)
+	c.pending[correlationID] = reply
+	return reply
+}
+
+func (c *mqRPCClient) unregister(correlationID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.pending, correlationID)
+}
+
+func newMQRPCError(err error) IError {
+	return Error{
+		Status:        MQError.Status,
+		Code:          MQError.Code,
+		Message:       MQError.Message,
+		originalError: err,
+	}
+}
+
+// Call publish payload to the queue name and wait for the reply of its ConsumeRPC handler,
+// an error replied by the handler is returned with its code and status
+func (m *mq) Call(name string, payload interface{}, timeout time.Duration) (json.RawMessage, IError) {
+	return m.call(context.Background(), name, payload, timeout)
+}
+
+// call stop waiting for the reply when timeout elapses or parent is done
+func (m *mq) call(parent context.Context, name string, payload interface{}, timeout time.Duration) (json.RawMessage, IError) {
+	if timeout <= 0 {
+		timeout = DefaultMQConfirmTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	m.ReConnect()
+	client, err := m.rpcClient()
+	if err != nil {
+		return nil, newMQRPCError(err)
+	}
+
+	correlationID := utils.GetUUID()
+	reply := client.register(correlationID)
+	defer client.unregister(correlationID)
+
+	err = client.channel.PublishWithContext(ctx, "", name, false, false, amqp.Publishing{
+		CorrelationId: correlationID,
+		ReplyTo:       MQDirectReplyTo,
+		Expiration:    strconv.FormatInt(timeout.Milliseconds(), 10),
+		Timestamp:     time.Now(),
+		ContentType:   "application/json",
+		Body:          []byte(utils.JSONToString(payload)),
+	})
+	if err != nil {
+		return nil, newMQRPCError(err)
+	}
+
+	select {
+	case d, ok := <-reply:
+		if !ok {
+			return nil, newMQRPCError(amqp.ErrClosed)
+		}
+
+		envelope := &MQRPCReply{}
+		if err := json.Unmarshal(d.Body, envelope); err != nil {
+			return nil, newMQRPCError(err)
+		}
+
+		if envelope.Error != nil {
+			return nil, Error{
+				Status:  envelope.Error.Status,
+				Code:    envelope.Error.Code,
+				Message: envelope.Error.Message,
+				Fields:  envelope.Error.Fields,
+			}
+		}
+
+		return envelope.Result, nil
+	case <-ctx.Done():
+		return nil, Error{
+			Status:        MQRPCTimeoutError.Status,
+			Code:          MQRPCTimeoutError.Code,
+			Message:       MQRPCTimeoutError.Message,
+			originalError: ctx.Err(),
+		}
+	}
+}
+
+// Reply send the result or the error of a request to its ReplyTo queue, a request without ReplyTo is ignored
+func (m *mq) Reply(message amqp.Delivery, result interface{}, ierr IError) error {
+	return m.reply(context.Background(), message, result, ierr)
+}
+
+func (m *mq) reply(ctx context.Context, message amqp.Delivery, result interface{}, ierr IError) error {
+	if message.ReplyTo == "" {
+		return nil
+	}
+
+	envelope := &MQRPCReply{}
+	if ierr != nil {
+		envelope.Error = &MQRPCError{
+			Status:  ierr.GetStatus(),
+			Code:    ierr.GetCode(),
+			Message: ierr.GetMessage(),
+		}
+		if e, ok := ierr.(Error); ok {
+			envelope.Error.Fields = e.Fields
+		}
+	} else {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		envelope.Result = body
+	}
+
+	return m.publishRaw(ctx, "", message.ReplyTo, amqp.Publishing{
+		CorrelationId: message.CorrelationId,
+		Timestamp:     time.Now(),
+		ContentType:   "application/json",
+		Body:          []byte(utils.JSONToString(envelope)),
+	})
+}
+
+// rpcHandler adapt handler to Subscribe, a panic is replied as MQError so the caller does not wait for its timeout.
+// A reply that cannot be sent is only logged, retrying would run the handler again for a caller that may be gone
+func rpcHandler(handler MQRPCHandlerFunc) MQHandlerFunc {
+	return func(ctx IMQContext, message amqp.Delivery) error {
+		result, ierr := func() (result interface{}, ierr IError) {
+			defer func() {
+				if r := recover(); r != nil {
+					ierr = ctx.NewError(fmt.Errorf("%v", r), MQError)
+				}
+			}()
+
+			return handler(ctx, message)
+		}()
+
+		err := ctx.MQ().Reply(message, result, ierr)
+		if err != nil {
+			ctx.Log().Error(err, fmt.Sprintf("mq rpc cannot reply to '%s'", message.ReplyTo))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type mqRPCTestRequest struct {
+	Name string `json:"name"`
+}
+
+func TestRPCHandler_ReplyResult(t *testing.T) {
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := &MQContext{IContext: newTestContext(&ContextOptions{MQ: mq})}
+
+	message := amqp.Delivery{Body: []byte(`{"name":"mine"}`), ReplyTo: MQDirectReplyTo}
+	mq.On("Reply", message, "hello mine", nil).Return(nil)
+
+	handler := rpcHandler(MQRPCHandler(func(ctx IMQContext, request *mqRPCTestRequest) (interface{}, IError) {
+		return "hello " + request.Name, nil
+	}))
+
+	assert.NoError(t, handler(ctx, message))
+	mq.AssertExpectations(t)
+}
+
+func TestRPCHandler_ReplyInvalidRequest(t *testing.T) {
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := &MQContext{IContext: newTestContext(&ContextOptions{MQ: mq})}
+
+	message := amqp.Delivery{Body: []byte(`not json`), ReplyTo: MQDirectReplyTo}
+	mq.On("Reply", message, nil, mock.MatchedBy(func(ierr IError) bool {
+		return ierr.GetStatus() == http.StatusBadRequest && ierr.GetCode() == MQRPCInvalidRequestError.Code
+	})).Return(nil)
+
+	handler := rpcHandler(MQRPCHandler(func(ctx IMQContext, request *mqRPCTestRequest) (interface{}, IError) {
+		return nil, nil
+	}))
+
+	assert.NoError(t, handler(ctx, message))
+	mq.AssertExpectations(t)
+}
+
+func TestRPCHandler_ReplyFailure(t *testing.T) {
+	mq := NewMockMQ()
+	mq.On("WithContext", mock.Anything).Return(mq)
+	ctx := &MQContext{IContext: newTestContext(&ContextOptions{MQ: mq})}
+
+	message := amqp.Delivery{Body: []byte(`{"name":"mine"}`), ReplyTo: MQDirectReplyTo}
+	mq.On("Reply", message, "hello mine", nil).Return(errors.New("reply-to queue not found"))
+
+	calls := 0
+	handler := rpcHandler(MQRPCHandler(func(ctx IMQContext, request *mqRPCTestRequest) (interface{}, IError) {
+		calls++
+		return "hello " + request.Name, nil
+	}))
+
+	// the delivery is acked rather than retried, the handler is not run again
+	assert.NoError(t, handler(ctx, message))
+	assert.Equal(t, 1, calls)
+	mq.AssertExpectations(t)
+}
+
+type mqRPCTestChannel struct {
+	published chan amqp.Publishing
+}
+
+func (ch *mqRPCTestChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch.published <- msg
+	return nil
+}
+
+func (ch *mqRPCTestChannel) IsClosed() bool {
+	return false
+}
+
+func TestMQ_CallWithContext(t *testing.T) {
+	ch := &mqRPCTestChannel{published: make(chan amqp.Publishing, 1)}
+	// a closed mq does not dial, the pending calls use the current rpc channel
+	m := &mq{mq: &MQ{}, isClosed: true, rpc: &mqRPCClient{channel: ch, pending: make(map[string]chan amqp.Delivery)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ch.published
+		cancel()
+	}()
+
+	start := time.Now()
+	_, ierr := m.WithContext(ctx).Call("orders.get", nil, time.Minute)
+	if assert.Error(t, ierr) {
+		assert.Equal(t, MQRPCTimeoutError.Code, ierr.GetCode())
+		assert.ErrorIs(t, ierr.OriginalError(), context.Canceled)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Empty(t, m.rpc.pending)
+}
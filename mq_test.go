@@ -0,0 +1,64 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMQ_RedialDoesNotBlockState(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	client := &mq{state: MQStateReconnecting, mq: &MQ{URI: "amqp://guest:guest@" + listener.Addr().String() + "/"}}
+	dialed := make(chan error, 1)
+	go func() {
+		dialed <- client.redial()
+	}()
+
+	// the broker never answers the handshake, so the dial hangs until the connection is closed
+	conn := <-accepted
+	state := make(chan MQConnectionState, 1)
+	go func() {
+		state <- client.State()
+	}()
+
+	select {
+	case s := <-state:
+		assert.Equal(t, MQStateReconnecting, s)
+	case <-time.After(time.Second):
+		t.Fatal("State is blocked by the dial")
+	}
+
+	_ = conn.Close()
+	assert.Error(t, <-dialed)
+}
+
+func TestNewMQContext_MockMQ(t *testing.T) {
+	mq := NewMockMQ()
+	mq.On("OnReconnect", mock.Anything)
+
+	ctx := NewMQContext(&MQContextOptions{ContextOptions: &ContextOptions{ENV: newTestENV(nil), MQ: mq}})
+	assert.NotNil(t, ctx)
+	mq.AssertCalled(t, "OnReconnect", mock.Anything)
+}
+
+func TestMockMQ_CallError(t *testing.T) {
+	mq := NewMockMQ()
+	mq.On("Call", "orders.get", nil, time.Second).Return(nil, MQRPCTimeoutError)
+
+	result, ierr := mq.Call("orders.get", nil, time.Second)
+	assert.Nil(t, result)
+	assert.Equal(t, MQRPCTimeoutError, ierr)
+}
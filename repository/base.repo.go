@@ -57,7 +57,7 @@ type BaseRepository[M IModel] struct {
 
 func New[M IModel](ctx core.IContext) IRepository[M] {
 	item := new(M)
-	return &BaseRepository[M]{ctx: ctx, db: ctx.DB().Model(item)}
+	return &BaseRepository[M]{ctx: ctx, db: ctx.DB().WithContext(ctx.StdContext()).Model(item)}
 }
 
 func NewWithDB[M IModel](ctx core.IContext, db *gorm.DB) IRepository[M] {
@@ -66,7 +66,7 @@ func NewWithDB[M IModel](ctx core.IContext, db *gorm.DB) IRepository[M] {
 	if newDB == nil {
 		newDB = ctx.DB()
 	}
-	return &BaseRepository[M]{ctx: ctx, db: newDB.Model(item)}
+	return &BaseRepository[M]{ctx: ctx, db: newDB.WithContext(ctx.StdContext()).Model(item)}
 }
 
 // FindAll find records that match given conditions
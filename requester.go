@@ -138,13 +138,13 @@ func newRequesterWithOptions(ctx IContext, options *RequesterOptions) *Requester
 
 func (r Requester) Get(url string, options *RequesterOptions) (*RequestResponse, error) {
 	url, headers := r.getOptions(url, options)
-	res, err := r.client.Get(url, headers)
+	res, err := r.do(http.MethodGet, url, nil, headers)
 	return r.transformResponse(res, err)
 }
 
 func (r Requester) Delete(url string, options *RequesterOptions) (*RequestResponse, error) {
 	url, headers := r.getOptions(url, options)
-	res, err := r.client.Delete(url, headers)
+	res, err := r.do(http.MethodDelete, url, nil, headers)
 	return r.transformResponse(res, err)
 }
 
@@ -159,7 +159,7 @@ func (r Requester) Post(url string, body interface{}, options *RequesterOptions)
 
 		headers.Add("Content-Type", contentType)
 
-		res, err := r.client.Post(url, newBody, headers)
+		res, err := r.do(http.MethodPost, url, newBody, headers)
 		return r.transformResponse(res, err)
 
 	} else if options.IsURLEncode {
@@ -171,10 +171,10 @@ func (r Requester) Post(url string, body interface{}, options *RequesterOptions)
 		headers.Add("Content-Type", "application/x-www-form-urlencoded")
 		headers.Add("Content-Length", length)
 
-		res, err := r.client.Post(url, newBody, headers)
+		res, err := r.do(http.MethodPost, url, newBody, headers)
 		return r.transformResponse(res, err)
 	} else {
-		res, err := r.client.Post(url, r.getJSONBody(body, options), headers)
+		res, err := r.do(http.MethodPost, url, r.getJSONBody(body, options), headers)
 		return r.transformResponse(res, err)
 
 	}
@@ -188,24 +188,33 @@ func (r Requester) Create(method RequesterMethodType, url string, body interface
 		newBody = r.getJSONBody(body, options)
 	}
 
-	req, err := http.NewRequest(string(method), url, newBody)
-	req.Header = headers
-	res, err := r.client.Do(req)
+	res, err := r.do(string(method), url, newBody, headers)
 	return r.transformResponse(res, err)
 }
 
 func (r Requester) Put(url string, body interface{}, options *RequesterOptions) (*RequestResponse, error) {
 	url, headers := r.getOptions(url, options)
-	res, err := r.client.Put(url, r.getJSONBody(body, options), headers)
+	res, err := r.do(http.MethodPut, url, r.getJSONBody(body, options), headers)
 	return r.transformResponse(res, err)
 }
 
 func (r Requester) Patch(url string, body interface{}, options *RequesterOptions) (*RequestResponse, error) {
 	url, headers := r.getOptions(url, options)
-	res, err := r.client.Patch(url, r.getJSONBody(body, options), headers)
+	res, err := r.do(http.MethodPatch, url, r.getJSONBody(body, options), headers)
 	return r.transformResponse(res, err)
 }
 
+// do send the request bound to the context.Context of the requester, so it is cancelled together with the caller
+func (r Requester) do(method string, url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx.StdContext(), method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = headers
+	return r.client.Do(req)
+}
+
 func (r Requester) transformResponse(res *http.Response, err error) (*RequestResponse, error) {
 	var data map[string]interface{}
 
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -38,18 +39,35 @@ func (r *S3Config) Connect() (IS3, error) {
 	}
 
 	svc := ss3.New(sess)
-	return &s3{client: svc, config: r}, nil
+	return &s3{client: svc, config: r, ctx: context.Background()}, nil
 }
 
 type IS3 interface {
 	GetObject(path string, opts *ss3.GetObjectInput) (*ss3.GetObjectOutput, error)
 	PutObject(objectName string, file io.ReadSeeker, opts *ss3.PutObjectInput, uploadOptions *UploadOptions) (*ss3.PutObjectOutput, error)
 	PutObjectByURL(objectName string, url string, opts *ss3.PutObjectInput, uploadOptions *UploadOptions) (*ss3.PutObjectOutput, error)
+	HeadBucket() error
+	WithContext(ctx context.Context) IS3
 }
 
 type s3 struct {
 	client *ss3.S3
 	config *S3Config
+	ctx    context.Context
+}
+
+// WithContext return a copy of the client that sends every request with ctx
+func (r s3) WithContext(ctx context.Context) IS3 {
+	r.ctx = ctx
+	return &r
+}
+
+func (r s3) getContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
 }
 
 func NewS3(env *ENVConfig) *S3Config {
@@ -94,7 +112,7 @@ func (r s3) PutObject(objectName string, file io.ReadSeeker, opts *ss3.PutObject
 	opts.Key = aws.String(objectName)
 	opts.Body = reader
 
-	req, err := r.client.PutObject(opts)
+	req, err := r.client.PutObjectWithContext(r.getContext(), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +127,7 @@ func (r s3) GetObject(path string, opts *ss3.GetObjectInput) (*ss3.GetObjectOutp
 
 	opts.Bucket = aws.String(r.config.Bucket)
 	opts.Key = aws.String(path)
-	result, err := r.client.GetObject(opts)
+	result, err := r.client.GetObjectWithContext(r.getContext(), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +135,21 @@ func (r s3) GetObject(path string, opts *ss3.GetObjectInput) (*ss3.GetObjectOutp
 	return result, nil
 }
 
+func (r s3) HeadBucket() error {
+	_, err := r.client.HeadBucketWithContext(r.getContext(), &ss3.HeadBucketInput{
+		Bucket: aws.String(r.config.Bucket),
+	})
+
+	return err
+}
+
 func (r s3) PutObjectByURL(objectName string, url string, opts *ss3.PutObjectInput, uploadOptions *UploadOptions) (*ss3.PutObjectOutput, error) {
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(r.getContext(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +17,9 @@ func CaptureError(ctx IContext, level sentry.Level, err error, args ...interface
 		return
 	}
 
-	sentry.ConfigureScope(func(scope *sentry.Scope) {
+	// a cloned hub keeps the scope of this context apart from the messages and jobs handled concurrently
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
 		scope.SetRequest(nil)
 		valueMap, _ := utils.StructToMap(ctx.ENV().All())
 		scope.SetContext("env", valueMap)
@@ -55,9 +57,9 @@ func CaptureError(ctx IContext, level sentry.Level, err error, args ...interface
 		}
 
 		if ierr, ok := err.(IError); ok {
-			sentry.CaptureException(ierr.OriginalError())
+			hub.CaptureException(ierr.OriginalError())
 		} else {
-			sentry.CaptureException(err)
+			hub.CaptureException(err)
 		}
 	})
 }